@@ -0,0 +1,107 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+)
+
+const (
+	// breakerStateKey is the device state key of the circuit breaker
+	breakerStateKey = "breaker"
+	// breakerInitialBackoff is the time between probes right after the breaker opens
+	breakerInitialBackoff = time.Minute
+	// defaultBreakerMaxBackoff is used when the max backoff argument is not valid
+	defaultBreakerMaxBackoff = time.Hour
+)
+
+// breakerState is the health of the target as persisted between runs
+type breakerState struct {
+	Failures  int   `json:"failures"`
+	Open      bool  `json:"open"`
+	Backoff   int64 `json:"backoff"`
+	NextProbe int64 `json:"nextProbe"`
+}
+
+// circuitBreaker stops polling a target after threshold consecutive failed
+// probes. While open, the target is only probed on a backoff schedule that
+// doubles after each failed probe, and the breaker closes once it answers.
+type circuitBreaker struct {
+	state      breakerState
+	threshold  int
+	maxBackoff time.Duration
+}
+
+// loadBreaker reads the breaker of the target from the device state
+func loadBreaker() *circuitBreaker {
+	b := &circuitBreaker{threshold: args.BreakerThreshold, maxBackoff: time.Duration(args.BreakerMaxBackoff) * time.Second}
+	if b.maxBackoff < breakerInitialBackoff {
+		b.maxBackoff = defaultBreakerMaxBackoff
+	}
+	if _, err := theDeviceState.Get(breakerStateKey, &b.state); err != nil {
+		b.state = breakerState{}
+	}
+	return b
+}
+
+// allow reports whether the target may be polled at now
+func (b *circuitBreaker) allow(now time.Time) bool {
+	return !b.state.Open || now.Unix() >= b.state.NextProbe
+}
+
+// record updates the breaker with the outcome of a probe and stores it
+func (b *circuitBreaker) record(reachable bool, now time.Time) {
+	switch {
+	case reachable:
+		if b.state.Open {
+			log.Info("target %s answered after %d failed probes, resuming collection", targetHost, b.state.Failures)
+		}
+		b.state = breakerState{}
+	case b.state.Open:
+		b.state.Failures++
+		backoff := 2 * time.Duration(b.state.Backoff) * time.Second
+		if backoff > b.maxBackoff {
+			backoff = b.maxBackoff
+		}
+		b.backoff(backoff, now)
+	default:
+		b.state.Failures++
+		if b.threshold > 0 && b.state.Failures >= b.threshold {
+			log.Warn("target %s failed %d consecutive probes, polling it only with probes until it answers", targetHost, b.state.Failures)
+			b.state.Open = true
+			b.backoff(breakerInitialBackoff, now)
+		}
+	}
+	theDeviceState.Set(breakerStateKey, b.state)
+}
+
+func (b *circuitBreaker) backoff(backoff time.Duration, now time.Time) {
+	b.state.Backoff = int64(backoff / time.Second)
+	b.state.NextProbe = now.Add(backoff).Unix()
+}
+
+// checkTarget probes the target unless its breaker is open and the next probe
+// is not due yet, and returns the status of the target. Metric sets are
+// collected as long as the breaker is not open, the identity of the target is
+// only read when the status is reachable.
+func checkTarget(now time.Time) deviceStatus {
+	b := loadBreaker()
+	var status deviceStatus
+	if b.allow(now) {
+		status = probeDevice(theClient)
+		b.record(status.reachable, now)
+	} else {
+		status = deviceStatus{
+			errorClass:   errorClassCircuitOpen,
+			errorMessage: fmt.Sprintf("target failed %d consecutive probes, next probe at %s", b.state.Failures, time.Unix(b.state.NextProbe, 0).Format(time.RFC3339)),
+		}
+	}
+	status.breakerOpen = b.state.Open
+	status.failures = b.state.Failures
+	theSysUpTime = status.uptime
+	return status
+}
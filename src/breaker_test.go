@@ -0,0 +1,72 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	defer func(a argumentList, store persist.Storer) { args, theDeviceState = a, store }(args, theDeviceState)
+	args.BreakerThreshold = 2
+	args.BreakerMaxBackoff = 180
+	theDeviceState = persist.NewInMemoryStore()
+	now := time.Now()
+
+	// Each run loads the breaker persisted by the previous one
+	loadBreaker().record(false, now)
+	b := loadBreaker()
+	assert.False(t, b.state.Open)
+	assert.True(t, b.allow(now))
+
+	b.record(false, now)
+	b = loadBreaker()
+	assert.True(t, b.state.Open)
+	assert.False(t, b.allow(now.Add(30*time.Second)))
+	assert.True(t, b.allow(now.Add(time.Minute)))
+
+	// The backoff doubles after each failed probe, up to the maximum
+	now = now.Add(time.Minute)
+	b.record(false, now)
+	assert.Equal(t, int64(120), b.state.Backoff)
+	now = now.Add(2 * time.Minute)
+	b.record(false, now)
+	assert.Equal(t, int64(180), b.state.Backoff)
+	assert.Equal(t, 4, b.state.Failures)
+	assert.False(t, b.allow(now.Add(179*time.Second)))
+
+	// The breaker closes as soon as the target answers
+	b.record(true, now.Add(3*time.Minute))
+	b = loadBreaker()
+	assert.Equal(t, breakerState{}, b.state)
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	defer func(store persist.Storer) { theDeviceState = store }(theDeviceState)
+	theDeviceState = persist.NewInMemoryStore()
+	b := loadBreaker()
+	for i := 0; i < 10; i++ {
+		b.record(false, time.Now())
+	}
+	assert.False(t, b.state.Open)
+	assert.Equal(t, 10, b.state.Failures)
+}
+
+func TestCheckTarget_Open(t *testing.T) {
+	defer func(store persist.Storer) { theDeviceState = store }(theDeviceState)
+	theDeviceState = persist.NewInMemoryStore()
+	now := time.Now()
+	theDeviceState.Set(breakerStateKey, breakerState{Failures: 5, Open: true, Backoff: 60, NextProbe: now.Add(time.Minute).Unix()})
+
+	// The target is not probed before the next probe is due
+	status := checkTarget(now)
+	assert.False(t, status.reachable)
+	assert.True(t, status.breakerOpen)
+	assert.Equal(t, errorClassCircuitOpen, status.errorClass)
+	assert.Equal(t, 5, status.failures)
+}
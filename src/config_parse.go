@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strings"
+	"time"
 
 	"github.com/newrelic/infra-integrations-sdk/data/metric"
 	"github.com/newrelic/infra-integrations-sdk/log"
@@ -16,22 +17,44 @@ import (
 // collectionParser is a struct to aid the automatic
 // parsing of a collection yaml file
 type collectionParser struct {
+	Output  string `yaml:"output"`
 	Collect []struct {
-		Device     string            `yaml:"device"`
-		MetricSets []metricSetParser `yaml:"metric_sets"`
-		Inventory  []inventoryParser `yaml:"inventory"`
+		Device            string                 `yaml:"device"`
+		Attributes        map[string]string      `yaml:"attributes"`
+		InventoryInterval string                 `yaml:"inventory_interval"`
+		MetricSets        []metricSetParser      `yaml:"metric_sets"`
+		Inventory         []inventoryParser      `yaml:"inventory"`
+		InventoryTables   []inventoryTableParser `yaml:"inventory_tables"`
 	}
 }
 
 // metricSetParser is a struct to aid the automatic
 // parsing of a collection yaml file
 type metricSetParser struct {
-	Name      string         `yaml:"name"`
-	Type      string         `yaml:"type"`
-	EventType string         `yaml:"event_type"`
-	Metrics   []metricParser `yaml:"metrics"`
-	RootOid   string         `yaml:"root_oid"`
-	Index     []indexParser  `yaml:"index"`
+	Name       string            `yaml:"name"`
+	Type       string            `yaml:"type"`
+	EventType  string            `yaml:"event_type"`
+	Metrics    []metricParser    `yaml:"metrics"`
+	RootOid    string            `yaml:"root_oid"`
+	Index      []indexParser     `yaml:"index"`
+	Entity     *entityParser     `yaml:"entity"`
+	Attributes map[string]string `yaml:"attributes"`
+	Interval   string            `yaml:"interval"`
+	// MaxOidsPerRequest limits the OIDs sent in each GET of a scalar metric set
+	MaxOidsPerRequest int `yaml:"max_oids_per_request"`
+	// Timeout and Retries override the arguments of the same name
+	Timeout string `yaml:"timeout"`
+	Retries *int   `yaml:"retries"`
+	// MaxWalkDuration and MaxWalkRows bound the walks of a table metric set
+	MaxWalkDuration string `yaml:"max_walk_duration"`
+	MaxWalkRows     int    `yaml:"max_walk_rows"`
+}
+
+// entityParser is a struct to aid the automatic
+// parsing of a collection yaml file
+type entityParser struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
 }
 
 // metricParser is a struct to aid the automatic
@@ -57,13 +80,35 @@ type inventoryParser struct {
 	Name     string `yaml:"name"`
 }
 
+// inventoryTableParser is a struct to aid the automatic
+// parsing of a collection yaml file
+type inventoryTableParser struct {
+	RootOid  string           `yaml:"root_oid"`
+	Category string           `yaml:"category"`
+	Index    []indexParser    `yaml:"index"`
+	Fields   []inventoryField `yaml:"fields"`
+}
+
+// inventoryField is a struct to aid the automatic
+// parsing of a collection yaml file
+type inventoryField struct {
+	Oid  string `yaml:"oid"`
+	Name string `yaml:"name"`
+}
+
 // End of parser defs
 
 // fully parsed and validated collection
 type collection struct {
-	Device     string
+	Device string
+	// Output is the format the metric sets are reported in
+	Output     string
 	MetricSets []metricSet
 	Inventory  []inventoryItem
+	// InventoryTables are walked and produce one inventory item per row
+	InventoryTables []inventoryTable
+	// InventoryInterval is how often the inventory is polled in daemon mode, 0 for the default interval
+	InventoryInterval time.Duration
 }
 
 // metricSet is a validated and simplified
@@ -75,6 +120,30 @@ type metricSet struct {
 	Metrics   []*metricDef
 	RootOid   string
 	Index     []*index
+	// Entity, when set, reports each table row as its own entity
+	Entity *rowEntity
+	// Attributes are custom attribute templates added to every sample, merged
+	// from the collection and the metric set
+	Attributes map[string]string
+	// Interval is how often the metric set is polled in daemon mode, 0 for the default interval
+	Interval time.Duration
+	// MaxOidsPerRequest is the number of OIDs sent in each GET of a scalar metric set, 0 for the default
+	MaxOidsPerRequest int
+	// Timeout is the timeout of each request, 0 for the TIMEOUT argument
+	Timeout time.Duration
+	// Retries is the number of retries of each request, nil for the RETRIES argument
+	Retries *int
+	// MaxWalkDuration and MaxWalkRows bound the walks of the metric set, 0 for no limit
+	MaxWalkDuration time.Duration
+	MaxWalkRows     int
+}
+
+// rowEntity is a storage struct containing the naming
+// of the entities created for the rows of a table
+type rowEntity struct {
+	// name is a template expanded with the index values of each row
+	name       string
+	entityType string
 }
 
 // metricDef is a storage struct containing
@@ -101,6 +170,27 @@ type inventoryItem struct {
 	name     string
 }
 
+// inventoryTable is a storage struct containing the information
+// of an inventory defined over the rows of an SNMP table
+type inventoryTable struct {
+	rootOid string
+	// category is a template expanded with the index values of each row
+	category string
+	index    []*index
+	fields   []*inventoryItem
+}
+
+const (
+	// outputEvent reports metric sets as samples of their event type
+	outputEvent = "event"
+	// outputDimensional reports each metric as a dimensional metric
+	outputDimensional = "dimensional"
+	// outputOTLP sends each metric to an OTLP/HTTP endpoint
+	outputOTLP = "otlp"
+	// outputJSONLines appends each sample to a JSON lines file
+	outputJSONLines = "jsonl"
+)
+
 var (
 	// SourcesNameToType maps the string used in yaml to a metric type
 	SourcesNameToType = map[string]metric.SourceType{
@@ -123,9 +213,13 @@ func parseYaml(filename string) (*collectionParser, error) {
 		log.Error("Failed to open %s: %s", filename, err)
 		return nil, err
 	}
-	// Parse the file
+	return unmarshalCollection(yamlFile)
+}
+
+// unmarshalCollection parses the content of a collection definition into a collectionParser
+func unmarshalCollection(content []byte) (*collectionParser, error) {
 	var c collectionParser
-	if err := yaml.Unmarshal(yamlFile, &c); err != nil {
+	if err := yaml.Unmarshal(content, &c); err != nil {
 		log.Error("Failed to parse collection: %s", err)
 		return nil, err
 	}
@@ -136,9 +230,20 @@ func parseYaml(filename string) (*collectionParser, error) {
 // an slice of metricSetDefinition objects containing the validated configuration
 func parseCollection(c *collectionParser) ([]*collection, error) {
 	var cols []*collection
+	output := strings.TrimSpace(c.Output)
+	switch output {
+	case "":
+		output = outputEvent
+	case outputEvent, outputDimensional, outputOTLP, outputJSONLines:
+	default:
+		return nil, fmt.Errorf("invalid output %s, valid values are %s", output, strings.Join(sinkOrder, ", "))
+	}
 	var metricSets []metricSet
 	var inventory []inventoryItem
 	for _, dataSet := range c.Collect {
+		if err := checkAttributeNames(dataSet.Attributes); err != nil {
+			return nil, fmt.Errorf("collection %s: %v", dataSet.Device, err)
+		}
 		var newMetricSet metricSet
 		for _, metricSetParser := range dataSet.MetricSets {
 			name := strings.TrimSpace(metricSetParser.Name)
@@ -183,13 +288,66 @@ func parseCollection(c *collectionParser) ([]*collection, error) {
 				indexes = append(indexes, newIndex)
 			}
 			rootOID := strings.TrimSpace(metricSetParser.RootOid)
+			var entity *rowEntity
+			if metricSetParser.Entity != nil {
+				if metricSetType != "table" {
+					return nil, fmt.Errorf("metric set %s: `entity` is only supported for table metric sets", name)
+				}
+				entity = &rowEntity{
+					name:       strings.TrimSpace(metricSetParser.Entity.Name),
+					entityType: strings.TrimSpace(metricSetParser.Entity.Type),
+				}
+				if entity.name == "" || entity.entityType == "" {
+					return nil, fmt.Errorf("metric set %s: `entity` requires both `name` and `type`", name)
+				}
+			}
+			if err := checkAttributeNames(metricSetParser.Attributes); err != nil {
+				return nil, fmt.Errorf("metric set %s: %v", name, err)
+			}
+			// metric set attributes take precedence over the collection ones
+			attributes := make(map[string]string, len(dataSet.Attributes)+len(metricSetParser.Attributes))
+			for k, v := range dataSet.Attributes {
+				attributes[k] = v
+			}
+			for k, v := range metricSetParser.Attributes {
+				attributes[k] = v
+			}
+			interval, err := parseInterval(metricSetParser.Interval)
+			if err != nil {
+				return nil, fmt.Errorf("metric set %s: %v", name, err)
+			}
+			if metricSetParser.MaxOidsPerRequest < 0 {
+				return nil, fmt.Errorf("metric set %s: invalid max_oids_per_request %d", name, metricSetParser.MaxOidsPerRequest)
+			}
+			timeout, err := parseDuration("timeout", metricSetParser.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("metric set %s: %v", name, err)
+			}
+			if metricSetParser.Retries != nil && *metricSetParser.Retries < 0 {
+				return nil, fmt.Errorf("metric set %s: invalid retries %d", name, *metricSetParser.Retries)
+			}
+			maxWalkDuration, err := parseDuration("max_walk_duration", metricSetParser.MaxWalkDuration)
+			if err != nil {
+				return nil, fmt.Errorf("metric set %s: %v", name, err)
+			}
+			if metricSetParser.MaxWalkRows < 0 {
+				return nil, fmt.Errorf("metric set %s: invalid max_walk_rows %d", name, metricSetParser.MaxWalkRows)
+			}
 			newMetricSet = metricSet{
-				Name:      name,
-				Type:      metricSetType,
-				EventType: eventType,
-				Metrics:   metrics,
-				RootOid:   rootOID,
-				Index:     indexes,
+				Name:              name,
+				Type:              metricSetType,
+				EventType:         eventType,
+				Metrics:           metrics,
+				RootOid:           rootOID,
+				Index:             indexes,
+				Entity:            entity,
+				Attributes:        attributes,
+				Interval:          interval,
+				MaxOidsPerRequest: metricSetParser.MaxOidsPerRequest,
+				Timeout:           timeout,
+				Retries:           metricSetParser.Retries,
+				MaxWalkDuration:   maxWalkDuration,
+				MaxWalkRows:       metricSetParser.MaxWalkRows,
 			}
 			metricSets = append(metricSets, newMetricSet)
 		}
@@ -202,8 +360,110 @@ func parseCollection(c *collectionParser) ([]*collection, error) {
 			}
 			inventory = append(inventory, newInventoryItem)
 		}
-		col := collection{Device: dataSet.Device, MetricSets: metricSets, Inventory: inventory}
+
+		// Each collection walks only its own inventory tables
+		var inventoryTables []inventoryTable
+		for _, tableParser := range dataSet.InventoryTables {
+			newInventoryTable, err := parseInventoryTable(tableParser)
+			if err != nil {
+				return nil, err
+			}
+			inventoryTables = append(inventoryTables, newInventoryTable)
+		}
+		inventoryInterval, err := parseInterval(dataSet.InventoryInterval)
+		if err != nil {
+			return nil, fmt.Errorf("collection %s: %v", dataSet.Device, err)
+		}
+		col := collection{Device: dataSet.Device, Output: output, InventoryInterval: inventoryInterval, MetricSets: metricSets, Inventory: inventory, InventoryTables: inventoryTables}
 		cols = append(cols, &col)
 	}
 	return cols, nil
 }
+
+// parseInventoryTable validates an inventoryTableParser and converts it into an inventoryTable
+func parseInventoryTable(p inventoryTableParser) (inventoryTable, error) {
+	table := inventoryTable{
+		rootOid:  absoluteOid(p.RootOid),
+		category: strings.TrimSpace(p.Category),
+	}
+	if table.rootOid == "." {
+		return table, fmt.Errorf("inventory table is missing `root_oid`")
+	}
+	if table.category == "" {
+		return table, fmt.Errorf("inventory table %s is missing `category`", table.rootOid)
+	}
+	if len(p.Index) == 0 {
+		return table, fmt.Errorf("inventory table %s is missing `index`", table.rootOid)
+	}
+	for _, indexParser := range p.Index {
+		table.index = append(table.index, &index{
+			name: indexParser.Name,
+			oid:  absoluteOid(indexParser.Oid),
+		})
+	}
+	for _, field := range p.Fields {
+		table.fields = append(table.fields, &inventoryItem{
+			oid:      absoluteOid(field.Oid),
+			category: table.category,
+			name:     field.Name,
+		})
+	}
+	return table, nil
+}
+
+// absoluteOid trims an OID and forces a leading dot as required by gosnmp
+func absoluteOid(oid string) string {
+	oid = strings.TrimSpace(oid)
+	if !strings.HasPrefix(oid, ".") {
+		oid = "." + oid
+	}
+	return oid
+}
+
+// parseKeyValues parses a comma separated list of key=value pairs
+func parseKeyValues(list string) (map[string]string, error) {
+	values := make(map[string]string)
+	if strings.TrimSpace(list) == "" {
+		return values, nil
+	}
+	for _, pair := range strings.Split(list, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid pair %q, expected key=value", pair)
+		}
+		values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return values, nil
+}
+
+// parseDuration parses a positive duration option such as 500ms. An empty option is 0.
+func parseDuration(option, value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %s: %v", option, value, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s %s: it must be positive", option, value)
+	}
+	return d, nil
+}
+
+// parseInterval parses a polling interval such as 15s or 1h. An empty interval is 0.
+func parseInterval(interval string) (time.Duration, error) {
+	interval = strings.TrimSpace(interval)
+	if interval == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval %s: %v", interval, err)
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("invalid interval %s: the minimum interval is 1s", interval)
+	}
+	return d, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCollection_Attributes(t *testing.T) {
+	c, err := unmarshalCollection([]byte(`
+collect:
+- device: core
+  attributes:
+    site: ams1
+    environment: production
+  metric_sets:
+  - name: system
+    type: scalar
+    event_type: SNMPSample
+    attributes:
+      environment: staging
+      location: ${sysLocation}
+`))
+	assert.NoError(t, err)
+	collections, err := parseCollection(c)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"site":        "ams1",
+		"environment": "staging",
+		"location":    "${sysLocation}",
+	}, collections[0].MetricSets[0].Attributes)
+}
+
+func TestParseCollection_Intervals(t *testing.T) {
+	c, err := unmarshalCollection([]byte(`
+collect:
+- device: core
+  inventory_interval: 1h
+  metric_sets:
+  - name: interfaces
+    type: table
+    interval: 15s
+`))
+	assert.NoError(t, err)
+	collections, err := parseCollection(c)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, collections[0].InventoryInterval)
+	assert.Equal(t, 15*time.Second, collections[0].MetricSets[0].Interval)
+
+	c.Collect[0].MetricSets[0].Interval = "500ms"
+	_, err = parseCollection(c)
+	assert.Error(t, err)
+	c.Collect[0].MetricSets[0].Interval = "often"
+	_, err = parseCollection(c)
+	assert.Error(t, err)
+}
+
+func TestParseKeyValues(t *testing.T) {
+	values, err := parseKeyValues(" site=ams1, rack = r12 ,owner=netops=core")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"site": "ams1", "rack": "r12", "owner": "netops=core"}, values)
+
+	values, err = parseKeyValues("")
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+
+	_, err = parseKeyValues("site")
+	assert.Error(t, err)
+}
+
+func TestParseCollection_MaxOidsPerRequest(t *testing.T) {
+	c, err := unmarshalCollection([]byte(`
+collect:
+- device: core
+  metric_sets:
+  - name: system
+    type: scalar
+    event_type: SNMPSample
+    max_oids_per_request: 20
+`))
+	assert.NoError(t, err)
+	collections, err := parseCollection(c)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, collections[0].MetricSets[0].MaxOidsPerRequest)
+
+	c.Collect[0].MetricSets[0].MaxOidsPerRequest = -1
+	_, err = parseCollection(c)
+	assert.Error(t, err)
+}
+
+func TestParseCollection_RequestOverrides(t *testing.T) {
+	c, err := unmarshalCollection([]byte(`
+collect:
+- device: core
+  metric_sets:
+  - name: interfaces
+    type: table
+    event_type: SNMPInterfaceSample
+    root_oid: .1.3.6.1.2.1.2.2
+    timeout: 30s
+    retries: 0
+    max_walk_duration: 1m
+    max_walk_rows: 1000
+  - name: system
+    type: scalar
+    event_type: SNMPSample
+`))
+	assert.NoError(t, err)
+	collections, err := parseCollection(c)
+	assert.NoError(t, err)
+	interfaces := collections[0].MetricSets[0]
+	assert.Equal(t, 30*time.Second, interfaces.Timeout)
+	if assert.NotNil(t, interfaces.Retries) {
+		assert.Equal(t, 0, *interfaces.Retries)
+	}
+	assert.Equal(t, time.Minute, interfaces.MaxWalkDuration)
+	assert.Equal(t, 1000, interfaces.MaxWalkRows)
+	system := collections[0].MetricSets[1]
+	assert.Equal(t, time.Duration(0), system.Timeout)
+	assert.Nil(t, system.Retries)
+
+	c.Collect[0].MetricSets[0].Timeout = "-1s"
+	_, err = parseCollection(c)
+	assert.Error(t, err)
+
+	c.Collect[0].MetricSets[0].Timeout = ""
+	c.Collect[0].MetricSets[0].MaxWalkRows = -1
+	_, err = parseCollection(c)
+	assert.Error(t, err)
+}
@@ -0,0 +1,241 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/newrelic/infra-integrations-sdk/log"
+)
+
+const (
+	// configCheckInterval is how often the daemon checks the collection files for changes
+	configCheckInterval = 30 * time.Second
+	// defaultDaemonInterval is used when the interval argument is not valid
+	defaultDaemonInterval = 60 * time.Second
+)
+
+// scheduledJob is a unit of collection polled on its own interval
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	next     time.Time
+	run      func(sinks map[string]sink)
+}
+
+// schedule holds the jobs of the daemon mode
+type schedule struct {
+	jobs []*scheduledJob
+}
+
+// newSchedule creates one job per metric set and one per collection inventory,
+// plus the topology job when requested. All the jobs are due right away.
+func newSchedule(collections []*collection, defaultInterval time.Duration, topology bool, now time.Time) *schedule {
+	s := &schedule{}
+	add := func(name string, interval time.Duration, run func(sinks map[string]sink)) {
+		if interval == 0 {
+			interval = defaultInterval
+		}
+		s.jobs = append(s.jobs, &scheduledJob{name: name, interval: interval, next: now, run: run})
+	}
+
+	for _, c := range collections {
+		c := c
+		for _, ms := range c.MetricSets {
+			ms := ms
+			add(fmt.Sprintf("%s/%s", c.Device, ms.Name), ms.Interval, func(sinks map[string]sink) {
+				out, ok := sinks[c.Output]
+				if !ok {
+					log.Error("collection %s requests %s output which is not configured", c.Device, c.Output)
+					return
+				}
+				collectMetricSet(c.Device, ms, out.Writer())
+			})
+		}
+		if len(c.Inventory) > 0 || len(c.InventoryTables) > 0 {
+			add(c.Device+"/inventory", c.InventoryInterval, func(sinks map[string]sink) {
+				collectInventory(c, sinks[outputEvent].Writer())
+			})
+		}
+	}
+	if topology {
+		add("topology", 0, func(sinks map[string]sink) {
+			if err := populateTopology(sinks[outputEvent].Writer()); err != nil {
+				log.Error("unable to populate topology. %v", err)
+			}
+		})
+	}
+	return s
+}
+
+// due returns the jobs due at now and schedules their next run. Runs missed
+// while the daemon was busy are skipped rather than run in a burst.
+func (s *schedule) due(now time.Time) []*scheduledJob {
+	var due []*scheduledJob
+	for _, job := range s.jobs {
+		if job.next.After(now) {
+			continue
+		}
+		due = append(due, job)
+		for !job.next.After(now) {
+			job.next = job.next.Add(job.interval)
+		}
+	}
+	return due
+}
+
+// nextDue returns the time at which the next job is due
+func (s *schedule) nextDue() time.Time {
+	var next time.Time
+	for _, job := range s.jobs {
+		if next.IsZero() || job.next.Before(next) {
+			next = job.next
+		}
+	}
+	return next
+}
+
+// runDaemon polls each job on its own interval and publishes a payload every
+// time jobs fire. The collection files are reloaded when they change.
+func runDaemon(i *integration.Integration, collections []*collection) {
+	defaultInterval := time.Duration(args.Interval) * time.Second
+	if defaultInterval < time.Second {
+		log.Warn("invalid interval %d, using %s", args.Interval, defaultDaemonInterval)
+		defaultInterval = defaultDaemonInterval
+	}
+	s := newSchedule(collections, defaultInterval, args.Topology, time.Now())
+	version := configVersion()
+	deviceIdentity = baseIdentity()
+	refresh := &identityRefresh{interval: inventoryInterval(collections, defaultInterval)}
+	nextCheck := time.Now().Add(configCheckInterval)
+
+	for {
+		if due := s.due(time.Now()); len(due) > 0 {
+			runJobs(i, due, collections, refresh)
+		}
+
+		if !time.Now().Before(nextCheck) {
+			nextCheck = time.Now().Add(configCheckInterval)
+			if v := configVersion(); v != version {
+				reloaded, err := loadCollections()
+				if err != nil {
+					log.Error("unable to reload collection files, keeping the current ones. %v", err)
+				} else {
+					log.Info("collection files changed, reloading")
+					version, collections = v, reloaded
+					s = newSchedule(collections, defaultInterval, args.Topology, time.Now())
+					refresh.interval = inventoryInterval(collections, defaultInterval)
+				}
+			}
+		}
+
+		wake := s.nextDue()
+		if wake.IsZero() || nextCheck.Before(wake) {
+			wake = nextCheck
+		}
+		if wait := time.Until(wake); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
+
+// identityRefresh tracks when the daemon read the identity of the target, so
+// that a renamed or replaced device is picked up without a restart
+type identityRefresh struct {
+	// interval is how often the identity is read again
+	interval time.Duration
+	readAt   time.Time
+	// uptime is the last uptime read by the probe, nil until the target answers
+	uptime *sysUpTime
+}
+
+// due tells whether the identity is to be read: it was never read, it is older
+// than the interval or the uptime of the target went backwards since the last run
+func (r *identityRefresh) due(uptime *sysUpTime, now time.Time) bool {
+	if r.readAt.IsZero() || now.Sub(r.readAt) >= r.interval {
+		return true
+	}
+	return uptime != nil && r.uptime != nil && uptime.ticks < r.uptime.ticks
+}
+
+// inventoryInterval returns the shortest inventory interval of the collections
+func inventoryInterval(collections []*collection, defaultInterval time.Duration) time.Duration {
+	shortest := defaultInterval
+	for i, c := range collections {
+		interval := c.InventoryInterval
+		if interval == 0 {
+			interval = defaultInterval
+		}
+		if i == 0 || interval < shortest {
+			shortest = interval
+		}
+	}
+	return shortest
+}
+
+// runJobs probes the target, reads its identity when it answers and the
+// identity is due, runs the given jobs of the collections against a new device
+// entity and publishes the results
+func runJobs(i *integration.Integration, jobs []*scheduledJob, collections []*collection, refresh *identityRefresh) {
+	theStats = newCollectionStats()
+	now := time.Now()
+	status := checkTarget(now)
+	if status.reachable && refresh.due(status.uptime, now) {
+		log.Debug("reading the identity of target %s", targetHost)
+		deviceIdentity = resolveDeviceIdentity(identityReferences(collections))
+		refresh.readAt = now
+	}
+	if status.uptime != nil {
+		refresh.uptime = status.uptime
+	}
+	attributes, err := deviceAttributes(deviceIdentity)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	entity, err := newDeviceEntity(i, deviceIdentity)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	sinks, err := newSinks(i, entity, attributes)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	status.report(sinks[outputEvent].Writer())
+	for _, job := range jobs {
+		if status.breakerOpen {
+			log.Debug("skipping %s, the circuit breaker of target %s is open", job.name, targetHost)
+			continue
+		}
+		log.Debug("running %s", job.name)
+		job.run(sinks)
+	}
+	theStats.report(sinks[outputEvent].Writer())
+	publishSinks(sinks)
+	saveState()
+}
+
+// configVersion identifies the current content of the collection files by
+// their modification times and sizes
+func configVersion() string {
+	if args.CollectionFiles == "" {
+		return ""
+	}
+	var version []string
+	for _, collectionFile := range strings.Split(args.CollectionFiles, ",") {
+		info, err := os.Stat(collectionFile)
+		if err != nil {
+			version = append(version, collectionFile+":missing")
+			continue
+		}
+		version = append(version, fmt.Sprintf("%s:%d:%d", collectionFile, info.ModTime().UnixNano(), info.Size()))
+	}
+	return strings.Join(version, ",")
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	collections := []*collection{{
+		Device: "core",
+		MetricSets: []metricSet{
+			{Name: "interfaces", Interval: 15 * time.Second},
+			{Name: "system"},
+		},
+		Inventory:         []inventoryItem{{oid: ".1.3.6.1.2.1.1.1.0", category: "system", name: "sysDescr"}},
+		InventoryInterval: time.Hour,
+	}}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newSchedule(collections, time.Minute, true, start)
+
+	names := func(jobs []*scheduledJob) []string {
+		var names []string
+		for _, job := range jobs {
+			names = append(names, job.name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"core/interfaces", "core/system", "core/inventory", "topology"}, names(s.due(start)))
+	assert.Equal(t, start.Add(15*time.Second), s.nextDue())
+	assert.Empty(t, s.due(start.Add(10*time.Second)))
+	assert.Equal(t, []string{"core/interfaces"}, names(s.due(start.Add(15*time.Second))))
+	assert.Equal(t, []string{"core/interfaces", "core/system", "topology"}, names(s.due(start.Add(time.Minute))))
+
+	// Runs missed while busy are skipped
+	assert.Equal(t, []string{"core/interfaces", "core/system", "core/inventory", "topology"}, names(s.due(start.Add(2*time.Hour+time.Second))))
+	assert.Equal(t, start.Add(2*time.Hour+15*time.Second), s.nextDue())
+}
+
+func TestConfigVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nri-snmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snmp-metrics.yml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("collect: []\n"), 0644))
+
+	defer func(a argumentList) { args = a }(args)
+	args.CollectionFiles = path
+
+	version := configVersion()
+	assert.Equal(t, version, configVersion())
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	assert.NotEqual(t, version, configVersion())
+}
+
+// unreachableClient is a target that never answers
+type unreachableClient struct {
+	requests int
+}
+
+func (c *unreachableClient) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	c.requests++
+	return nil, errors.New("request timeout (after 0 retries)")
+}
+
+func (c *unreachableClient) GetBulk(oids []string, nonRepeaters uint8, maxRepetitions uint8) (*gosnmp.SnmpPacket, error) {
+	c.requests++
+	return nil, errors.New("request timeout (after 0 retries)")
+}
+
+func TestRunJobs_Identity(t *testing.T) {
+	defer restoreTarget()()
+	defer func(identity map[string]string) { deviceIdentity = identity }(deviceIdentity)
+	targetHost, targetPort = "192.0.2.10", 161
+	args.EntityName, args.EntityType, args.EntityIDAttributes, args.Attributes = "$sysName", "snmp-device", "", ""
+	i, err := integration.New("test", "0.0.0", integration.InMemoryStore(), integration.Writer(ioutil.Discard))
+	assert.NoError(t, err)
+	data := simulatedData(
+		octets(sysNameOid, []byte("edge-01")),
+		gosnmp.SnmpPDU{Name: sysUpTimeOid, Type: gosnmp.TimeTicks, Value: uint(8745123)},
+	)
+	defer simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public"}, simulatorConfig{}, data)()
+	reachable := theClient
+	deviceIdentity = baseIdentity()
+	refresh := &identityRefresh{interval: time.Hour}
+
+	// A target that doesn't answer is only probed
+	dead := &unreachableClient{}
+	theClient = dead
+	runJobs(i, nil, nil, refresh)
+	assert.Equal(t, 1, dead.requests)
+	assert.True(t, refresh.readAt.IsZero())
+	assert.Empty(t, deviceIdentity["sysName"])
+
+	// The identity is read once the target answers
+	theClient = reachable
+	runJobs(i, nil, nil, refresh)
+	assert.False(t, refresh.readAt.IsZero())
+	assert.Equal(t, "edge-01", deviceIdentity["sysName"])
+
+	// and again when the device restarts, e.g. after it was replaced
+	data.add(octets(sysNameOid, []byte("edge-02")))
+	runJobs(i, nil, nil, refresh)
+	assert.Equal(t, "edge-01", deviceIdentity["sysName"])
+	data.add(gosnmp.SnmpPDU{Name: sysUpTimeOid, Type: gosnmp.TimeTicks, Value: uint(500)})
+	runJobs(i, nil, nil, refresh)
+	assert.Equal(t, "edge-02", deviceIdentity["sysName"])
+}
+
+func TestIdentityRefresh(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	r := &identityRefresh{interval: time.Hour}
+	assert.True(t, r.due(nil, now))
+
+	r.readAt, r.uptime = now, &sysUpTime{ticks: 100000}
+	assert.False(t, r.due(&sysUpTime{ticks: 200000}, now.Add(time.Minute)))
+	assert.True(t, r.due(&sysUpTime{ticks: 500}, now.Add(time.Minute)))
+	assert.True(t, r.due(nil, now.Add(time.Hour)))
+}
+
+func TestInventoryInterval(t *testing.T) {
+	assert.Equal(t, time.Minute, inventoryInterval(nil, time.Minute))
+	assert.Equal(t, time.Minute, inventoryInterval([]*collection{{InventoryInterval: time.Hour}, {}}, time.Minute))
+	assert.Equal(t, 10*time.Minute, inventoryInterval([]*collection{{InventoryInterval: time.Hour}, {InventoryInterval: 10 * time.Minute}}, time.Minute))
+}
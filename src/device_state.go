@@ -0,0 +1,40 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+)
+
+// deviceStateTTL is how long the state learned about a device is kept without being updated
+const deviceStateTTL = 7 * 24 * time.Hour
+
+// theDeviceState keeps what is learned about the target between runs. It is
+// only kept in memory until the store file of the target is opened.
+var theDeviceState = persist.NewInMemoryStore()
+
+// openDeviceState opens the store file of the target
+func openDeviceState() (persist.Storer, error) {
+	name := invalidStoreNameChars.ReplaceAllString(fmt.Sprintf("nri-snmp-state-%s-%d", targetHost, targetPort), "_")
+	return persist.NewFileStore(persist.DefaultPath(name), log.NewStdErr(args.Verbose), deviceStateTTL)
+}
+
+// saveState persists the index cache, the state learned about the target and
+// the recording of the run so they are available to the next run, and moves
+// the replay on to the next recorded run
+func saveState() {
+	theIndexCache.save()
+	if theRepetitions.adaptive {
+		theDeviceState.Set(maxRepetitionsKey, theRepetitions.current)
+	}
+	if err := theDeviceState.Save(); err != nil {
+		log.Warn("unable to save the state of target %s. %v", targetHost, err)
+	}
+	saveRecording()
+	theReplay.advance()
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/newrelic/infra-integrations-sdk/data/inventory"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+)
+
+const (
+	// dimensionalProtocolVersion is the integrations protocol carrying dimensional metrics
+	dimensionalProtocolVersion = "4"
+	// dimensionalMetricPrefix is prepended to the name of every dimensional metric
+	dimensionalMetricPrefix = "snmp."
+	// collectionErrorMetric is reported instead of the metrics of a metric set that failed
+	collectionErrorMetric = dimensionalMetricPrefix + "collectionError"
+	// dimensionalCounterType is the type of the raw values of counter PDUs
+	dimensionalCounterType = "cumulative-count"
+)
+
+// dimensionalTypes maps the metric types of a collection file to dimensional metric types
+var dimensionalTypes = map[metric.SourceType]string{
+	metric.GAUGE:  "gauge",
+	metric.DELTA:  "cumulative-count",
+	metric.PDELTA: "cumulative-count",
+	metric.RATE:   "cumulative-rate",
+	metric.PRATE:  "cumulative-rate",
+}
+
+type dimensionalPayload struct {
+	ProtocolVersion string                 `json:"protocol_version"`
+	Integration     dimensionalIntegration `json:"integration"`
+	Data            []dimensionalData      `json:"data"`
+}
+
+type dimensionalIntegration struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// dimensionalData holds the metrics of a single entity
+type dimensionalData struct {
+	Common    dimensionalCommon    `json:"common"`
+	Entity    dimensionalEntity    `json:"entity"`
+	Metrics   []dimensionalMetric  `json:"metrics"`
+	Inventory *inventory.Inventory `json:"inventory"`
+	Events    []dimensionalEvent   `json:"events"`
+}
+
+type dimensionalCommon struct {
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type dimensionalEntity struct {
+	Name        string                 `json:"name"`
+	Type        string                 `json:"type"`
+	DisplayName string                 `json:"displayName"`
+	Metadata    map[string]interface{} `json:"metadata"`
+}
+
+type dimensionalMetric struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Attributes map[string]string `json:"attributes"`
+	Timestamp  int64             `json:"timestamp"`
+	Value      float64           `json:"value"`
+}
+
+// dimensionalEvent is a sample without metrics, such as a topology link
+type dimensionalEvent struct {
+	Timestamp  int64             `json:"timestamp"`
+	Summary    string            `json:"summary"`
+	Category   string            `json:"category"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// dimensionalSink writes the samples of a run as a protocol v4 payload of
+// dimensional metrics. Sample attributes become dimensions of their metrics.
+type dimensionalSink struct {
+	*sampleRecorder
+	out io.Writer
+}
+
+// Publish writes the recorded metrics and inventory as a single protocol v4
+// payload. Nothing is written when no collection requested dimensional output.
+func (s *dimensionalSink) Publish() error {
+	entities := s.reported()
+	if len(entities) == 0 {
+		return nil
+	}
+	payload := dimensionalPayload{
+		ProtocolVersion: dimensionalProtocolVersion,
+		Integration:     dimensionalIntegration{Name: integrationName, Version: integrationVersion},
+	}
+	for _, e := range entities {
+		payload.Data = append(payload.Data, newDimensionalData(e))
+	}
+	output, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "%s\n", output)
+	return err
+}
+
+func newDimensionalData(e *recordedEntity) dimensionalData {
+	data := dimensionalData{
+		Common: dimensionalCommon{Attributes: make(map[string]interface{})},
+		Entity: dimensionalEntity{
+			Name:        e.name,
+			Type:        e.entityType,
+			DisplayName: e.name,
+			Metadata:    make(map[string]interface{}),
+		},
+		Metrics:   []dimensionalMetric{},
+		Inventory: e.inventory,
+		Events:    []dimensionalEvent{},
+	}
+	for _, id := range e.idAttributes {
+		data.Entity.Metadata[id.Key] = id.Value
+	}
+	if e.parent != nil {
+		data.Common.Attributes[integration.AttrReportingEntity] = e.parent.key
+	}
+
+	// Every metric gets its own copy of the dimensions of its set
+	for _, set := range e.sets {
+		timestamp := set.timestamp.Unix()
+		switch {
+		case set.failed():
+			data.Metrics = append(data.Metrics, dimensionalMetric{
+				Name:       collectionErrorMetric,
+				Type:       dimensionalTypes[metric.GAUGE],
+				Attributes: copyDimensions(set.attributes),
+				Timestamp:  timestamp,
+				Value:      1,
+			})
+			continue
+		case len(set.metrics) == 0:
+			data.Events = append(data.Events, dimensionalEvent{
+				Timestamp:  timestamp,
+				Summary:    set.eventType,
+				Category:   set.eventType,
+				Attributes: copyDimensions(set.attributes),
+			})
+			continue
+		}
+		for _, m := range set.metrics {
+			metricType, ok := dimensionalTypes[m.sourceType]
+			if m.counter {
+				metricType = dimensionalCounterType
+			} else if !ok {
+				metricType = dimensionalTypes[metric.GAUGE]
+			}
+			data.Metrics = append(data.Metrics, dimensionalMetric{
+				Name:       dimensionalMetricPrefix + m.name,
+				Type:       metricType,
+				Attributes: copyDimensions(set.attributes),
+				Timestamp:  timestamp,
+				Value:      m.value,
+			})
+		}
+	}
+	return data
+}
+
+func copyDimensions(attributes map[string]string) map[string]string {
+	dimensions := make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		dimensions[k] = v
+	}
+	return dimensions
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDimensionalSink(t *testing.T) {
+	recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, []attribute.Attribute{attribute.Attr("targetAddress", "192.0.2.10:161")})
+	assert.NoError(t, err)
+	device := recorder.Writer()
+
+	ms := device.NewMetricSet("SNMPInterfaceSample",
+		attribute.Attr("device", "IF-MIB"),
+		attribute.Attr("name", "ifTable"),
+		attribute.Attr("index", "1"))
+	assert.NoError(t, createMetric("ifDescr", -1, gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte("Gi1/0/1")}, ms))
+	assert.NoError(t, createMetric("ifInOctets", metric.RATE, gosnmp.SnmpPDU{Type: gosnmp.Counter64, Value: uint64(1024)}, ms))
+	assert.NoError(t, createMetric("ifOperStatus", -1, gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 1}, ms))
+	assert.NoError(t, createMetric("ifInErrors", -1, gosnmp.SnmpPDU{Type: gosnmp.Counter32, Value: uint(7)}, ms))
+	assert.NoError(t, device.SetInventoryItem("system", "sysDescr", "Cisco IOS"))
+
+	row, err := device.RowWriter(&rowEntity{name: "${device}/${ifName}", entityType: "snmp-interface"}, "2", map[string]string{"ifName": "Gi1/0/2"})
+	assert.NoError(t, err)
+	rowSet := row.NewMetricSet("SNMPInterfaceSample", attribute.Attr("index", "2"))
+	assert.NoError(t, rowSet.SetMetric("ifOutErrors", big.NewInt(3), metric.DELTA))
+
+	failed := device.NewMetricSet("SNMPSample", attribute.Attr("name", "scalars"))
+	assert.NoError(t, failed.SetMetric("errorCode", "SNMPError", metric.ATTRIBUTE))
+
+	link := device.NewMetricSet(topologyEventType, attribute.Attr("protocol", "lldp"))
+	assert.NoError(t, link.SetMetric("remoteSystemName", "core-02", metric.ATTRIBUTE))
+
+	var buf bytes.Buffer
+	assert.NoError(t, (&dimensionalSink{sampleRecorder: recorder, out: &buf}).Publish())
+
+	var payload struct {
+		ProtocolVersion string `json:"protocol_version"`
+		Data            []struct {
+			Common struct {
+				Attributes map[string]string `json:"attributes"`
+			} `json:"common"`
+			Entity struct {
+				Name     string            `json:"name"`
+				Type     string            `json:"type"`
+				Metadata map[string]string `json:"metadata"`
+			} `json:"entity"`
+			Metrics []struct {
+				Name       string            `json:"name"`
+				Type       string            `json:"type"`
+				Attributes map[string]string `json:"attributes"`
+				Value      float64           `json:"value"`
+			} `json:"metrics"`
+			Inventory map[string]map[string]interface{} `json:"inventory"`
+			Events    []struct {
+				Category   string            `json:"category"`
+				Attributes map[string]string `json:"attributes"`
+			} `json:"events"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &payload))
+	assert.Equal(t, "4", payload.ProtocolVersion)
+	if len(payload.Data) != 2 {
+		t.Fatalf("expected 2 entities, got %d", len(payload.Data))
+	}
+
+	deviceData := payload.Data[0]
+	assert.Equal(t, "core-sw-01", deviceData.Entity.Name)
+	if len(deviceData.Metrics) != 4 {
+		t.Fatalf("expected 4 device metrics, got %d", len(deviceData.Metrics))
+	}
+	inOctets := deviceData.Metrics[0]
+	assert.Equal(t, "snmp.ifInOctets", inOctets.Name)
+	assert.Equal(t, "cumulative-rate", inOctets.Type)
+	assert.Equal(t, float64(1024), inOctets.Value)
+	// Attributes set after a metric still end up as its dimensions
+	assert.Equal(t, map[string]string{"targetAddress": "192.0.2.10:161", "device": "IF-MIB", "name": "ifTable", "index": "1", "ifDescr": "Gi1/0/1"}, inOctets.Attributes)
+	assert.Equal(t, "snmp.ifOperStatus", deviceData.Metrics[1].Name)
+	assert.Equal(t, "gauge", deviceData.Metrics[1].Type)
+	// Counters read with the auto type are cumulative
+	assert.Equal(t, "snmp.ifInErrors", deviceData.Metrics[2].Name)
+	assert.Equal(t, "cumulative-count", deviceData.Metrics[2].Type)
+	assert.Equal(t, collectionErrorMetric, deviceData.Metrics[3].Name)
+	assert.Equal(t, "SNMPError", deviceData.Metrics[3].Attributes["errorCode"])
+	assert.Equal(t, map[string]map[string]interface{}{"system": {"sysDescr": "Cisco IOS"}}, deviceData.Inventory)
+	// Samples without metrics are reported as events
+	if assert.Len(t, deviceData.Events, 1) {
+		assert.Equal(t, topologyEventType, deviceData.Events[0].Category)
+		assert.Equal(t, "core-02", deviceData.Events[0].Attributes["remoteSystemName"])
+	}
+
+	rowData := payload.Data[1]
+	assert.Equal(t, "core-sw-01/Gi1/0/2", rowData.Entity.Name)
+	assert.Equal(t, "snmp-interface", rowData.Entity.Type)
+	assert.Equal(t, map[string]string{"index": "2", "ifName": "Gi1/0/2"}, rowData.Entity.Metadata)
+	assert.Equal(t, "snmp-device:core-sw-01", rowData.Common.Attributes[integration.AttrReportingEntity])
+	assert.Equal(t, "192.0.2.10:161", rowData.Metrics[0].Attributes["targetAddress"])
+	assert.Equal(t, "cumulative-count", rowData.Metrics[0].Type)
+	assert.Equal(t, float64(3), rowData.Metrics[0].Value)
+}
+
+func TestDimensionalSink_DimensionsPerMetric(t *testing.T) {
+	recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, nil)
+	assert.NoError(t, err)
+	ms := recorder.Writer().NewMetricSet("SNMPSample", attribute.Attr("name", "system"))
+	assert.NoError(t, ms.SetMetric("a", 1, metric.GAUGE))
+	assert.NoError(t, ms.SetMetric("b", 2, metric.GAUGE))
+
+	data := newDimensionalData(recorder.reported()[0])
+	data.Metrics[0].Attributes["name"] = "changed"
+	assert.Equal(t, "system", data.Metrics[1].Attributes["name"])
+}
+
+func TestNewSinks_MixedOutputs(t *testing.T) {
+	defer simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public"}, simulatorConfig{}, simulatedData(
+		integer(".1.3.6.1.2.1.1.7.0", 72),
+		integer(".1.3.6.1.2.1.2.1.0", 2),
+	))()
+
+	var collections []*collection
+	for _, content := range []string{`collect:
+- device: core
+  metric_sets:
+  - name: system
+    type: scalar
+    event_type: SNMPSample
+    metrics:
+    - metric_name: sysServices
+      oid: .1.3.6.1.2.1.1.7.0
+`, `output: dimensional
+collect:
+- device: core
+  metric_sets:
+  - name: interfaces
+    type: scalar
+    event_type: SNMPSample
+    metrics:
+    - metric_name: ifNumber
+      oid: .1.3.6.1.2.1.2.1.0
+`} {
+		c, err := unmarshalCollection([]byte(content))
+		assert.NoError(t, err)
+		parsed, err := parseCollection(c)
+		assert.NoError(t, err)
+		collections = append(collections, parsed...)
+	}
+
+	var out bytes.Buffer
+	i, err := integration.New("test", "0.0.0", integration.InMemoryStore(), integration.Writer(&out))
+	assert.NoError(t, err)
+	entity, err := i.Entity("core-sw-01", "snmp-device")
+	assert.NoError(t, err)
+	sinks, err := newSinks(i, entity, nil)
+	assert.NoError(t, err)
+	sinks[outputDimensional].(*dimensionalSink).out = &out
+	runCollections(collections, sinks)
+	publishSinks(sinks)
+
+	// The event payload and the dimensional payload are written on their own lines
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 payloads, got %q", out.String())
+	}
+	var events struct {
+		ProtocolVersion string `json:"protocol_version"`
+		Data            []struct {
+			Metrics []map[string]interface{} `json:"metrics"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &events))
+	assert.Equal(t, "3", events.ProtocolVersion)
+	if assert.Len(t, events.Data, 1) && assert.Len(t, events.Data[0].Metrics, 1) {
+		assert.Equal(t, float64(72), events.Data[0].Metrics[0]["sysServices"])
+		assert.NotContains(t, events.Data[0].Metrics[0], "ifNumber")
+	}
+
+	var dimensional struct {
+		ProtocolVersion string `json:"protocol_version"`
+		Data            []struct {
+			Metrics []struct {
+				Name  string  `json:"name"`
+				Value float64 `json:"value"`
+			} `json:"metrics"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &dimensional))
+	assert.Equal(t, "4", dimensional.ProtocolVersion)
+	if assert.Len(t, dimensional.Data, 1) && assert.Len(t, dimensional.Data[0].Metrics, 1) {
+		assert.Equal(t, "snmp.ifNumber", dimensional.Data[0].Metrics[0].Name)
+		assert.Equal(t, float64(2), dimensional.Data[0].Metrics[0].Value)
+	}
+}
+
+func TestDimensionalSink_Empty(t *testing.T) {
+	recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, nil)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, (&dimensionalSink{sampleRecorder: recorder, out: &buf}).Publish())
+	assert.Empty(t, buf.String())
+}
+
+func TestParseCollection_Output(t *testing.T) {
+	c, err := unmarshalCollection([]byte("output: dimensional\ncollect:\n- device: test\n"))
+	assert.NoError(t, err)
+	collections, err := parseCollection(c)
+	assert.NoError(t, err)
+	assert.Equal(t, outputDimensional, collections[0].Output)
+
+	c.Output = ""
+	collections, err = parseCollection(c)
+	assert.NoError(t, err)
+	assert.Equal(t, outputEvent, collections[0].Output)
+
+	c.Output = "prometheus"
+	_, err = parseCollection(c)
+	assert.Error(t, err)
+}
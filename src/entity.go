@@ -0,0 +1,209 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/soniah/gosnmp"
+)
+
+const (
+	sysDescrOid    = ".1.3.6.1.2.1.1.1.0"
+	sysObjectIDOid = ".1.3.6.1.2.1.1.2.0"
+	sysContactOid  = ".1.3.6.1.2.1.1.4.0"
+	sysNameOid     = ".1.3.6.1.2.1.1.5.0"
+	sysLocationOid = ".1.3.6.1.2.1.1.6.0"
+)
+
+// identityOids are the system group scalars that can be referenced by name from
+// the entity name template, the entity ID attributes and custom attribute templates
+var identityOids = map[string]string{
+	sysDescrOid:    "sysDescr",
+	sysObjectIDOid: "sysObjectID",
+	sysContactOid:  "sysContact",
+	sysNameOid:     "sysName",
+	sysLocationOid: "sysLocation",
+}
+
+// baseIdentity returns the identity values of the target known without polling it
+func baseIdentity() map[string]string {
+	return map[string]string{
+		"host":  targetHost,
+		"port":  strconv.Itoa(targetPort),
+		"alias": strings.TrimSpace(args.Alias),
+	}
+}
+
+// identityReferences returns the names of the identity values referenced by
+// the entity name template, the entity ID attributes and the attribute
+// templates of the target and of the metric sets
+func identityReferences(collections []*collection) map[string]bool {
+	names := make(map[string]bool)
+	reference := func(template string) {
+		os.Expand(template, func(name string) string {
+			names[name] = true
+			return ""
+		})
+	}
+	reference(args.EntityName)
+	for _, key := range strings.Split(args.EntityIDAttributes, ",") {
+		names[strings.TrimSpace(key)] = true
+	}
+	if targetAttributes, err := parseKeyValues(args.Attributes); err == nil {
+		for _, template := range targetAttributes {
+			reference(template)
+		}
+	}
+	for _, c := range collections {
+		for _, metricSet := range c.MetricSets {
+			for _, template := range metricSet.Attributes {
+				reference(template)
+			}
+		}
+	}
+	return names
+}
+
+// resolveDeviceIdentity returns the values that identify the target device.
+// Only the system group scalars in references are read from the device, and
+// they are omitted when the device can't provide them.
+func resolveDeviceIdentity(references map[string]bool) map[string]string {
+	identity := baseIdentity()
+
+	var oids []string
+	for oid, name := range identityOids {
+		if references[name] {
+			oids = append(oids, oid)
+		}
+	}
+	sort.Strings(oids)
+	// The engine ID is only known once the first SNMPv3 request discovered it,
+	// sysUpTime is read to discover it when no system group value is referenced
+	_, v3 := theSNMP.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if v3 && references["engineID"] && len(oids) == 0 {
+		oids = []string{sysUpTimeOid}
+	}
+	if len(oids) > 0 {
+		readIdentity(oids, identity)
+	}
+
+	if usm, ok := theSNMP.SecurityParameters.(*gosnmp.UsmSecurityParameters); ok && usm.AuthoritativeEngineID != "" {
+		identity["engineID"] = hex.EncodeToString([]byte(usm.AuthoritativeEngineID))
+	}
+	return identity
+}
+
+// readIdentity reads the system group scalars among oids into identity
+func readIdentity(oids []string, identity map[string]string) {
+	snmpGetResult, err := theClient.Get(oids)
+	if err != nil {
+		log.Warn("unable to read device identity from target %s: %v", targetHost, err)
+		return
+	}
+	if snmpGetResult.Error != gosnmp.NoError {
+		log.Warn("unable to read device identity from target %s: %s", targetHost, getErrorMessage(snmpGetResult.Error))
+		return
+	}
+	for _, pdu := range snmpGetResult.Variables {
+		name, ok := identityOids[strings.TrimSpace(pdu.Name)]
+		if !ok {
+			continue
+		}
+		if value, err := extractIndexValue(pdu); err == nil && value != "" {
+			identity[name] = value
+		}
+	}
+}
+
+// newDeviceEntity creates the entity for the target device, named after the
+// entity_name template and identified by the configured ID attributes
+func newDeviceEntity(i *integration.Integration, identity map[string]string) (*integration.Entity, error) {
+	name := expandTemplate(args.EntityName, identity)
+	if strings.TrimSpace(name) == "" {
+		name = fmt.Sprintf("%s:%d", targetHost, targetPort)
+		log.Warn("entity name template %q expanded to an empty name, using %s", args.EntityName, name)
+	}
+
+	var idAttributes []integration.IDAttribute
+	if args.EntityIDAttributes != "" {
+		for _, key := range strings.Split(args.EntityIDAttributes, ",") {
+			key = strings.TrimSpace(key)
+			value, ok := identity[key]
+			if !ok || value == "" {
+				log.Warn("entity ID attribute %s is not available for target %s", key, targetHost)
+				continue
+			}
+			idAttributes = append(idAttributes, integration.NewIDAttribute(key, value))
+		}
+	}
+
+	return i.Entity(name, args.EntityType, idAttributes...)
+}
+
+// deviceAttributes returns the attributes added to every sample of the device,
+// sysName when it was read for the identity, followed by the custom attributes of the target expanded with the identity values
+func deviceAttributes(identity map[string]string) ([]attribute.Attribute, error) {
+	attributes := []attribute.Attribute{attribute.Attr("targetAddress", fmt.Sprintf("%s:%d", targetHost, targetPort))}
+	for _, key := range []string{"sysName", "alias"} {
+		if value := identity[key]; value != "" {
+			attributes = append(attributes, attribute.Attr(key, value))
+		}
+	}
+	targetAttributes, err := parseKeyValues(args.Attributes)
+	if err == nil {
+		err = checkAttributeNames(targetAttributes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid attributes: %v", err)
+	}
+	return append(attributes, expandAttributes(targetAttributes, identity)...), nil
+}
+
+// newRowEntity creates the entity for a single table row. The row is reported by
+// the device entity and identified by the values of the table index columns.
+func newRowEntity(i *integration.Integration, device *integration.Entity, def *rowEntity, indexKey string, indexValues map[string]string) (*integration.Entity, error) {
+	name, idAttributes, err := rowEntityIdentity(device.Metadata.Name, def, indexKey, indexValues)
+	if err != nil {
+		return nil, err
+	}
+	deviceKey, err := device.Key()
+	if err != nil {
+		return nil, err
+	}
+	return i.EntityReportedBy(deviceKey, name, def.entityType, idAttributes...)
+}
+
+// rowEntityIdentity returns the name and the ID attributes of the entity of a table row
+func rowEntityIdentity(deviceName string, def *rowEntity, indexKey string, indexValues map[string]string) (string, []integration.IDAttribute, error) {
+	values := map[string]string{
+		"device": deviceName,
+		"index":  indexKey,
+	}
+	names := make([]string, 0, len(indexValues))
+	for name, value := range indexValues {
+		values[name] = value
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	name := expandTemplate(def.name, values)
+	if strings.TrimSpace(name) == "" {
+		return "", nil, fmt.Errorf("entity name template %q expanded to an empty name for row %s", def.name, indexKey)
+	}
+
+	idAttributes := []integration.IDAttribute{integration.NewIDAttribute("index", indexKey)}
+	for _, n := range names {
+		idAttributes = append(idAttributes, integration.NewIDAttribute(n, indexValues[n]))
+	}
+	return name, idAttributes, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+// restoreTarget returns the function that restores the arguments and the
+// target changed by a test
+func restoreTarget() func() {
+	a, host, port := args, targetHost, targetPort
+	return func() {
+		args, targetHost, targetPort = a, host, port
+	}
+}
+
+func TestNewDeviceEntity(t *testing.T) {
+	defer restoreTarget()()
+	targetHost, targetPort = "192.0.2.10", 161
+	args.EntityName = "$sysName"
+	args.EntityType = "snmp-device"
+	args.EntityIDAttributes = "sysObjectID, engineID"
+
+	i, err := integration.New("test", "0.0.0", integration.InMemoryStore(), integration.Writer(ioutil.Discard))
+	assert.NoError(t, err)
+
+	identity := map[string]string{
+		"host":        "192.0.2.10",
+		"port":        "161",
+		"sysName":     "core-sw-01",
+		"sysObjectID": ".1.3.6.1.4.1.9.1.1227",
+	}
+	entity, err := newDeviceEntity(i, identity)
+	assert.NoError(t, err)
+	assert.Equal(t, "core-sw-01", entity.Metadata.Name)
+	assert.Equal(t, "snmp-device", entity.Metadata.Namespace)
+	assert.Equal(t, integration.IDAttributes{integration.NewIDAttribute("sysObjectID", ".1.3.6.1.4.1.9.1.1227")}, entity.Metadata.IDAttrs)
+
+	// The same device polled through another address lands on the same entity
+	identity["host"] = "198.51.100.10"
+	again, err := newDeviceEntity(i, identity)
+	assert.NoError(t, err)
+	assert.True(t, entity.SameAs(again))
+	assert.Len(t, i.Entities, 1)
+
+	// Fall back to host:port when the template expands to nothing
+	delete(identity, "sysName")
+	fallback, err := newDeviceEntity(i, identity)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.10:161", fallback.Metadata.Name)
+}
+
+func TestDeviceAttributes(t *testing.T) {
+	defer restoreTarget()()
+	targetHost, targetPort = "192.0.2.10", 161
+	args.Attributes = "site=ams1,location=${sysLocation}"
+
+	attributes, err := deviceAttributes(map[string]string{"sysName": "core-sw-01", "sysLocation": "Amsterdam DC1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []attribute.Attribute{
+		attribute.Attr("targetAddress", "192.0.2.10:161"),
+		attribute.Attr("sysName", "core-sw-01"),
+		attribute.Attr("location", "Amsterdam DC1"),
+		attribute.Attr("site", "ams1"),
+	}, attributes)
+
+	args.Attributes = "site"
+	_, err = deviceAttributes(nil)
+	assert.Error(t, err)
+}
+
+// identityClient records the GETs sent to resolve the identity
+type identityClient struct {
+	snmpClient
+	gets [][]string
+}
+
+func (c *identityClient) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	c.gets = append(c.gets, oids)
+	return c.snmpClient.Get(oids)
+}
+
+func TestResolveDeviceIdentity(t *testing.T) {
+	defer restoreTarget()()
+	targetHost, targetPort = "192.0.2.10", 161
+	defer simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public"}, simulatorConfig{}, simulatedData(
+		octets(sysDescrOid, []byte("Linux edge-01")),
+		octets(sysNameOid, []byte("edge-01")),
+		octets(sysLocationOid, []byte("Amsterdam DC1")),
+	))()
+	client := &identityClient{snmpClient: theClient}
+	theClient = client
+
+	// Nothing references the system group, the device is not polled for it
+	args.EntityName, args.EntityIDAttributes, args.Attributes = "${host}:${port}", "", "site=ams1"
+	identity := resolveDeviceIdentity(identityReferences(nil))
+	assert.Equal(t, map[string]string{"host": "192.0.2.10", "port": "161", "alias": ""}, identity)
+	assert.Empty(t, client.gets)
+
+	// Only the referenced values are read
+	args.EntityName, args.Attributes = "$sysName", "location=${sysLocation}"
+	identity = resolveDeviceIdentity(identityReferences([]*collection{{
+		MetricSets: []metricSet{{Attributes: map[string]string{"os": "$sysDescr"}}},
+	}}))
+	assert.Equal(t, [][]string{{sysDescrOid, sysNameOid, sysLocationOid}}, client.gets)
+	assert.Equal(t, "edge-01", identity["sysName"])
+	assert.Equal(t, "Amsterdam DC1", identity["sysLocation"])
+	assert.Equal(t, "Linux edge-01", identity["sysDescr"])
+}
+
+func TestResolveDeviceIdentity_EngineID(t *testing.T) {
+	defer restoreTarget()()
+	targetHost, targetPort = "192.0.2.10", 161
+	session := &gosnmp.GoSNMP{Version: gosnmp.Version3, SecurityModel: gosnmp.UserSecurityModel, MsgFlags: gosnmp.AuthNoPriv,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{UserName: "monitor", AuthenticationProtocol: gosnmp.SHA, AuthenticationPassphrase: "authpassword"}}
+	defer simulate(t, session, simulatorConfig{}, simulatedData(
+		octets(sysNameOid, []byte("edge-01")),
+		gosnmp.SnmpPDU{Name: sysUpTimeOid, Type: gosnmp.TimeTicks, Value: uint32(8745123)},
+	))()
+	client := &identityClient{snmpClient: theClient}
+	theClient = client
+	engineID := hex.EncodeToString([]byte(simulatorEngineID))
+
+	// The engine ID is not discovered yet, it is read after the identity GET
+	assert.Empty(t, session.SecurityParameters.(*gosnmp.UsmSecurityParameters).AuthoritativeEngineID)
+	args.EntityName, args.EntityIDAttributes, args.Attributes = "$sysName", "engineID", ""
+	identity := resolveDeviceIdentity(identityReferences(nil))
+	assert.Equal(t, "edge-01", identity["sysName"])
+	assert.Equal(t, engineID, identity["engineID"])
+	assert.Equal(t, [][]string{{sysNameOid}}, client.gets)
+}
+
+func TestResolveDeviceIdentity_OnlyEngineID(t *testing.T) {
+	defer restoreTarget()()
+	targetHost, targetPort = "192.0.2.10", 161
+	session := &gosnmp.GoSNMP{Version: gosnmp.Version3, SecurityModel: gosnmp.UserSecurityModel, MsgFlags: gosnmp.NoAuthNoPriv,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{UserName: "monitor"}}
+	defer simulate(t, session, simulatorConfig{}, simulatedData(
+		gosnmp.SnmpPDU{Name: sysUpTimeOid, Type: gosnmp.TimeTicks, Value: uint32(8745123)},
+	))()
+	client := &identityClient{snmpClient: theClient}
+	theClient = client
+
+	// A GET is sent to discover the engine ID when nothing else is read
+	args.EntityName, args.EntityIDAttributes, args.Attributes = "${host}", "", "engine=${engineID}"
+	identity := resolveDeviceIdentity(identityReferences(nil))
+	assert.Equal(t, hex.EncodeToString([]byte(simulatorEngineID)), identity["engineID"])
+	assert.Equal(t, [][]string{{sysUpTimeOid}}, client.gets)
+}
+
+func TestNewRowEntity(t *testing.T) {
+	i, err := integration.New("test", "0.0.0", integration.InMemoryStore(), integration.Writer(ioutil.Discard))
+	assert.NoError(t, err)
+	device, err := i.Entity("core-sw-01", "snmp-device")
+	assert.NoError(t, err)
+
+	def := &rowEntity{name: "${device}/${ifName}", entityType: "snmp-interface"}
+	row, err := newRowEntity(i, device, def, "10101", map[string]string{"ifName": "Gi1/0/1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "core-sw-01/Gi1/0/1", row.Metadata.Name)
+	assert.Equal(t, "snmp-interface", row.Metadata.Namespace)
+	assert.Equal(t, integration.IDAttributes{
+		integration.NewIDAttribute("index", "10101"),
+		integration.NewIDAttribute("ifName", "Gi1/0/1"),
+	}, row.Metadata.IDAttrs)
+
+	ms := row.NewMetricSet("SNMPInterfaceSample")
+	assert.Equal(t, "snmp-device:core-sw-01", ms.Metrics[integration.AttrReportingEntity])
+
+	_, err = newRowEntity(i, device, &rowEntity{name: "${ifAlias}", entityType: "snmp-interface"}, "1", nil)
+	assert.Error(t, err)
+}
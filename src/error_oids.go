@@ -3,9 +3,114 @@
 
 package main
 
-var knownErrorOids = map[string]string{
-	".1.3.6.1.6.3.15.1.1.3.0": "oidUsmStatsUnknownUserNames",
-	".1.3.6.1.6.3.15.1.1.4.0": "oidUsmStatsUnknownEngineIDs",
-	".1.3.6.1.6.3.15.1.1.5.0": "oidUsmStatsWrongDigests",
-	".1.3.6.1.6.3.15.1.1.6.0": "oidUsmStatsDecryptionErrors",
+import (
+	"fmt"
+	"strings"
+
+	"github.com/soniah/gosnmp"
+)
+
+// snmpReport describes an SNMPv3 report OID: the counter name, the error code
+// reported in the error samples and a hint on how to fix the configuration
+type snmpReport struct {
+	name string
+	code string
+	hint string
+}
+
+// OIDs of the USM statistics of RFC 3414, reported to the SNMPv3 requests an agent rejects
+const (
+	usmStatsUnsupportedSecLevels = ".1.3.6.1.6.3.15.1.1.1.0"
+	usmStatsNotInTimeWindows     = ".1.3.6.1.6.3.15.1.1.2.0"
+	usmStatsUnknownUserNames     = ".1.3.6.1.6.3.15.1.1.3.0"
+	usmStatsUnknownEngineIDs     = ".1.3.6.1.6.3.15.1.1.4.0"
+	usmStatsWrongDigests         = ".1.3.6.1.6.3.15.1.1.5.0"
+	usmStatsDecryptionErrors     = ".1.3.6.1.6.3.15.1.1.6.0"
+)
+
+var knownErrorOids = map[string]snmpReport{
+	usmStatsUnsupportedSecLevels: {
+		name: "usmStatsUnsupportedSecLevels",
+		code: "unsupportedSecurityLevel",
+		hint: "the user is not configured on the device for the requested security level, check SECURITY_LEVEL",
+	},
+	usmStatsNotInTimeWindows: {
+		name: "usmStatsNotInTimeWindows",
+		code: "notInTimeWindow",
+		hint: "the engine boots and time of the request are out of the device time window, usually after a restart of the device. If it persists, check for devices sharing the same engine ID",
+	},
+	usmStatsUnknownUserNames: {
+		name: "usmStatsUnknownUserNames",
+		code: errorClassUnknownUserName,
+		hint: "the user is not configured on the device, check USERNAME",
+	},
+	usmStatsUnknownEngineIDs: {
+		name: "usmStatsUnknownEngineIDs",
+		code: errorClassUnknownEngineID,
+		hint: "the engine ID of the request is not known to the device, check for devices sharing the same address or engine ID",
+	},
+	usmStatsWrongDigests: {
+		name: "usmStatsWrongDigests",
+		code: errorClassWrongDigest,
+		hint: "the authentication digest doesn't match, check AUTH_PROTOCOL and AUTH_PASSPHRASE",
+	},
+	usmStatsDecryptionErrors: {
+		name: "usmStatsDecryptionErrors",
+		code: errorClassDecryption,
+		hint: "the device can't decrypt the request, check PRIV_PROTOCOL and PRIV_PASSPHRASE",
+	},
+	".1.3.6.1.6.3.12.1.4.0": {
+		name: "snmpUnavailableContexts",
+		code: "unavailableContext",
+		hint: "the context of the request is known to the device but currently unavailable",
+	},
+	".1.3.6.1.6.3.12.1.5.0": {
+		name: "snmpUnknownContexts",
+		code: "unknownContext",
+		hint: "the context of the request is not known to the device, check the context configured for the user on the device",
+	},
+	".1.3.6.1.6.3.11.2.1.1.0": {
+		name: "snmpUnknownSecurityModels",
+		code: "unknownSecurityModel",
+		hint: "the device doesn't support the security model of the request, check that SNMPv3 is enabled on the device",
+	},
+	".1.3.6.1.6.3.11.2.1.2.0": {
+		name: "snmpInvalidMsgs",
+		code: "invalidMessage",
+		hint: "the device considers the request invalid, check SECURITY_LEVEL",
+	},
+	".1.3.6.1.6.3.11.2.1.3.0": {
+		name: "snmpUnknownPDUHandlers",
+		code: "unknownPDUHandler",
+		hint: "the device has no handler for the request",
+	},
+}
+
+// snmpReportError is returned when the device answers a request with an SNMPv3 report
+type snmpReportError struct {
+	oid    string
+	report snmpReport
+}
+
+func (e *snmpReportError) Error() string {
+	return e.message() + ": " + e.report.hint
+}
+
+// message describes the report without the hint
+func (e *snmpReportError) message() string {
+	return fmt.Sprintf("%s reported by target %s", e.report.name, targetHost)
+}
+
+// checkReport returns an snmpReportError when a response is an SNMPv3 report
+func checkReport(result *gosnmp.SnmpPacket) error {
+	if result.PDUType != gosnmp.Report {
+		return nil
+	}
+	for _, pdu := range result.Variables {
+		oid := strings.TrimSpace(pdu.Name)
+		if report, ok := knownErrorOids[oid]; ok {
+			return &snmpReportError{oid: oid, report: report}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,57 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+// reportingAgent answers every request with an SNMPv3 report
+type reportingAgent struct {
+	oid string
+}
+
+func (a reportingAgent) report() *gosnmp.SnmpPacket {
+	return &gosnmp.SnmpPacket{PDUType: gosnmp.Report, Variables: []gosnmp.SnmpPDU{{Name: a.oid, Type: gosnmp.Counter32, Value: uint(1)}}}
+}
+
+func (a reportingAgent) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	return a.report(), nil
+}
+
+func (a reportingAgent) GetBulk(oids []string, nonRepeaters uint8, maxRepetitions uint8) (*gosnmp.SnmpPacket, error) {
+	return a.report(), nil
+}
+
+func TestCheckReport(t *testing.T) {
+	// Polling the usmStats counters is not an error
+	response := &gosnmp.SnmpPacket{PDUType: gosnmp.GetResponse, Variables: []gosnmp.SnmpPDU{{Name: ".1.3.6.1.6.3.15.1.1.5.0", Type: gosnmp.Counter32}}}
+	assert.NoError(t, checkReport(response))
+
+	response.PDUType = gosnmp.Report
+	err := checkReport(response)
+	if assert.IsType(t, &snmpReportError{}, err) {
+		assert.Equal(t, "wrongDigest", err.(*snmpReportError).report.code)
+	}
+}
+
+func TestReportedErrors(t *testing.T) {
+	agent := reportingAgent{oid: ".1.3.6.1.6.3.12.1.5.0"}
+
+	err := walkSubtree(agent, newRepetitionTuner(10, false, 0), nil, ".1.3.6.1.2.1.2.2", func(gosnmp.SnmpPDU) error { return nil })
+	assert.IsType(t, &snmpReportError{}, err)
+	_, _, err = getChunked(agent.Get, []string{sysUpTimeOid}, 10)
+	assert.IsType(t, &snmpReportError{}, err)
+
+	recorder, recorderErr := newSampleRecorder("core-sw-01", "snmp-device", nil, nil)
+	assert.NoError(t, recorderErr)
+	reportError("IF-MIB", metricSet{Name: "ifTable", EventType: "SNMPInterfaceSample"}, recorder.Writer(), err)
+	attributes := recorder.reported()[0].sets[0].attributes
+	assert.Equal(t, "unknownContext", attributes["errorCode"])
+	assert.Equal(t, "snmpUnknownContexts reported by target "+targetHost, attributes["errorMessage"])
+	assert.Equal(t, knownErrorOids[".1.3.6.1.6.3.12.1.5.0"].hint, attributes["errorHint"])
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/soniah/gosnmp"
+)
+
+// theExplain records what the metric sets collect in dry-run mode, nil otherwise
+var theExplain *explainer
+
+// explainer gathers one line per OID collected, skipped or failed
+type explainer struct {
+	metricSet string
+	// sets counts the metric sets run so far, to keep their lines in order
+	sets  int
+	lines []explainLine
+}
+
+type explainLine struct {
+	set        int
+	metricSet  string
+	oid        string
+	pduType    string
+	value      string
+	metricName string
+	sourceType string
+	note       string
+}
+
+// explainedMetric records the value and source type createMetric chose for a PDU
+type explainedMetric struct {
+	setter     metricSetter
+	set        bool
+	value      interface{}
+	sourceType metric.SourceType
+}
+
+func (m *explainedMetric) SetMetric(name string, value interface{}, sourceType metric.SourceType) error {
+	m.set, m.value, m.sourceType = true, value, sourceType
+	return m.setter.SetMetric(name, value, sourceType)
+}
+
+func (m *explainedMetric) SetCounter(name string, value interface{}) error {
+	m.set, m.value, m.sourceType = true, value, metric.GAUGE
+	return setCounter(m.setter, name, value)
+}
+
+// metric records a PDU and the metric createMetric made of it
+func (e *explainer) metric(metricName string, pdu gosnmp.SnmpPDU, m *explainedMetric, err error) {
+	if e == nil {
+		return
+	}
+	line := explainLine{
+		set:        e.sets,
+		metricSet:  e.metricSet,
+		oid:        strings.TrimSpace(pdu.Name),
+		pduType:    pdu.Type.String(),
+		value:      formatPDUValue(pdu),
+		metricName: metricName,
+	}
+	if m.set {
+		line.sourceType = m.sourceType.String()
+	}
+	if err != nil {
+		line.note = err.Error()
+	}
+	e.lines = append(e.lines, line)
+}
+
+// skip records an OID that produced no metric
+func (e *explainer) skip(oid, reason string) {
+	if e == nil {
+		return
+	}
+	e.lines = append(e.lines, explainLine{set: e.sets, metricSet: e.metricSet, oid: strings.TrimSpace(oid), note: reason})
+}
+
+// fail records a metric set that failed as a whole
+func (e *explainer) fail(err error) {
+	if e == nil {
+		return
+	}
+	e.lines = append(e.lines, explainLine{set: e.sets, metricSet: e.metricSet, note: "failed: " + err.Error()})
+}
+
+// print writes the lines as a table, those of each metric set sorted by OID
+// and followed by its failure, if any
+func (e *explainer) print(out io.Writer) error {
+	sort.SliceStable(e.lines, func(i, j int) bool {
+		a, b := e.lines[i], e.lines[j]
+		if a.set != b.set {
+			return a.set < b.set
+		}
+		if a.oid == "" || b.oid == "" {
+			return b.oid == "" && a.oid != ""
+		}
+		return oidLess(a.oid, b.oid)
+	})
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "METRIC SET\tOID\tPDU TYPE\tVALUE\tMETRIC\tSOURCE TYPE\tNOTE")
+	for _, l := range e.lines {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", l.metricSet, dash(l.oid), dash(l.pduType), dash(l.value), dash(l.metricName), dash(l.sourceType), l.note)
+	}
+	return w.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatPDUValue renders the raw value of a PDU, strings quoted
+func formatPDUValue(pdu gosnmp.SnmpPDU) string {
+	switch v := pdu.Value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// runExplain runs the metric sets of the collections without publishing them
+// and prints what was collected, skipped or failed to out
+func runExplain(collections []*collection, out io.Writer) error {
+	theExplain = &explainer{}
+	defer func() { theExplain = nil }()
+	for _, c := range collections {
+		for _, ms := range c.MetricSets {
+			theExplain.metricSet = ms.Name
+			theExplain.sets++
+			collectMetricSet(c.Device, ms, discardWriter{})
+		}
+	}
+	return theExplain.print(out)
+}
+
+// discardWriter drops the samples of a dry run
+type discardWriter struct{}
+
+func (discardWriter) NewMetricSet(eventType string, attributes ...attribute.Attribute) metricSetter {
+	return discardSet{}
+}
+
+func (w discardWriter) RowWriter(def *rowEntity, indexKey string, indexValues map[string]string) (sampleWriter, error) {
+	return w, nil
+}
+
+func (discardWriter) SetInventoryItem(category, name string, value interface{}) error {
+	return nil
+}
+
+type discardSet struct{}
+
+func (discardSet) SetMetric(name string, value interface{}, sourceType metric.SourceType) error {
+	return nil
+}
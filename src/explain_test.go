@@ -0,0 +1,67 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunExplain(t *testing.T) {
+	defer func(snmp *gosnmp.GoSNMP, client snmpClient, store persist.Storer) {
+		theSNMP, theClient, theDeviceState = snmp, client, store
+	}(theSNMP, theClient, theDeviceState)
+	theSNMP = &gosnmp.GoSNMP{MaxOids: 1}
+	theDeviceState = persist.NewInMemoryStore()
+	theClient = newFakeAgent(50,
+		octets(".1.3.6.1.2.1.1.5.0", []byte("core-1")),
+		integer(".1.3.6.1.2.1.1.7.0", 72),
+		octets(".1.3.6.1.2.1.2.2.1.2.1", []byte("eth0")),
+		octets(".1.3.6.1.2.1.2.2.1.2.2", []byte("eth1")),
+		integer(".1.3.6.1.2.1.2.2.1.10.1", 1000))
+
+	collections := []*collection{{
+		Device: "core",
+		MetricSets: []metricSet{
+			{
+				Name: "system", Type: "scalar", EventType: "SNMPSample",
+				Metrics: []*metricDef{
+					{oid: ".1.3.6.1.2.1.1.5.0", metricName: "sysName", metricType: -1},
+					{oid: ".1.3.6.1.2.1.1.7.0", metricName: "sysServices", metricType: metric.ATTRIBUTE},
+					{oid: ".1.3.6.1.2.1.1.9.0", metricName: "sysORID", metricType: -1},
+				},
+			},
+			{
+				Name: "interfaces", Type: "table", EventType: "SNMPInterfaceSample", RootOid: ".1.3.6.1.2.1.2.2",
+				Index:   []*index{{oid: ".1.3.6.1.2.1.2.2.1.2", name: "ifDescr"}},
+				Metrics: []*metricDef{{oid: ".1.3.6.1.2.1.2.2.1.10", metricName: "ifInOctets", metricType: metric.RATE}},
+			},
+			{Name: "broken", Type: "table", EventType: "SNMPSample", RootOid: ".1.3.6.1.2.1.4"},
+		},
+	}}
+
+	var out bytes.Buffer
+	assert.NoError(t, runExplain(collections, &out))
+	assert.Nil(t, theExplain)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	fields := make([][]string, len(lines))
+	for i, line := range lines {
+		fields[i] = strings.Fields(line)
+	}
+	assert.Equal(t, []string{"METRIC", "SET", "OID", "PDU", "TYPE", "VALUE", "METRIC", "SOURCE", "TYPE", "NOTE"}, fields[0])
+	assert.Equal(t, []string{"system", ".1.3.6.1.2.1.1.5.0", "OctetString", `"core-1"`, "sysName", "attribute"}, fields[1])
+	assert.Equal(t, []string{"system", ".1.3.6.1.2.1.1.7.0", "Integer", "72", "sysServices", "attribute"}, fields[2])
+	assert.Equal(t, []string{"system", ".1.3.6.1.2.1.1.9.0", "-", "-", "-", "-", "not", "supported", "by", "target:", "NoSuchObject"}, fields[3])
+	assert.Equal(t, []string{"interfaces", ".1.3.6.1.2.1.2.2.1.10.1", "Integer", "1000", "ifInOctets", "rate"}, fields[4])
+	assert.Equal(t, []string{"interfaces", ".1.3.6.1.2.1.2.2.1.10.2", "-", "-", "-", "-", "no", "data"}, fields[5])
+	assert.Equal(t, "broken", fields[6][0])
+	assert.Contains(t, lines[6], "failed: Table index not specified")
+}
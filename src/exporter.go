@@ -0,0 +1,230 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/newrelic/infra-integrations-sdk/log"
+)
+
+const (
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	// openMetricsPrefix is prepended to the name of every exported metric family
+	openMetricsPrefix = "snmp_"
+	// openMetricsErrorFamily is reported instead of the metrics of a metric set that failed
+	openMetricsErrorFamily = openMetricsPrefix + "collection_error"
+
+	// exporterReadHeaderTimeout bounds the time a scraper takes to send its request headers
+	exporterReadHeaderTimeout = 10 * time.Second
+	// exporterWriteTimeout bounds a scrape, including the polling of the device
+	exporterWriteTimeout = 5 * time.Minute
+)
+
+var invalidOpenMetricsChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// exporter serves the metric sets of the configured collections as OpenMetrics text
+type exporter struct {
+	// collect polls the device and writes the samples into writer
+	collect    func(writer sampleWriter)
+	entityName string
+	entityType string
+	attributes []attribute.Attribute
+	cacheTTL   time.Duration
+
+	mu       sync.Mutex
+	cached   []byte
+	cachedAt time.Time
+}
+
+// openMetricsSink renders the recorded samples as OpenMetrics text into out
+type openMetricsSink struct {
+	*sampleRecorder
+	out io.Writer
+}
+
+func (s *openMetricsSink) Publish() error {
+	return renderOpenMetrics(s.sampleRecorder, s.out)
+}
+
+type openMetricsFamily struct {
+	name       string
+	familyType string
+	lines      []string
+}
+
+func newExporter(collections []*collection, entity *integration.Entity, attributes []attribute.Attribute, cacheTTL time.Duration) *exporter {
+	return &exporter{
+		collect: func(writer sampleWriter) {
+			status := checkTarget(time.Now())
+			status.report(writer)
+			if status.breakerOpen {
+				return
+			}
+			for _, collection := range collections {
+				collectMetricSets(collection, writer)
+			}
+		},
+		entityName: entity.Metadata.Name,
+		entityType: entity.Metadata.Namespace,
+		attributes: attributes,
+		cacheTTL:   cacheTTL,
+	}
+}
+
+// runExporter serves the exporter on /metrics until the server fails
+func runExporter(address string, e *exporter) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: exporterReadHeaderTimeout,
+		WriteTimeout:      exporterWriteTimeout,
+	}
+	log.Info("serving OpenMetrics on %s/metrics", address)
+	return server.ListenAndServe()
+}
+
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", openMetricsContentType)
+	if _, err := w.Write(e.scrape()); err != nil {
+		log.Debug("unable to write scrape response: %v", err)
+	}
+}
+
+// scrape polls the device unless the last result is younger than the cache TTL.
+// Scrapes are serialized as they share the SNMP connection.
+func (e *exporter) scrape() []byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cached != nil && time.Since(e.cachedAt) < e.cacheTTL {
+		return e.cached
+	}
+
+	var buf bytes.Buffer
+	recorder, err := newSampleRecorder(e.entityName, e.entityType, nil, e.attributes)
+	if err != nil {
+		log.Error(err.Error())
+		return nil
+	}
+	sink := &openMetricsSink{sampleRecorder: recorder, out: &buf}
+	theStats = newCollectionStats()
+	e.collect(sink.Writer())
+	theStats.report(sink.Writer())
+	saveState()
+	if err := sink.Publish(); err != nil {
+		log.Error("unable to render scrape: %v", err)
+	}
+	e.cached, e.cachedAt = buf.Bytes(), time.Now()
+	return e.cached
+}
+
+// renderOpenMetrics writes the recorded samples in the OpenMetrics text format.
+// Entity and sample attributes become labels, the samples of table row entities
+// are labelled with the entity name. Gauges are exported as gauges, counters
+// read with the auto type and delta and rate metrics as counters with a _total
+// series.
+func renderOpenMetrics(r *sampleRecorder, w io.Writer) error {
+	var families []*openMetricsFamily
+	byName := make(map[string]*openMetricsFamily)
+	add := func(name, familyType string, labels map[string]string, value float64) {
+		family, ok := byName[name]
+		if !ok {
+			family = &openMetricsFamily{name: name, familyType: familyType}
+			byName[name] = family
+			families = append(families, family)
+		} else if family.familyType != familyType {
+			log.Warn("metric %s is reported both as %s and %s, dropping the %s series", name, family.familyType, familyType, familyType)
+			return
+		}
+		series := name
+		if familyType == "counter" {
+			series += "_total"
+		}
+		family.lines = append(family.lines, series+formatLabels(labels)+" "+strconv.FormatFloat(value, 'g', -1, 64))
+	}
+
+	for _, e := range r.reported() {
+		entityLabels := make(map[string]string)
+		if e.parent != nil {
+			entityLabels["entity"] = e.name
+		}
+		for _, set := range e.sets {
+			labels := make(map[string]string, len(entityLabels)+len(set.attributes))
+			for k, v := range entityLabels {
+				labels[k] = v
+			}
+			for k, v := range set.attributes {
+				labels[k] = v
+			}
+			if set.failed() {
+				add(openMetricsErrorFamily, "gauge", labels, 1)
+				continue
+			}
+			for _, m := range set.metrics {
+				name := openMetricsName(m.name)
+				switch {
+				case m.counter, m.sourceType == metric.DELTA, m.sourceType == metric.PDELTA, m.sourceType == metric.RATE, m.sourceType == metric.PRATE:
+					add(strings.TrimSuffix(name, "_total"), "counter", labels, m.value)
+				default:
+					add(name, "gauge", labels, m.value)
+				}
+			}
+		}
+	}
+
+	for _, family := range families {
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n%s\n", family.name, family.familyType, strings.Join(family.lines, "\n")); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "# EOF\n")
+	return err
+}
+
+// openMetricsName converts a metric name of a collection file into a metric family name
+func openMetricsName(name string) string {
+	return openMetricsPrefix + invalidOpenMetricsChars.ReplaceAllString(name, "_")
+}
+
+// formatLabels renders a label set sorted by label name
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		labelName := invalidOpenMetricsChars.ReplaceAllString(name, "_")
+		if labelName == "" || (labelName[0] >= '0' && labelName[0] <= '9') {
+			labelName = "_" + labelName
+		}
+		pairs = append(pairs, labelName+`="`+escapeLabelValue(labels[name])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExporter(t *testing.T) {
+	polls := 0
+	e := &exporter{
+		collect: func(writer sampleWriter) {
+			polls++
+			ms := writer.NewMetricSet("SNMPInterfaceSample",
+				attribute.Attr("device", "IF-MIB"),
+				attribute.Attr("index", "1"))
+			assert.NoError(t, createMetric("ifDescr", -1, gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte(`Gi1/0/1 "uplink"`)}, ms))
+			assert.NoError(t, createMetric("ifInOctets", metric.RATE, gosnmp.SnmpPDU{Type: gosnmp.Counter64, Value: uint64(1024)}, ms))
+			assert.NoError(t, createMetric("ifOperStatus", -1, gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 1}, ms))
+			assert.NoError(t, createMetric("ifInErrors", -1, gosnmp.SnmpPDU{Type: gosnmp.Counter32, Value: uint(7)}, ms))
+
+			row, err := writer.RowWriter(&rowEntity{name: "${device}/${ifName}", entityType: "snmp-interface"}, "2", map[string]string{"ifName": "Gi1/0/2"})
+			assert.NoError(t, err)
+			rowSet := row.NewMetricSet("SNMPInterfaceSample", attribute.Attr("index", "2"))
+			assert.NoError(t, rowSet.SetMetric("ifInOctets", 2048, metric.DELTA))
+
+			failed := writer.NewMetricSet("SNMPSample", attribute.Attr("name", "scalars"))
+			assert.NoError(t, failed.SetMetric("errorCode", "SNMPError", metric.ATTRIBUTE))
+		},
+		entityName: "core-sw-01",
+		entityType: "snmp-device",
+		attributes: []attribute.Attribute{attribute.Attr("targetAddress", "192.0.2.10:161")},
+		cacheTTL:   time.Minute,
+	}
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	response, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, openMetricsContentType, response.Header.Get("Content-Type"))
+	// The collected samples are followed by the self-telemetry of the scrape
+	assert.True(t, strings.HasPrefix(string(body), `# TYPE snmp_ifInOctets counter
+snmp_ifInOctets_total{device="IF-MIB",ifDescr="Gi1/0/1 \"uplink\"",index="1",targetAddress="192.0.2.10:161"} 1024
+snmp_ifInOctets_total{entity="core-sw-01/Gi1/0/2",index="2",targetAddress="192.0.2.10:161"} 2048
+# TYPE snmp_ifOperStatus gauge
+snmp_ifOperStatus{device="IF-MIB",ifDescr="Gi1/0/1 \"uplink\"",index="1",targetAddress="192.0.2.10:161"} 1
+# TYPE snmp_ifInErrors counter
+snmp_ifInErrors_total{device="IF-MIB",ifDescr="Gi1/0/1 \"uplink\"",index="1",targetAddress="192.0.2.10:161"} 7
+# TYPE snmp_collection_error gauge
+snmp_collection_error{errorCode="SNMPError",name="scalars",targetAddress="192.0.2.10:161"} 1
+`), string(body))
+	assert.Contains(t, string(body), `snmp_requests{scope="target",targetAddress="192.0.2.10:161"} 0`)
+	assert.True(t, strings.HasSuffix(string(body), "# EOF\n"))
+
+	// Scrapes within the cache TTL don't poll the device again
+	e.scrape()
+	assert.Equal(t, 1, polls)
+	e.cacheTTL = 0
+	e.scrape()
+	assert.Equal(t, 2, polls)
+}
+
+func TestOpenMetricsRender_TypeConflict(t *testing.T) {
+	recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, nil)
+	assert.NoError(t, err)
+	writer := recorder.Writer()
+	assert.NoError(t, writer.NewMetricSet("A").SetMetric("value", 1, metric.GAUGE))
+	assert.NoError(t, writer.NewMetricSet("B").SetMetric("value", 2, metric.RATE))
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	var buf bytes.Buffer
+	assert.NoError(t, (&openMetricsSink{sampleRecorder: recorder, out: &buf}).Publish())
+	assert.Equal(t, "# TYPE snmp_value gauge\nsnmp_value 1\n# EOF\n", buf.String())
+	// The dropped series is logged
+	assert.Contains(t, logs.String(), "[WARN] metric snmp_value is reported both as gauge and counter, dropping the counter series")
+}
@@ -0,0 +1,441 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/soniah/gosnmp"
+)
+
+// generatedMetric is a metric or an index of a generated metric set
+type generatedMetric struct {
+	name       string
+	oid        string
+	metricType string
+}
+
+// generatedSet is a metric set detected in a walk
+type generatedSet struct {
+	name      string
+	eventType string
+	table     bool
+	rootOid   string
+	index     []generatedMetric
+	metrics   []generatedMetric
+}
+
+// knownObject is the naming of an OID in the bundled profiles
+type knownObject struct {
+	name       string
+	metricType string
+}
+
+// generator turns the PDUs of a walk into draft metric sets. The names come
+// from the bundled profiles, then from the loaded MIBs, then from the OIDs.
+type generator struct {
+	pdus    map[string]gosnmp.SnmpPDU
+	mibs    *mibTree
+	known   map[string]knownObject
+	tables  map[string]generatedSet
+	scalars generatedSet
+	sets    []generatedSet
+	// skipped lists the OIDs left out of the draft with the reason
+	skipped []string
+}
+
+func newGenerator(pdus map[string]gosnmp.SnmpPDU, mibs *mibTree) *generator {
+	g := &generator{
+		pdus:   pdus,
+		mibs:   mibs,
+		known:  make(map[string]knownObject),
+		tables: make(map[string]generatedSet),
+	}
+	for _, name := range profileNames() {
+		c, err := unmarshalCollection([]byte(bundledProfiles[name]))
+		if err != nil {
+			continue
+		}
+		for _, dataSet := range c.Collect {
+			for _, ms := range dataSet.MetricSets {
+				if ms.Type == "table" {
+					set := generatedSet{name: ms.Name, eventType: ms.EventType}
+					for _, i := range ms.Index {
+						set.index = append(set.index, generatedMetric{name: i.Name, oid: absoluteOid(i.Oid)})
+					}
+					g.tables[absoluteOid(ms.RootOid)] = set
+				}
+				for _, m := range ms.Metrics {
+					g.known[absoluteOid(m.Oid)] = knownObject{name: m.MetricName, metricType: m.MetricType}
+				}
+			}
+		}
+	}
+	return g
+}
+
+// run classifies the OIDs under rootOid into a scalar metric set and tables
+func (g *generator) run(rootOid string) []generatedSet {
+	rootOid = absoluteOid(rootOid)
+	var oids []string
+	for oid := range g.pdus {
+		if oid == rootOid || strings.HasPrefix(oid, rootOid+".") {
+			oids = append(oids, oid)
+		}
+	}
+	sort.Slice(oids, func(i, j int) bool { return oidLess(oids[i], oids[j]) })
+
+	g.scalars = generatedSet{name: "scalars", eventType: "SNMPSample"}
+	if object := g.mibs.object(rootOid); object != nil {
+		g.scalars.name = object.name
+	}
+	g.detect(rootOid, oids)
+	if len(g.scalars.metrics) > 0 {
+		g.sets = append([]generatedSet{g.scalars}, g.sets...)
+	}
+	return g.sets
+}
+
+// detect walks the OID tree under prefix depth first, reporting the OIDs
+// ending in .0 as scalars and the table entries it finds as tables
+func (g *generator) detect(prefix string, oids []string) {
+	var arcs []string
+	children := make(map[string][]string)
+	for _, oid := range oids {
+		if oid == prefix {
+			g.addScalar(oid)
+			continue
+		}
+		arc := strings.SplitN(oid[len(prefix)+1:], ".", 2)[0]
+		if _, ok := children[arc]; !ok {
+			arcs = append(arcs, arc)
+		}
+		children[arc] = append(children[arc], oid)
+	}
+	if g.isEntry(prefix, arcs, children) {
+		g.addTable(prefix, arcs, children)
+		return
+	}
+	for _, arc := range arcs {
+		g.detect(prefix+"."+arc, children[arc])
+	}
+}
+
+// isEntry reports whether prefix is a table entry: the MIBs define it with an
+// index or, without MIBs, it is an arc 1 with two or more columns sharing the
+// same row indexes
+func (g *generator) isEntry(prefix string, arcs []string, children map[string][]string) bool {
+	if object := g.mibs.object(prefix); object != nil && (len(object.index) > 0 || object.augments != "") {
+		return true
+	}
+	if !strings.HasSuffix(prefix, ".1") || len(arcs) < 2 {
+		return false
+	}
+	var largest map[string]bool
+	rows := make([]map[string]bool, len(arcs))
+	scalars := true
+	for i, arc := range arcs {
+		rows[i] = make(map[string]bool)
+		column := prefix + "." + arc
+		for _, oid := range children[arc] {
+			if oid == column {
+				return false
+			}
+			row := oid[len(column)+1:]
+			rows[i][row] = true
+			scalars = scalars && row == "0"
+		}
+		if len(rows[i]) > len(largest) {
+			largest = rows[i]
+		}
+	}
+	if scalars {
+		return false
+	}
+	// Columns may be sparse, but their rows must all be rows of the table
+	for _, r := range rows {
+		for row := range r {
+			if !largest[row] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (g *generator) addScalar(oid string) {
+	pdu := g.pdus[oid]
+	object := strings.TrimSuffix(oid, ".0")
+	m, ok := g.metric(oid, object, pdu, "oid"+strings.Replace(object, ".", "_", -1))
+	if ok {
+		g.scalars.metrics = append(g.scalars.metrics, m)
+	}
+}
+
+func (g *generator) addTable(entry string, arcs []string, children map[string][]string) {
+	table := strings.TrimSuffix(entry, ".1")
+	set, known := g.tables[entry]
+	if !known {
+		set = generatedSet{name: "table" + strings.Replace(table, ".", "_", -1)}
+		if object := g.mibs.object(table); object != nil {
+			set.name = object.name
+		}
+		set.eventType = "SNMP" + strings.ToUpper(set.name[:1]) + set.name[1:] + "Sample"
+	}
+	set.table, set.rootOid = true, entry
+
+	columns := make(map[string]gosnmp.SnmpPDU, len(arcs))
+	for _, arc := range arcs {
+		columns[entry+"."+arc] = g.pdus[children[arc][0]]
+	}
+	// The index of a known table is curated, otherwise the MIB index is used
+	// when its columns were walked, or else the first string column
+	if len(set.index) == 0 {
+		for _, oid := range g.mibs.entryIndex(entry) {
+			if _, ok := columns[oid]; ok {
+				set.index = append(set.index, generatedMetric{name: g.mibs.object(oid).name, oid: oid})
+			}
+		}
+	}
+	if len(set.index) == 0 {
+		indexOid := entry + "." + arcs[0]
+		for _, arc := range arcs {
+			if columns[entry+"."+arc].Type == gosnmp.OctetString {
+				indexOid = entry + "." + arc
+				break
+			}
+		}
+		name := set.name + "Column" + indexOid[len(entry)+1:]
+		if object := g.mibs.object(indexOid); object != nil {
+			name = object.name
+		}
+		set.index = []generatedMetric{{name: name, oid: indexOid}}
+	}
+
+	isIndex := make(map[string]bool)
+	for _, i := range set.index {
+		isIndex[i.oid] = true
+	}
+	for _, arc := range arcs {
+		column := entry + "." + arc
+		if isIndex[column] {
+			continue
+		}
+		if m, ok := g.metric(column, column, columns[column], set.name+"Column"+arc); ok {
+			set.metrics = append(set.metrics, m)
+		}
+	}
+	g.sets = append(g.sets, set)
+}
+
+// metric names the metric of an OID and guesses its metric_type from the PDU.
+// It returns false for the PDU types createMetric doesn't support.
+func (g *generator) metric(oid, object string, pdu gosnmp.SnmpPDU, fallback string) (generatedMetric, bool) {
+	if known, ok := g.known[oid]; ok {
+		return generatedMetric{name: known.name, oid: oid, metricType: known.metricType}, true
+	}
+	if known, ok := g.known[object]; ok {
+		return generatedMetric{name: known.name, oid: oid, metricType: known.metricType}, true
+	}
+	m := generatedMetric{name: fallback, oid: oid}
+	if o := g.mibs.object(object); o != nil {
+		m.name = o.name
+	}
+	switch pdu.Type {
+	case gosnmp.Counter32, gosnmp.Counter64:
+		m.metricType = "prate"
+		m.name += "PerSecond"
+	case gosnmp.OctetString, gosnmp.ObjectIdentifier, gosnmp.IPAddress, gosnmp.Integer, gosnmp.Gauge32,
+		gosnmp.Uinteger32, gosnmp.OpaqueFloat, gosnmp.OpaqueDouble, gosnmp.Boolean:
+	default:
+		g.skipped = append(g.skipped, fmt.Sprintf("%s (%s): %s values are not supported", m.name, oid, pdu.Type))
+		return m, false
+	}
+	return m, true
+}
+
+// write prints the metric sets as a collection file
+func (g *generator) write(out io.Writer, device, source string) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "# Draft collection generated by nri-snmp from %s.\n", source)
+	fmt.Fprintln(w, "# Review the metric sets, names and metric types and remove what isn't needed.")
+	for _, skipped := range g.skipped {
+		fmt.Fprintf(w, "# Skipped %s\n", skipped)
+	}
+	fmt.Fprintln(w, "collect:")
+	fmt.Fprintf(w, "- device: %s\n", device)
+	fmt.Fprintln(w, "  metric_sets:")
+	for _, set := range g.sets {
+		fmt.Fprintf(w, "  - name: %s\n", set.name)
+		if set.table {
+			fmt.Fprintln(w, "    type: table")
+		} else {
+			fmt.Fprintln(w, "    type: scalar")
+		}
+		fmt.Fprintf(w, "    event_type: %s\n", set.eventType)
+		if set.table {
+			fmt.Fprintf(w, "    root_oid: %s\n", set.rootOid)
+			fmt.Fprintln(w, "    index:")
+			for _, i := range set.index {
+				fmt.Fprintf(w, "    - metric_name: %s\n      oid: %s\n", i.name, i.oid)
+			}
+		}
+		fmt.Fprintln(w, "    metrics:")
+		for _, m := range set.metrics {
+			fmt.Fprintf(w, "    - metric_name: %s\n      oid: %s\n", m.name, m.oid)
+			if m.metricType != "" {
+				fmt.Fprintf(w, "      metric_type: %s\n", m.metricType)
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// runGenerate prints a draft collection file for the subtree under rootOid,
+// walked on the target or read from a saved walk
+func runGenerate(rootOid string, out io.Writer) error {
+	var mibs *mibTree
+	if args.MibFiles != "" {
+		var err error
+		if mibs, err = loadMibs(strings.Split(args.MibFiles, ",")); err != nil {
+			return err
+		}
+	}
+
+	var pdus map[string]gosnmp.SnmpPDU
+	var source string
+	if args.GenerateFromWalk != "" {
+		f, err := os.Open(args.GenerateFromWalk)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if pdus, err = readSavedWalk(f); err != nil {
+			return fmt.Errorf("unable to read walk %s: %v", args.GenerateFromWalk, err)
+		}
+		if rootOid == "" {
+			rootOid = commonPrefix(pdus)
+		}
+		source = "the walk in " + args.GenerateFromWalk
+	} else {
+		var err error
+		if pdus, err = walkOids(rootOid); err != nil {
+			return fmt.Errorf("unable to walk %s: %v", rootOid, err)
+		}
+		source = fmt.Sprintf("a walk of %s on %s", absoluteOid(rootOid), targetHost)
+	}
+
+	g := newGenerator(pdus, mibs)
+	if len(g.run(rootOid)) == 0 {
+		return fmt.Errorf("no scalars or tables found under %s", absoluteOid(rootOid))
+	}
+	device := targetHost
+	if device == "" {
+		device = "device"
+	}
+	return g.write(out, device, source)
+}
+
+// commonPrefix returns the longest OID all the OIDs of a walk are under
+func commonPrefix(pdus map[string]gosnmp.SnmpPDU) string {
+	var prefix []string
+	first := true
+	for oid := range pdus {
+		arcs := strings.Split(strings.TrimPrefix(oid, "."), ".")
+		if first {
+			prefix, first = arcs[:len(arcs)-1], false
+			continue
+		}
+		n := 0
+		for n < len(prefix) && n < len(arcs)-1 && prefix[n] == arcs[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return "." + strings.Join(prefix, ".")
+}
+
+var savedWalkLine = regexp.MustCompile(`^\s*(\.?[0-9]+(?:\.[0-9]+)*)\s+=\s+(?:([A-Za-z0-9-]+):\s*)?(.*)$`)
+
+// readSavedWalk reads the output of snmpwalk -One, one OID per line such as
+// .1.3.6.1.2.1.1.5.0 = STRING: "edge-01". Lines it can't parse, such as the
+// continuation lines of multi-line strings, are ignored.
+func readSavedWalk(r io.Reader) (map[string]gosnmp.SnmpPDU, error) {
+	pdus := make(map[string]gosnmp.SnmpPDU)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := savedWalkLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		pdu, ok := parseSavedValue(absoluteOid(m[1]), m[2], strings.TrimSpace(m[3]))
+		if ok {
+			pdus[pdu.Name] = pdu
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(pdus) == 0 {
+		return nil, fmt.Errorf("no OIDs found, the walk must be saved with snmpwalk -One")
+	}
+	return pdus, nil
+}
+
+var firstNumber = regexp.MustCompile(`-?[0-9]+`)
+
+// parseSavedValue converts a value printed by snmpwalk into a PDU
+func parseSavedValue(oid, valueType, value string) (gosnmp.SnmpPDU, bool) {
+	pdu := gosnmp.SnmpPDU{Name: oid}
+	number := func() (int64, bool) {
+		// Enumerations are printed as up(1) unless -e is used
+		if open := strings.Index(value, "("); open >= 0 {
+			value = value[open:]
+		}
+		n, err := strconv.ParseInt(firstNumber.FindString(value), 10, 64)
+		return n, err == nil
+	}
+	switch valueType {
+	case "", "STRING":
+		if valueType == "" && value != `""` {
+			return pdu, false
+		}
+		pdu.Type, pdu.Value = gosnmp.OctetString, []byte(strings.Trim(value, `"`))
+	case "Hex-STRING":
+		b, err := hex.DecodeString(strings.Replace(value, " ", "", -1))
+		if err != nil {
+			return pdu, false
+		}
+		pdu.Type, pdu.Value = gosnmp.OctetString, b
+	case "OID":
+		pdu.Type, pdu.Value = gosnmp.ObjectIdentifier, value
+	case "IpAddress":
+		pdu.Type, pdu.Value = gosnmp.IPAddress, value
+	case "INTEGER":
+		n, ok := number()
+		pdu.Type, pdu.Value = gosnmp.Integer, int(n)
+		return pdu, ok
+	case "Counter32", "Counter64", "Gauge32", "Timeticks":
+		n, ok := number()
+		types := map[string]gosnmp.Asn1BER{"Counter32": gosnmp.Counter32, "Counter64": gosnmp.Counter64, "Gauge32": gosnmp.Gauge32, "Timeticks": gosnmp.TimeTicks}
+		pdu.Type = types[valueType]
+		if valueType == "Counter64" {
+			pdu.Value = uint64(n)
+		} else {
+			pdu.Value = uint(n)
+		}
+		return pdu, ok
+	default:
+		return pdu, false
+	}
+	return pdu, true
+}
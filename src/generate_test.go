@@ -0,0 +1,178 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMib = `TEST-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, Counter32, enterprises FROM SNMPv2-SMI;
+
+testMIB MODULE-IDENTITY
+    LAST-UPDATED "202001010000Z"
+    ORGANIZATION "Example"
+    DESCRIPTION "A test module -- with dashes"
+    ::= { enterprises 52032 }
+
+testObjects OBJECT IDENTIFIER ::= { testMIB 1 }
+
+testUptime OBJECT-TYPE
+    SYNTAX      Counter32
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "Seconds since start"
+    ::= { testObjects 1 }
+
+sensorTable OBJECT-TYPE
+    SYNTAX      SEQUENCE OF SensorEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "Sensors"
+    ::= { testObjects 2 }
+
+sensorEntry OBJECT-TYPE
+    SYNTAX      SensorEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "A sensor"
+    INDEX       { sensorIndex }
+    ::= { sensorTable 1 }
+
+sensorIndex OBJECT-TYPE
+    SYNTAX      Integer32
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "Index"
+    ::= { sensorEntry 1 }
+
+sensorValue OBJECT-TYPE
+    SYNTAX      Integer32
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "Value"
+    ::= { sensorEntry 2 } -- trailing comment
+
+END
+`
+
+const testWalk = `.1.3.6.1.4.1.52032.1.1.0 = Counter32: 4200
+.1.3.6.1.4.1.52032.1.2.1.1.1 = INTEGER: 1
+.1.3.6.1.4.1.52032.1.2.1.1.2 = INTEGER: 2
+.1.3.6.1.4.1.52032.1.2.1.2.1 = INTEGER: 21
+.1.3.6.1.4.1.52032.1.2.1.2.2 = INTEGER: 35
+.1.3.6.1.4.1.52032.1.2.1.3.1 = STRING: "cpu
+temperature"
+.1.3.6.1.4.1.52032.1.2.1.3.2 = Hex-STRING: 69 6E 6C 65 74
+.1.3.6.1.4.1.52032.1.3.0 = Timeticks: (8745123) 1 day, 0:17:31.23
+.1.3.6.1.4.1.52032.1.4.0 = No Such Object available on this agent at this OID
+`
+
+func TestLoadMibs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mibs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "TEST-MIB.txt")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(testMib), 0644))
+
+	mibs, err := loadMibs([]string{file})
+	assert.NoError(t, err)
+	assert.Equal(t, "testUptime", mibs.object(".1.3.6.1.4.1.52032.1.1").name)
+	assert.Equal(t, "sensorValue", mibs.object(".1.3.6.1.4.1.52032.1.2.1.2").name)
+	assert.Equal(t, []string{".1.3.6.1.4.1.52032.1.2.1.1"}, mibs.entryIndex(".1.3.6.1.4.1.52032.1.2.1"))
+	assert.Nil(t, mibs.object(".1.3.6.1.4.1.52032.9"))
+
+	_, err = loadMibs([]string{filepath.Join(dir, "missing.txt")})
+	assert.Error(t, err)
+}
+
+func TestReadSavedWalk(t *testing.T) {
+	pdus, err := readSavedWalk(strings.NewReader(testWalk))
+	assert.NoError(t, err)
+	assert.Len(t, pdus, 8)
+	assert.Equal(t, gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.52032.1.1.0", Type: gosnmp.Counter32, Value: uint(4200)}, pdus[".1.3.6.1.4.1.52032.1.1.0"])
+	assert.Equal(t, []byte("inlet"), pdus[".1.3.6.1.4.1.52032.1.2.1.3.2"].Value)
+	assert.Equal(t, gosnmp.TimeTicks, pdus[".1.3.6.1.4.1.52032.1.3.0"].Type)
+	assert.Equal(t, ".1.3.6.1.4.1.52032.1", commonPrefix(pdus))
+
+	_, err = readSavedWalk(strings.NewReader("SNMPv2-MIB::sysName.0 = STRING: edge-01\n"))
+	assert.Error(t, err)
+}
+
+func TestGenerator_Profiles(t *testing.T) {
+	pdus := loadRecording(t, filepath.Join("testdata", "profiles", "if-mib.snmprec"))
+	g := newGenerator(pdus, nil)
+	sets := g.run(".1.3.6.1.2.1.2")
+	if !assert.Len(t, sets, 2) {
+		return
+	}
+	assert.Equal(t, "scalars", sets[0].name)
+	assert.Equal(t, []generatedMetric{{name: "ifNumber", oid: ".1.3.6.1.2.1.2.1.0"}}, sets[0].metrics)
+
+	// The names and the index come from the bundled IF-MIB profile
+	assert.Equal(t, "ifTable", sets[1].name)
+	assert.Equal(t, "SNMPInterfaceSample", sets[1].eventType)
+	assert.Equal(t, ".1.3.6.1.2.1.2.2.1", sets[1].rootOid)
+	assert.Equal(t, []generatedMetric{{name: "ifDescr", oid: ".1.3.6.1.2.1.2.2.1.2"}}, sets[1].index)
+	assert.Contains(t, sets[1].metrics, generatedMetric{name: "ifInOctetsPerSecond", oid: ".1.3.6.1.2.1.2.2.1.10", metricType: "prate"})
+	assert.Contains(t, sets[1].metrics, generatedMetric{name: "ifTableColumn1", oid: ".1.3.6.1.2.1.2.2.1.1"})
+	assert.Equal(t, []string{"ifTableColumn9 (.1.3.6.1.2.1.2.2.1.9): TimeTicks values are not supported"}, g.skipped)
+	for _, m := range sets[1].metrics {
+		assert.NotEqual(t, ".1.3.6.1.2.1.2.2.1.2", m.oid, "the index column is not a metric")
+	}
+}
+
+func TestRunGenerate(t *testing.T) {
+	defer func(a argumentList, host string) { args, targetHost = a, host }(args, targetHost)
+	dir, err := ioutil.TempDir("", "generate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	walk, mib := filepath.Join(dir, "device.snmpwalk"), filepath.Join(dir, "TEST-MIB.txt")
+	assert.NoError(t, ioutil.WriteFile(walk, []byte(testWalk), 0644))
+	assert.NoError(t, ioutil.WriteFile(mib, []byte(testMib), 0644))
+
+	targetHost = "edge-01"
+	args.Generate, args.GenerateFromWalk, args.MibFiles = "", walk, mib
+	var out bytes.Buffer
+	assert.NoError(t, runGenerate("", &out))
+	assert.Equal(t, `# Draft collection generated by nri-snmp from the walk in `+walk+`.
+# Review the metric sets, names and metric types and remove what isn't needed.
+# Skipped oid_1_3_6_1_4_1_52032_1_3 (.1.3.6.1.4.1.52032.1.3.0): TimeTicks values are not supported
+collect:
+- device: edge-01
+  metric_sets:
+  - name: testObjects
+    type: scalar
+    event_type: SNMPSample
+    metrics:
+    - metric_name: testUptimePerSecond
+      oid: .1.3.6.1.4.1.52032.1.1.0
+      metric_type: prate
+  - name: sensorTable
+    type: table
+    event_type: SNMPSensorTableSample
+    root_oid: .1.3.6.1.4.1.52032.1.2.1
+    index:
+    - metric_name: sensorIndex
+      oid: .1.3.6.1.4.1.52032.1.2.1.1
+    metrics:
+    - metric_name: sensorValue
+      oid: .1.3.6.1.4.1.52032.1.2.1.2
+    - metric_name: sensorTableColumn3
+      oid: .1.3.6.1.4.1.52032.1.2.1.3
+`, out.String())
+
+	// The draft is a valid collection file
+	assert.Empty(t, validateCollection("generated.yml", out.Bytes()))
+}
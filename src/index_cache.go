@@ -0,0 +1,126 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/soniah/gosnmp"
+)
+
+const sysUpTimeOid = ".1.3.6.1.2.1.1.3.0"
+
+// theIndexCache keeps the index columns of the tables between polls, nil when disabled
+var theIndexCache *indexCache
+
+var invalidStoreNameChars = regexp.MustCompile(`[^a-zA-Z0-9.-]`)
+
+// cachedIndex is the index column data of a table: the index values of each row
+// and the device uptime when they were read
+type cachedIndex struct {
+	Rows      map[string]map[string]string `json:"rows"`
+	SysUpTime uint32                       `json:"sysUpTime"`
+}
+
+// indexCache caches the slowly changing index columns of tables so that only
+// the metric columns are walked on each poll
+type indexCache struct {
+	store persist.Storer
+	ttl   time.Duration
+	now   func() time.Time
+	// sysUpTime returns the current uptime of the device, ok is false when it is unknown
+	sysUpTime func() (uptime uint32, ok bool)
+}
+
+// newIndexCache returns a cache persisted in a store file of the target
+func newIndexCache(ttl time.Duration) (*indexCache, error) {
+	name := invalidStoreNameChars.ReplaceAllString(fmt.Sprintf("nri-snmp-index-%s-%d", targetHost, targetPort), "_")
+	store, err := persist.NewFileStore(persist.DefaultPath(name), log.NewStdErr(args.Verbose), ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &indexCache{store: store, ttl: ttl, now: time.Now, sysUpTime: probedSysUpTime}, nil
+}
+
+// indexCacheKey identifies the index columns of a metric set
+func indexCacheKey(metricSet metricSet) string {
+	names := make([]string, 0, len(metricSet.Index))
+	for _, index := range metricSet.Index {
+		names = append(names, index.name+"="+index.oid)
+	}
+	return metricSet.RootOid + "|" + strings.Join(names, ",")
+}
+
+// get returns the cached rows of a table. Entries older than the TTL or read
+// before the device restarted are discarded.
+func (c *indexCache) get(key string) (map[string]map[string]string, bool) {
+	var entry cachedIndex
+	timestamp, err := c.store.Get(key, &entry)
+	if err != nil {
+		return nil, false
+	}
+	if c.now().Sub(time.Unix(timestamp, 0)) > c.ttl {
+		log.Debug("index cache of %s expired", key)
+		return nil, false
+	}
+	if uptime, ok := c.sysUpTime(); ok && uptime < entry.SysUpTime {
+		log.Debug("sysUpTime of target %s went backwards, discarding index cache of %s", targetHost, key)
+		return nil, false
+	}
+	return entry.Rows, true
+}
+
+// set caches the rows of a table
+func (c *indexCache) set(key string, rows map[string]map[string]string) {
+	uptime, _ := c.sysUpTime()
+	c.store.Set(key, cachedIndex{Rows: rows, SysUpTime: uptime})
+}
+
+// save persists the cache so it is available to the next run. It does nothing
+// when the cache is disabled.
+func (c *indexCache) save() {
+	if c == nil {
+		return
+	}
+	if err := c.store.Save(); err != nil {
+		log.Warn("unable to save index cache. %v", err)
+	}
+}
+
+// probedSysUpTime returns the uptime read by the probe of the current run
+func probedSysUpTime() (uint32, bool) {
+	if theSysUpTime == nil {
+		return 0, false
+	}
+	return theSysUpTime.ticks, true
+}
+
+// cachedRows returns the cached rows that have a value in the metric columns.
+// Rows without any value were removed, or have nothing to report. ok is false
+// when the metric columns have a row that isn't cached, which is a new one.
+// Only the row keys are compared so sparse columns don't invalidate the cache.
+func cachedRows(cached map[string]map[string]string, metricSet metricSet, pdus map[string]gosnmp.SnmpPDU) (map[string]map[string]string, bool) {
+	rows := make(map[string]map[string]string, len(cached))
+	ok := true
+	for _, metric := range metricSet.Metrics {
+		prefix := strings.TrimSpace(metric.oid) + "."
+		for oid := range pdus {
+			if !strings.HasPrefix(oid, prefix) {
+				continue
+			}
+			indexKey := strings.TrimPrefix(oid, prefix)
+			if row, known := cached[indexKey]; known {
+				rows[indexKey] = row
+			} else {
+				ok = false
+			}
+		}
+	}
+	return rows, ok
+}
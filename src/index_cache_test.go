@@ -0,0 +1,86 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexCache(t *testing.T) {
+	now := time.Now()
+	uptime := uint32(5000)
+	c := &indexCache{
+		store:     persist.NewInMemoryStore(),
+		ttl:       time.Hour,
+		now:       func() time.Time { return now },
+		sysUpTime: func() (uint32, bool) { return uptime, true },
+	}
+	rows := map[string]map[string]string{"1": {"ifDescr": "Gi1/0/1"}, "2": {"ifDescr": "Gi1/0/2"}}
+
+	_, ok := c.get("ifTable")
+	assert.False(t, ok)
+
+	c.set("ifTable", rows)
+	cached, ok := c.get("ifTable")
+	assert.True(t, ok)
+	assert.Equal(t, rows, cached)
+
+	// The device restarted since the rows were cached
+	uptime = 100
+	_, ok = c.get("ifTable")
+	assert.False(t, ok)
+
+	// The uptime can't be read, only the TTL applies
+	c.sysUpTime = func() (uint32, bool) { return 0, false }
+	_, ok = c.get("ifTable")
+	assert.True(t, ok)
+
+	now = now.Add(2 * time.Hour)
+	_, ok = c.get("ifTable")
+	assert.False(t, ok)
+}
+
+func TestCachedRows(t *testing.T) {
+	ms := metricSet{Metrics: []*metricDef{{metricName: "ifInOctets", oid: ".1.3.6.1.2.1.2.2.1.10"}, {metricName: "ifOutOctets", oid: ".1.3.6.1.2.1.2.2.1.16"}}}
+	cached := map[string]map[string]string{"1": {"ifDescr": "Gi1/0/1"}, "2": {"ifDescr": "Gi1/0/2"}}
+
+	// Sparse columns keep the cache
+	walked := pduMap(integer(".1.3.6.1.2.1.2.2.1.10.1", 10), integer(".1.3.6.1.2.1.2.2.1.16.2", 30))
+	rows, ok := cachedRows(cached, ms, walked)
+	assert.True(t, ok)
+	assert.Equal(t, cached, rows)
+
+	// A removed row is left out
+	rows, ok = cachedRows(cached, ms, pduMap(integer(".1.3.6.1.2.1.2.2.1.10.1", 10)))
+	assert.True(t, ok)
+	assert.Equal(t, map[string]map[string]string{"1": {"ifDescr": "Gi1/0/1"}}, rows)
+
+	// A row was added
+	walked[".1.3.6.1.2.1.2.2.1.10.3"] = integer(".1.3.6.1.2.1.2.2.1.10.3", 40)
+	_, ok = cachedRows(cached, ms, walked)
+	assert.False(t, ok)
+}
+
+func TestProbedSysUpTime(t *testing.T) {
+	defer func(uptime *sysUpTime) { theSysUpTime = uptime }(theSysUpTime)
+	theSysUpTime = nil
+	_, ok := probedSysUpTime()
+	assert.False(t, ok)
+
+	theSysUpTime = &sysUpTime{ticks: 5000, readAt: time.Now()}
+	uptime, ok := probedSysUpTime()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(5000), uptime)
+}
+
+func TestIndexCacheKey(t *testing.T) {
+	ms := metricSet{RootOid: ".1.3.6.1.2.1.2.2", Index: []*index{{name: "ifDescr", oid: ".1.3.6.1.2.1.2.2.1.2"}}}
+	key := indexCacheKey(ms)
+	ms.Index = append(ms.Index, &index{name: "ifType", oid: ".1.3.6.1.2.1.2.2.1.3"})
+	assert.NotEqual(t, key, indexCacheKey(ms))
+}
@@ -7,12 +7,11 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/newrelic/infra-integrations-sdk/integration"
 	"github.com/newrelic/infra-integrations-sdk/log"
 	"github.com/soniah/gosnmp"
 )
 
-func populateInventory(inventoryItems []inventoryItem, entity *integration.Entity) error {
+func populateInventory(inventoryItems []inventoryItem, writer sampleWriter) error {
 	var oids []string
 	inventoryOidMap := make(map[string]inventoryItem)
 	for _, inventoryItem := range inventoryItems {
@@ -25,10 +24,13 @@ func populateInventory(inventoryItems []inventoryItem, entity *integration.Entit
 		return nil
 	}
 
-	snmpGetResult, err := theSNMP.Get(oids)
+	snmpGetResult, err := theClient.Get(oids)
 	if err != nil {
 		return err
 	}
+	if err := checkReport(snmpGetResult); err != nil {
+		return err
+	}
 
 	// SNMPv1 will return packet error for unsupported OIDs.
 	if snmpGetResult.Error == gosnmp.NoSuchName && theSNMP.Version == gosnmp.Version1 {
@@ -51,30 +53,13 @@ func populateInventory(inventoryItems []inventoryItem, entity *integration.Entit
 			name = itemDefinition.name
 			category = itemDefinition.category
 		} else {
-			errorMessage, ok := knownErrorOids[oid]
-			if ok {
-				return fmt.Errorf("Error Message: %s", errorMessage)
-			}
 			log.Warn("Unexpected OID %s received", oid)
 			continue
 		}
 
-		switch variable.Type {
-		case gosnmp.OctetString:
-			value = string(variable.Value.([]byte))
-		case gosnmp.Gauge32, gosnmp.Counter32, gosnmp.Counter64, gosnmp.Integer, gosnmp.Uinteger32:
-			value = gosnmp.ToBigInt(variable.Value)
-		case gosnmp.ObjectIdentifier, gosnmp.IPAddress:
-			if v, ok := variable.Value.(string); ok {
-				value = v
-			}
-			log.Warn("unable to assert type as string for OID ", variable.Name)
-		default:
-			value = variable.Value
-		}
-
+		value = inventoryValue(variable)
 		if value != nil {
-			err = entity.SetInventoryItem(category, name, value)
+			err = writer.SetInventoryItem(category, name, value)
 			if err != nil {
 				log.Error(err.Error())
 			}
@@ -84,3 +69,106 @@ func populateInventory(inventoryItems []inventoryItem, entity *integration.Entit
 	}
 	return nil
 }
+
+// inventoryValue converts a PDU into a value suitable for an inventory item
+func inventoryValue(variable gosnmp.SnmpPDU) interface{} {
+	switch variable.Type {
+	case gosnmp.OctetString:
+		if v, ok := variable.Value.([]byte); ok {
+			return string(v)
+		}
+		log.Warn("unable to assert type as []byte for OID %s", variable.Name)
+		return nil
+	case gosnmp.Gauge32, gosnmp.Counter32, gosnmp.Counter64, gosnmp.Integer, gosnmp.Uinteger32:
+		return gosnmp.ToBigInt(variable.Value)
+	case gosnmp.ObjectIdentifier, gosnmp.IPAddress:
+		if v, ok := variable.Value.(string); ok {
+			return v
+		}
+		log.Warn("unable to assert type as string for OID %s", variable.Name)
+		return nil
+	default:
+		return variable.Value
+	}
+}
+
+func populateTableInventory(tables []inventoryTable, writer sampleWriter) error {
+	for _, table := range tables {
+		pdus, err := walkOids(table.rootOid)
+		if err != nil {
+			return err
+		}
+		items := tableInventoryItems(table, pdus)
+		for category, fields := range items {
+			for name, value := range fields {
+				err = writer.SetInventoryItem(category, name, value)
+				if err != nil {
+					log.Error(err.Error())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// tableInventoryItems builds one inventory item per table row, keyed by the
+// expanded category. Index columns and fields are stored as item fields.
+func tableInventoryItems(table inventoryTable, pdus map[string]gosnmp.SnmpPDU) map[string]map[string]interface{} {
+	indexValues := make(map[string]map[string]string)
+	for _, index := range table.index {
+		prefix := index.oid + "."
+		for oid, pdu := range pdus {
+			if !strings.HasPrefix(oid, prefix) {
+				continue
+			}
+			indexKey := strings.TrimPrefix(oid, prefix)
+			indexValue, err := extractIndexValue(pdu)
+			if err != nil {
+				log.Error("unable to extract index value for %s: %v", indexKey, err)
+				continue
+			}
+			values, ok := indexValues[indexKey]
+			if !ok {
+				values = map[string]string{"index": indexKey}
+				indexValues[indexKey] = values
+			}
+			values[index.name] = indexValue
+		}
+	}
+
+	// Rows whose category isn't unique, such as those of an empty
+	// entPhysicalName, are told apart by their index key
+	categories := make(map[string]string, len(indexValues))
+	rows := make(map[string]int, len(indexValues))
+	for indexKey, values := range indexValues {
+		category := expandTemplate(table.category, values)
+		categories[indexKey] = category
+		rows[category]++
+	}
+
+	items := make(map[string]map[string]interface{})
+	for indexKey, values := range indexValues {
+		category := categories[indexKey]
+		if rows[category] > 1 {
+			log.Debug("inventory category %s is not unique for table %s, using the index of row %s", category, table.rootOid, indexKey)
+			category = strings.TrimRight(category, "/") + "/" + indexKey
+		}
+		fields := make(map[string]interface{})
+		items[category] = fields
+		for name, value := range values {
+			if name != "index" {
+				fields[name] = value
+			}
+		}
+		for _, field := range table.fields {
+			pdu, ok := pdus[field.oid+"."+indexKey]
+			if !ok {
+				continue
+			}
+			if value := inventoryValue(pdu); value != nil {
+				fields[field.name] = value
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInventoryTable(t *testing.T) {
+	table, err := parseInventoryTable(inventoryTableParser{
+		RootOid:  "1.3.6.1.2.1.47.1.1.1.1",
+		Category: "hardware/${entPhysicalName}",
+		Index:    []indexParser{{Oid: "1.3.6.1.2.1.47.1.1.1.1.7", Name: "entPhysicalName"}},
+		Fields:   []inventoryField{{Oid: "1.3.6.1.2.1.47.1.1.1.1.11", Name: "serialNumber"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ".1.3.6.1.2.1.47.1.1.1.1", table.rootOid)
+	assert.Equal(t, ".1.3.6.1.2.1.47.1.1.1.1.7", table.index[0].oid)
+	assert.Equal(t, ".1.3.6.1.2.1.47.1.1.1.1.11", table.fields[0].oid)
+
+	_, err = parseInventoryTable(inventoryTableParser{RootOid: ".1.3.6.1.2.1.47.1.1.1.1"})
+	assert.Error(t, err)
+	_, err = parseInventoryTable(inventoryTableParser{RootOid: ".1.3.6.1.2.1.47.1.1.1.1", Category: "hardware/${index}"})
+	assert.EqualError(t, err, "inventory table .1.3.6.1.2.1.47.1.1.1.1 is missing `index`")
+}
+
+func TestParseCollection_InventoryTablesPerCollection(t *testing.T) {
+	c, err := unmarshalCollection([]byte(`collect:
+- device: chassis
+  inventory_tables:
+  - root_oid: .1.3.6.1.2.1.47.1.1.1.1
+    category: hardware/${entPhysicalName}
+    index:
+    - metric_name: entPhysicalName
+      oid: .1.3.6.1.2.1.47.1.1.1.1.7
+- device: software
+  inventory_tables:
+  - root_oid: .1.3.6.1.2.1.25.6.3.1
+    category: software/${hrSWInstalledName}
+    index:
+    - metric_name: hrSWInstalledName
+      oid: .1.3.6.1.2.1.25.6.3.1.2
+`))
+	assert.NoError(t, err)
+	collections, err := parseCollection(c)
+	assert.NoError(t, err)
+	if assert.Len(t, collections, 2) {
+		if assert.Len(t, collections[0].InventoryTables, 1) {
+			assert.Equal(t, ".1.3.6.1.2.1.47.1.1.1.1", collections[0].InventoryTables[0].rootOid)
+		}
+		if assert.Len(t, collections[1].InventoryTables, 1) {
+			assert.Equal(t, ".1.3.6.1.2.1.25.6.3.1", collections[1].InventoryTables[0].rootOid)
+		}
+	}
+}
+
+func TestTableInventoryItems(t *testing.T) {
+	table := inventoryTable{
+		rootOid:  ".1.3.6.1.2.1.47.1.1.1.1",
+		category: "hardware/${entPhysicalName}",
+		index:    []*index{{oid: ".1.3.6.1.2.1.47.1.1.1.1.7", name: "entPhysicalName"}},
+		fields: []*inventoryItem{
+			{oid: ".1.3.6.1.2.1.47.1.1.1.1.11", name: "serialNumber"},
+			{oid: ".1.3.6.1.2.1.47.1.1.1.1.13", name: "modelName"},
+			{oid: ".1.3.6.1.2.1.47.1.1.1.1.6", name: "parentRelPos"},
+		},
+	}
+	pdus := pduMap(
+		octets(".1.3.6.1.2.1.47.1.1.1.1.7.1", []byte("Chassis")),
+		octets(".1.3.6.1.2.1.47.1.1.1.1.11.1", []byte("FOC1234X0AB")),
+		octets(".1.3.6.1.2.1.47.1.1.1.1.13.1", []byte("WS-C3750X-48")),
+		integer(".1.3.6.1.2.1.47.1.1.1.1.6.1", -1),
+		octets(".1.3.6.1.2.1.47.1.1.1.1.7.1001", []byte("Gi1/1/1 transceiver")),
+		octets(".1.3.6.1.2.1.47.1.1.1.1.11.1001", []byte("AGM1234567")),
+	)
+
+	items := tableInventoryItems(table, pdus)
+	assert.Equal(t, map[string]map[string]interface{}{
+		"hardware/Chassis": {
+			"entPhysicalName": "Chassis",
+			"serialNumber":    "FOC1234X0AB",
+			"modelName":       "WS-C3750X-48",
+			"parentRelPos":    big.NewInt(-1),
+		},
+		"hardware/Gi1/1/1 transceiver": {
+			"entPhysicalName": "Gi1/1/1 transceiver",
+			"serialNumber":    "AGM1234567",
+		},
+	}, items)
+}
+
+func TestTableInventoryItems_CategoryCollision(t *testing.T) {
+	table := inventoryTable{
+		rootOid:  ".1.3.6.1.2.1.47.1.1.1.1",
+		category: "hardware/${entPhysicalName}",
+		index:    []*index{{oid: ".1.3.6.1.2.1.47.1.1.1.1.7", name: "entPhysicalName"}},
+		fields:   []*inventoryItem{{oid: ".1.3.6.1.2.1.47.1.1.1.1.11", name: "serialNumber"}},
+	}
+	pdus := pduMap(
+		octets(".1.3.6.1.2.1.47.1.1.1.1.7.1", []byte("Chassis")),
+		octets(".1.3.6.1.2.1.47.1.1.1.1.7.2", []byte("")),
+		octets(".1.3.6.1.2.1.47.1.1.1.1.11.2", []byte("LIT0987")),
+		octets(".1.3.6.1.2.1.47.1.1.1.1.7.3", []byte("")),
+		octets(".1.3.6.1.2.1.47.1.1.1.1.11.3", []byte("LIT0988")),
+	)
+
+	// Rows with an empty entPhysicalName are kept apart by their index
+	items := tableInventoryItems(table, pdus)
+	assert.Equal(t, map[string]map[string]interface{}{
+		"hardware/Chassis": {"entPhysicalName": "Chassis"},
+		"hardware/2":       {"entPhysicalName": "", "serialNumber": "LIT0987"},
+		"hardware/3":       {"entPhysicalName": "", "serialNumber": "LIT0988"},
+	}, items)
+}
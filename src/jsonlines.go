@@ -0,0 +1,97 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+)
+
+// jsonLinesTypes maps metric types to the names used in collection files
+var jsonLinesTypes = map[metric.SourceType]string{
+	metric.GAUGE:  "gauge",
+	metric.DELTA:  "delta",
+	metric.PDELTA: "pdelta",
+	metric.RATE:   "rate",
+	metric.PRATE:  "prate",
+}
+
+// jsonLinesSample is a single line of the JSON lines file
+type jsonLinesSample struct {
+	Timestamp       int64             `json:"timestamp"`
+	EntityName      string            `json:"entityName"`
+	EntityType      string            `json:"entityType"`
+	ReportingEntity string            `json:"reportingEntity,omitempty"`
+	EventType       string            `json:"eventType"`
+	Attributes      map[string]string `json:"attributes"`
+	Metrics         []jsonLinesMetric `json:"metrics"`
+}
+
+type jsonLinesMetric struct {
+	Name  string  `json:"name"`
+	Type  string  `json:"type"`
+	Value float64 `json:"value"`
+}
+
+// jsonLinesSink appends one JSON object per sample to a file
+type jsonLinesSink struct {
+	*sampleRecorder
+	path string
+}
+
+// Publish appends the recorded samples to the file, creating it if needed
+func (s *jsonLinesSink) Publish() error {
+	entities := s.reported()
+	if len(entities) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	for _, e := range entities {
+		for _, sample := range newJSONLinesSamples(e) {
+			if err := encoder.Encode(sample); err != nil {
+				f.Close()
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newJSONLinesSamples converts the samples of an entity
+func newJSONLinesSamples(e *recordedEntity) []jsonLinesSample {
+	var samples []jsonLinesSample
+	for _, set := range e.sets {
+		sample := jsonLinesSample{
+			Timestamp:  set.timestamp.Unix(),
+			EntityName: e.name,
+			EntityType: e.entityType,
+			EventType:  set.eventType,
+			Attributes: make(map[string]string),
+			Metrics:    []jsonLinesMetric{},
+		}
+		if e.parent != nil {
+			sample.ReportingEntity = e.parent.name
+		}
+		for k, v := range set.attributes {
+			sample.Attributes[k] = v
+		}
+		for _, m := range set.metrics {
+			sample.Metrics = append(sample.Metrics, jsonLinesMetric{Name: m.name, Type: jsonLinesTypes[m.sourceType], Value: m.value})
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
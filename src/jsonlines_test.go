@@ -0,0 +1,67 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLinesSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nri-snmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "samples.jsonl")
+
+	for run := 0; run < 2; run++ {
+		recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, []attribute.Attribute{attribute.Attr("sysName", "core-sw-01")})
+		assert.NoError(t, err)
+		s := &jsonLinesSink{sampleRecorder: recorder, path: path}
+
+		ms := s.Writer().NewMetricSet("SNMPInterfaceSample", attribute.Attr("index", "1"))
+		assert.NoError(t, ms.SetMetric("ifInOctets", 1024, metric.PRATE))
+		row, err := s.Writer().RowWriter(&rowEntity{name: "${device}/${index}", entityType: "snmp-interface"}, "2", nil)
+		assert.NoError(t, err)
+		reportError("IF-MIB", metricSet{Name: "ifTable", EventType: "SNMPInterfaceSample"}, row, errors.New("timeout"))
+		assert.NoError(t, s.Publish())
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var samples []jsonLinesSample
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var sample jsonLinesSample
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &sample))
+		samples = append(samples, sample)
+	}
+
+	// Each run appends its samples to the file
+	if len(samples) != 4 {
+		t.Fatalf("expected 4 samples, got %d", len(samples))
+	}
+	assert.Equal(t, "core-sw-01", samples[0].EntityName)
+	assert.Equal(t, map[string]string{"sysName": "core-sw-01", "index": "1"}, samples[0].Attributes)
+	assert.Equal(t, []jsonLinesMetric{{Name: "ifInOctets", Type: "prate", Value: 1024}}, samples[0].Metrics)
+
+	assert.Equal(t, "core-sw-01/2", samples[1].EntityName)
+	assert.Equal(t, "core-sw-01", samples[1].ReportingEntity)
+	assert.Equal(t, "timeout", samples[1].Attributes["errorMessage"])
+	assert.Equal(t, "core-sw-01", samples[1].Attributes["sysName"])
+	assert.Empty(t, samples[1].Metrics)
+}
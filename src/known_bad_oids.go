@@ -0,0 +1,63 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/soniah/gosnmp"
+)
+
+const (
+	// knownBadOidsKey is the device state key of the OIDs that failed on the target
+	knownBadOidsKey = "knownBadOids"
+	// knownBadOidRetry is how long a known-bad OID is skipped before it is polled again
+	knownBadOidRetry = 24 * time.Hour
+)
+
+// badOid is an OID the target answered with an error status
+type badOid struct {
+	Status gosnmp.SNMPError `json:"status"`
+	Since  int64            `json:"since"`
+}
+
+// knownBadOids are the OIDs that made the target reject whole requests, skipped
+// on later runs so that they don't need to be isolated again
+type knownBadOids map[string]badOid
+
+// loadKnownBadOids reads the known-bad OIDs of the target from the device state
+func loadKnownBadOids() knownBadOids {
+	var known knownBadOids
+	if _, err := theDeviceState.Get(knownBadOidsKey, &known); err != nil || known == nil {
+		known = make(knownBadOids)
+	}
+	return known
+}
+
+// skip reports whether oid is known to fail and is not due to be retried
+func (k knownBadOids) skip(oid string, now time.Time) (gosnmp.SNMPError, bool) {
+	bad, ok := k[oid]
+	if !ok || now.Sub(time.Unix(bad.Since, 0)) >= knownBadOidRetry {
+		return gosnmp.NoError, false
+	}
+	return bad.Status, true
+}
+
+// update records the OIDs that failed and forgets the polled ones that didn't,
+// then stores the result in the device state
+func (k knownBadOids) update(polled []string, failed map[string]gosnmp.SNMPError, now time.Time) {
+	for _, oid := range polled {
+		status, ok := failed[oid]
+		if !ok {
+			delete(k, oid)
+			continue
+		}
+		if _, known := k[oid]; !known {
+			log.Info("OID %s of target %s is skipped for %s", oid, targetHost, knownBadOidRetry)
+		}
+		k[oid] = badOid{Status: status, Since: now.Unix()}
+	}
+	theDeviceState.Set(knownBadOidsKey, k)
+}
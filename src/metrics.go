@@ -10,7 +10,13 @@ import (
 	"github.com/soniah/gosnmp"
 )
 
-func createMetric(metricName string, metricType metric.SourceType, pdu gosnmp.SnmpPDU, ms *metric.Set) error {
+func createMetric(metricName string, metricType metric.SourceType, pdu gosnmp.SnmpPDU, ms metricSetter) (err error) {
+	if theExplain != nil {
+		explained := &explainedMetric{setter: ms}
+		defer func() { theExplain.metric(metricName, pdu, explained, err) }()
+		ms = explained
+	}
+
 	var sourceType metric.SourceType
 	var value interface{}
 	switch pdu.Type {
@@ -23,9 +29,12 @@ func createMetric(metricName string, metricType metric.SourceType, pdu gosnmp.Sn
 		switch metricType {
 		case -1:
 			value = gosnmp.ToBigInt(pdu.Value)
+			if pdu.Type == gosnmp.Counter32 || pdu.Type == gosnmp.Counter64 {
+				return setCounter(ms, metricName, value)
+			}
 			sourceType = metric.GAUGE
 		case metric.ATTRIBUTE:
-			value = gosnmp.ToBigInt(pdu.Value)
+			value = gosnmp.ToBigInt(pdu.Value).String()
 			sourceType = metric.ATTRIBUTE
 		default:
 			value = gosnmp.ToBigInt(pdu.Value)
@@ -78,9 +87,9 @@ func createMetric(metricName string, metricType metric.SourceType, pdu gosnmp.Sn
 	case gosnmp.UnknownType:
 		return fmt.Errorf("unsupported PDU type[UnknownType] for %v", metricName)
 	case gosnmp.Null:
-		return fmt.Errorf("null value[" + metricName + "].")
+		return fmt.Errorf("null value[%s].", metricName)
 	case gosnmp.NoSuchObject, gosnmp.NoSuchInstance:
-		return fmt.Errorf("no such object or instance[" + metricName + "].")
+		return fmt.Errorf("no such object or instance[%s].", metricName)
 	default:
 		return fmt.Errorf("unsupported PDU type[%x] for %v", pdu.Type, metricName)
 	}
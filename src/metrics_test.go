@@ -0,0 +1,26 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateMetric_IntegerAttribute(t *testing.T) {
+	set := &recordedSet{attributes: make(map[string]string)}
+	assert.NoError(t, createMetric("ifType", metric.ATTRIBUTE, gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 6}, set))
+	assert.NoError(t, createMetric("hrSWRunIndex", metric.ATTRIBUTE, gosnmp.SnmpPDU{Type: gosnmp.Gauge32, Value: uint(4294967295)}, set))
+	assert.NoError(t, createMetric("ifHCInOctets", metric.ATTRIBUTE, gosnmp.SnmpPDU{Type: gosnmp.Counter64, Value: uint64(18446744073709551615)}, set))
+
+	assert.Equal(t, map[string]string{
+		"ifType":       "6",
+		"hrSWRunIndex": "4294967295",
+		"ifHCInOctets": "18446744073709551615",
+	}, set.attributes)
+	assert.Empty(t, set.metrics)
+}
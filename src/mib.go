@@ -0,0 +1,148 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// mibRoots are the OIDs of SNMPv2-SMI that the MIB modules are defined under
+var mibRoots = map[string]string{
+	"iso":          ".1",
+	"org":          ".1.3",
+	"dod":          ".1.3.6",
+	"internet":     ".1.3.6.1",
+	"directory":    ".1.3.6.1.1",
+	"mgmt":         ".1.3.6.1.2",
+	"mib-2":        ".1.3.6.1.2.1",
+	"transmission": ".1.3.6.1.2.1.10",
+	"experimental": ".1.3.6.1.3",
+	"private":      ".1.3.6.1.4",
+	"enterprises":  ".1.3.6.1.4.1",
+	"snmpV2":       ".1.3.6.1.6",
+	"snmpModules":  ".1.3.6.1.6.3",
+}
+
+var (
+	mibComment    = regexp.MustCompile(`--.*`)
+	mibImports    = regexp.MustCompile(`(?s)\bIMPORTS\b.*?;`)
+	mibDefinition = regexp.MustCompile(`(?s)\b([a-zA-Z][\w-]*)\s+(OBJECT IDENTIFIER|OBJECT-TYPE|MODULE-IDENTITY|OBJECT-IDENTITY)\b(.*?)::=\s*\{\s*([a-zA-Z][\w-]*)\s+(\d+)\s*\}`)
+	mibIndex      = regexp.MustCompile(`\bINDEX\s*\{([^}]*)\}`)
+	mibAugments   = regexp.MustCompile(`\bAUGMENTS\s*\{([^}]*)\}`)
+)
+
+// mibObject is an object defined in a MIB module
+type mibObject struct {
+	name string
+	oid  string
+	// index lists the index objects of a table entry
+	index []string
+	// augments is the entry whose index an entry shares
+	augments string
+}
+
+// mibTree holds the objects of the loaded MIB modules by OID and by name
+type mibTree struct {
+	byOid  map[string]*mibObject
+	byName map[string]*mibObject
+}
+
+type mibDef struct {
+	object *mibObject
+	parent string
+	arc    string
+}
+
+// loadMibs parses the OBJECT-TYPE and OBJECT IDENTIFIER definitions of MIB
+// modules. It only resolves the OIDs of objects defined under the SNMPv2-SMI
+// roots or under other objects of the same files, so a module should be
+// loaded along with the modules it imports its parents from.
+func loadMibs(files []string) (*mibTree, error) {
+	var defs []mibDef
+	for _, file := range files {
+		content, err := ioutil.ReadFile(strings.TrimSpace(file))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read MIB %s: %v", file, err)
+		}
+		defs = append(defs, parseMib(string(content))...)
+	}
+
+	tree := &mibTree{byOid: make(map[string]*mibObject), byName: make(map[string]*mibObject)}
+	oids := make(map[string]string, len(mibRoots))
+	for name, oid := range mibRoots {
+		oids[name] = oid
+	}
+	// Definitions may refer to parents defined later or in another file
+	for resolved := true; resolved; {
+		resolved = false
+		for _, def := range defs {
+			if _, done := oids[def.object.name]; done {
+				continue
+			}
+			if parent, ok := oids[def.parent]; ok {
+				def.object.oid = parent + "." + def.arc
+				oids[def.object.name] = def.object.oid
+				tree.byOid[def.object.oid] = def.object
+				tree.byName[def.object.name] = def.object
+				resolved = true
+			}
+		}
+	}
+	return tree, nil
+}
+
+// parseMib extracts the definitions of a MIB module with the name of their parent
+func parseMib(content string) []mibDef {
+	content = mibComment.ReplaceAllString(content, "")
+	content = mibImports.ReplaceAllString(content, "")
+	var defs []mibDef
+	for _, m := range mibDefinition.FindAllStringSubmatch(content, -1) {
+		object := &mibObject{name: m[1]}
+		body := m[3]
+		if index := mibIndex.FindStringSubmatch(body); index != nil {
+			for _, name := range strings.Split(index[1], ",") {
+				name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), "IMPLIED"))
+				if name != "" {
+					object.index = append(object.index, name)
+				}
+			}
+		}
+		if augments := mibAugments.FindStringSubmatch(body); augments != nil {
+			object.augments = strings.TrimSpace(augments[1])
+		}
+		defs = append(defs, mibDef{object: object, parent: m[4], arc: m[5]})
+	}
+	return defs
+}
+
+// object returns the object at oid, nil when the tree doesn't define it
+func (t *mibTree) object(oid string) *mibObject {
+	if t == nil {
+		return nil
+	}
+	return t.byOid[oid]
+}
+
+// entryIndex returns the OIDs of the index objects of a table entry
+func (t *mibTree) entryIndex(entryOid string) []string {
+	entry := t.object(entryOid)
+	if entry == nil {
+		return nil
+	}
+	if entry.augments != "" {
+		if augmented, ok := t.byName[entry.augments]; ok {
+			entry = augmented
+		}
+	}
+	var oids []string
+	for _, name := range entry.index {
+		if object, ok := t.byName[name]; ok {
+			oids = append(oids, object.oid)
+		}
+	}
+	return oids
+}
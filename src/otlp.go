@@ -0,0 +1,372 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+)
+
+const (
+	// otlpMetricPrefix is prepended to the name of every OTLP metric
+	otlpMetricPrefix = "snmp."
+	// otlpDelta is the OTLP aggregation temporality of the delta metrics
+	otlpDelta = 1
+	// otlpCumulative is the OTLP aggregation temporality of the counters read from a device
+	otlpCumulative = 2
+
+	// otlpStartTimeKey keeps the start time of the cumulative sums of the target between runs
+	otlpStartTimeKey = "otlpStartTime"
+	// otlpReadingsKey keeps the previous readings of the delta and rate metrics between runs
+	otlpReadingsKey = "otlpReadings"
+	// otlpStartTimeTolerance is how far the boot time computed from the uptime
+	// of the target can move before it is taken as a restart
+	otlpStartTimeTolerance = time.Minute
+)
+
+// processStart is the start time of the cumulative sums when the uptime of the target is unknown
+var processStart = time.Now()
+
+// OTLP/HTTP JSON encoding of an ExportMetricsServiceRequest
+type otlpRequest struct {
+	ResourceMetrics []*otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource        `json:"resource"`
+	ScopeMetrics []*otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope     `json:"scope"`
+	Metrics []*otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          float64        `json:"asDouble"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// otlpReading is the previous value of a delta or rate metric
+type otlpReading struct {
+	Value        float64 `json:"value"`
+	TimeUnixNano int64   `json:"timeUnixNano"`
+}
+
+// otlpSink sends the samples of a run to an OTLP/HTTP endpoint. The device and
+// the table row entities become resources and sample attributes become data point attributes.
+type otlpSink struct {
+	*sampleRecorder
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+	// state keeps the start time of the cumulative sums and the readings of
+	// the delta and rate metrics between runs
+	state persist.Storer
+}
+
+// newOTLPSink returns a sink sending to endpoint. headers is a comma
+// separated list of key=value pairs added to every request.
+func newOTLPSink(recorder *sampleRecorder, endpoint, headers string, timeout time.Duration) (*otlpSink, error) {
+	headerValues, err := parseKeyValues(headers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP headers: %v", err)
+	}
+	return &otlpSink{
+		sampleRecorder: recorder,
+		endpoint:       endpoint,
+		headers:        headerValues,
+		client:         &http.Client{Timeout: timeout},
+		state:          theDeviceState,
+	}, nil
+}
+
+// Publish sends the recorded metrics to the collector.
+// Nothing is sent when no collection requested OTLP output.
+func (s *otlpSink) Publish() error {
+	entities := s.reported()
+	if len(entities) == 0 {
+		return nil
+	}
+	request := otlpRequest{}
+	start := otlpStartTime(s.state, theSysUpTime)
+	readings := loadOTLPReadings(s.state)
+	for _, e := range entities {
+		request.ResourceMetrics = append(request.ResourceMetrics, newOTLPResourceMetrics(e, readings, start))
+	}
+	readings.save(s.state)
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	httpRequest, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		httpRequest.Header.Set(k, v)
+	}
+	response, err := s.client.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("OTLP endpoint %s responded %s: %s", s.endpoint, response.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// newOTLPResourceMetrics converts the samples of an entity into OTLP metrics.
+// Gauges are reported as gauges and counters read with the auto type as
+// monotonic cumulative sums starting at start. Delta metrics are reported as
+// delta sums and rate metrics as gauges, both computed from the previous
+// reading, and are left out on the first reading. A metric reported with
+// different types keeps the first one.
+func newOTLPResourceMetrics(e *recordedEntity, readings *otlpReadings, start time.Time) *otlpResourceMetrics {
+	resource := &otlpResourceMetrics{}
+	attributes := []otlpKeyValue{
+		otlpAttribute("entity.name", e.name),
+		otlpAttribute("entity.type", e.entityType),
+	}
+	if e.parent != nil {
+		attributes = append(attributes, otlpAttribute("parent.entity.name", e.parent.name))
+	}
+	for _, id := range e.idAttributes {
+		attributes = append(attributes, otlpAttribute(id.Key, id.Value))
+	}
+	resource.Resource.Attributes = attributes
+
+	metrics := []*otlpMetric{}
+	byName := make(map[string]*otlpMetric)
+	add := func(name string, sum *otlpSum, dataPoint otlpDataPoint) {
+		om, ok := byName[name]
+		if !ok {
+			om = &otlpMetric{Name: otlpMetricPrefix + name, Sum: sum}
+			if sum == nil {
+				om.Gauge = &otlpGauge{}
+			}
+			byName[name] = om
+			metrics = append(metrics, om)
+		} else if otlpMetricType(om.Sum) != otlpMetricType(sum) {
+			log.Warn("metric %s is reported both as %s and %s, dropping the %s data point", om.Name, otlpMetricType(om.Sum), otlpMetricType(sum), otlpMetricType(sum))
+			return
+		}
+		if om.Sum != nil {
+			om.Sum.DataPoints = append(om.Sum.DataPoints, dataPoint)
+		} else {
+			om.Gauge.DataPoints = append(om.Gauge.DataPoints, dataPoint)
+		}
+	}
+
+	for _, set := range e.sets {
+		readings.collected(set)
+		dataPointAttributes := otlpAttributes(set.attributes)
+		timestamp := strconv.FormatInt(set.timestamp.UnixNano(), 10)
+		if set.failed() {
+			add("collectionError", nil, otlpDataPoint{Attributes: dataPointAttributes, TimeUnixNano: timestamp, AsDouble: 1})
+			continue
+		}
+		for _, m := range set.metrics {
+			dataPoint := otlpDataPoint{Attributes: dataPointAttributes, TimeUnixNano: timestamp, AsDouble: m.value}
+			switch {
+			case m.counter:
+				dataPoint.StartTimeUnixNano = strconv.FormatInt(start.UnixNano(), 10)
+				add(m.name, &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}, dataPoint)
+			case m.sourceType == metric.DELTA, m.sourceType == metric.PDELTA, m.sourceType == metric.RATE, m.sourceType == metric.PRATE:
+				previous, ok := readings.swap(otlpReadingKey(e, set, m.name), otlpReading{Value: m.value, TimeUnixNano: set.timestamp.UnixNano()})
+				if !ok {
+					continue
+				}
+				delta := m.value - previous.Value
+				positive := m.sourceType == metric.PDELTA || m.sourceType == metric.PRATE
+				if delta < 0 && positive {
+					log.Debug("metric %s of %s went backwards, skipping its data point", m.name, e.name)
+					continue
+				}
+				if m.sourceType == metric.DELTA || m.sourceType == metric.PDELTA {
+					dataPoint.AsDouble = delta
+					dataPoint.StartTimeUnixNano = strconv.FormatInt(previous.TimeUnixNano, 10)
+					add(m.name, &otlpSum{AggregationTemporality: otlpDelta, IsMonotonic: positive}, dataPoint)
+					continue
+				}
+				elapsed := time.Duration(set.timestamp.UnixNano() - previous.TimeUnixNano).Seconds()
+				if elapsed <= 0 {
+					continue
+				}
+				dataPoint.AsDouble = delta / elapsed
+				add(m.name, nil, dataPoint)
+			default:
+				add(m.name, nil, dataPoint)
+			}
+		}
+	}
+	resource.ScopeMetrics = []*otlpScopeMetrics{{
+		Scope:   otlpScope{Name: integrationName, Version: integrationVersion},
+		Metrics: metrics,
+	}}
+	return resource
+}
+
+// otlpMetricType describes the type of an OTLP metric, a gauge when sum is nil
+func otlpMetricType(sum *otlpSum) string {
+	switch {
+	case sum == nil:
+		return "gauge"
+	case sum.AggregationTemporality == otlpDelta:
+		return fmt.Sprintf("delta sum (monotonic: %t)", sum.IsMonotonic)
+	default:
+		return fmt.Sprintf("cumulative sum (monotonic: %t)", sum.IsMonotonic)
+	}
+}
+
+// otlpStartTime returns the start time of the cumulative sums of the target,
+// the time it last started as told by its uptime or the start of the process
+// when the uptime is unknown. The start time of the previous runs is kept
+// while the target doesn't restart so that it doesn't move with the latency
+// of the probes.
+func otlpStartTime(state persist.Storer, uptime *sysUpTime) time.Time {
+	if uptime == nil {
+		return processStart
+	}
+	boot := uptime.bootTime()
+	var previous int64
+	if _, err := state.Get(otlpStartTimeKey, &previous); err == nil {
+		if drift := boot.Sub(time.Unix(0, previous)); drift > -otlpStartTimeTolerance && drift < otlpStartTimeTolerance {
+			return time.Unix(0, previous)
+		}
+	}
+	state.Set(otlpStartTimeKey, boot.UnixNano())
+	return boot
+}
+
+// otlpReadings holds the readings of the delta and rate metrics of the
+// previous runs and of the current one
+type otlpReadings struct {
+	values map[string]otlpReading
+	// seen are the keys read in the current run
+	seen map[string]bool
+	// scopes are the metric sets collected in the current run
+	scopes map[string]bool
+}
+
+func loadOTLPReadings(state persist.Storer) *otlpReadings {
+	r := &otlpReadings{values: make(map[string]otlpReading), seen: make(map[string]bool), scopes: make(map[string]bool)}
+	if _, err := state.Get(otlpReadingsKey, &r.values); err != nil || r.values == nil {
+		r.values = make(map[string]otlpReading)
+	}
+	return r
+}
+
+// collected marks the metric set of a sample as collected in the current run
+func (r *otlpReadings) collected(set *recordedSet) {
+	r.scopes[otlpReadingScope(set)] = true
+}
+
+// swap stores the current reading of a metric and returns the previous one,
+// ok is false when there is none
+func (r *otlpReadings) swap(key string, current otlpReading) (otlpReading, bool) {
+	previous, ok := r.values[key]
+	r.values[key] = current
+	r.seen[key] = true
+	return previous, ok
+}
+
+// save keeps the readings in state. The readings of the metric sets collected
+// in the run that were not read again, such as rows that went away, are dropped.
+func (r *otlpReadings) save(state persist.Storer) {
+	for key := range r.values {
+		if r.seen[key] {
+			continue
+		}
+		for scope := range r.scopes {
+			if strings.HasPrefix(key, scope) {
+				delete(r.values, key)
+				break
+			}
+		}
+	}
+	state.Set(otlpReadingsKey, r.values)
+}
+
+// otlpReadingScope identifies the metric set of a sample by its device and name
+func otlpReadingScope(set *recordedSet) string {
+	return set.attributes["device"] + "|" + set.attributes["name"] + "|"
+}
+
+// otlpReadingKey identifies a delta or rate metric by its metric set, entity,
+// event type, row index and name. The other attributes of the sample can
+// change without resetting the reading.
+func otlpReadingKey(e *recordedEntity, set *recordedSet, name string) string {
+	return otlpReadingScope(set) + e.key + "|" + set.eventType + "|" + set.attributes["index"] + "|" + name
+}
+
+// otlpAttributes converts an attribute map into OTLP key values sorted by key
+func otlpAttributes(attributes map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	keyValues := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		keyValues = append(keyValues, otlpAttribute(k, attributes[k]))
+	}
+	return keyValues
+}
+
+func otlpAttribute(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: value}}
+}
@@ -0,0 +1,288 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCollector records the OTLP requests it receives
+type fakeCollector struct {
+	requests [][]byte
+	headers  []http.Header
+	status   int
+}
+
+func (c *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil || !json.Valid(body) {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	c.requests = append(c.requests, body)
+	c.headers = append(c.headers, r.Header)
+	if c.status != 0 {
+		http.Error(w, "rejected", c.status)
+	}
+}
+
+func TestOTLPSink(t *testing.T) {
+	collector := &fakeCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, []attribute.Attribute{attribute.Attr("sysName", "core-sw-01")})
+	assert.NoError(t, err)
+	output, err := newOTLPSink(recorder, server.URL+"/v1/metrics", "api-key=secret", time.Second)
+	assert.NoError(t, err)
+	output.state = persist.NewInMemoryStore()
+	device := output.Writer()
+	defer func(uptime *sysUpTime) { theSysUpTime = uptime }(theSysUpTime)
+	readAt := time.Now()
+	theSysUpTime = &sysUpTime{ticks: 360000, readAt: readAt}
+	boot := readAt.Add(-time.Hour)
+
+	ms := device.NewMetricSet("SNMPInterfaceSample", attribute.Attr("index", "1"))
+	assert.NoError(t, createMetric("ifInOctets", -1, gosnmp.SnmpPDU{Type: gosnmp.Counter64, Value: uint64(1024)}, ms))
+	assert.NoError(t, createMetric("ifOutOctets", metric.RATE, gosnmp.SnmpPDU{Type: gosnmp.Counter64, Value: uint64(512)}, ms))
+	assert.NoError(t, createMetric("ifOperStatus", -1, gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 1}, ms))
+	assert.NoError(t, createMetric("ifDescr", -1, gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte("Gi1/0/1")}, ms))
+
+	row, err := device.RowWriter(&rowEntity{name: "${device}/${ifName}", entityType: "snmp-interface"}, "2", map[string]string{"ifName": "Gi1/0/2"})
+	assert.NoError(t, err)
+	assert.NoError(t, row.NewMetricSet("SNMPInterfaceSample").SetMetric("ifInErrors", 3, metric.GAUGE))
+
+	assert.NoError(t, output.Publish())
+	if len(collector.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(collector.requests))
+	}
+	assert.Equal(t, "secret", collector.headers[0].Get("api-key"))
+	assert.Equal(t, "application/json", collector.headers[0].Get("Content-Type"))
+
+	var request otlpTestRequest
+	assert.NoError(t, json.Unmarshal(collector.requests[0], &request))
+	if len(request.ResourceMetrics) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(request.ResourceMetrics))
+	}
+
+	deviceResource := request.ResourceMetrics[0]
+	assert.Equal(t, map[string]string{"entity.name": "core-sw-01", "entity.type": "snmp-device"}, deviceResource.Resource.attributes())
+	metrics := deviceResource.ScopeMetrics[0].Metrics
+	assert.Equal(t, integrationName, deviceResource.ScopeMetrics[0].Scope.Name)
+	// The rate has no previous reading to be computed from
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics, got %d", len(metrics))
+	}
+	// Counters are cumulative sums starting when the device started
+	assert.Equal(t, "snmp.ifInOctets", metrics[0].Name)
+	assert.True(t, metrics[0].Sum.IsMonotonic)
+	assert.Equal(t, otlpCumulative, metrics[0].Sum.AggregationTemporality)
+	assert.Equal(t, float64(1024), metrics[0].Sum.DataPoints[0].AsDouble)
+	assert.Equal(t, strconv.FormatInt(boot.UnixNano(), 10), metrics[0].Sum.DataPoints[0].StartTimeUnixNano)
+	// Attributes set after a data point still end up on it
+	assert.Equal(t, map[string]string{"sysName": "core-sw-01", "index": "1", "ifDescr": "Gi1/0/1"}, metrics[0].Sum.DataPoints[0].attributes())
+	assert.Equal(t, "snmp.ifOperStatus", metrics[1].Name)
+	assert.Nil(t, metrics[1].Sum)
+	assert.Equal(t, float64(1), metrics[1].Gauge.DataPoints[0].AsDouble)
+
+	rowResource := request.ResourceMetrics[1]
+	assert.Equal(t, map[string]string{
+		"entity.name":        "core-sw-01/Gi1/0/2",
+		"entity.type":        "snmp-interface",
+		"parent.entity.name": "core-sw-01",
+		"index":              "2",
+		"ifName":             "Gi1/0/2",
+	}, rowResource.Resource.attributes())
+	assert.Equal(t, map[string]string{"sysName": "core-sw-01"}, rowResource.ScopeMetrics[0].Metrics[0].Gauge.DataPoints[0].attributes())
+}
+
+func TestOTLPResourceMetrics_DeltaAndRate(t *testing.T) {
+	state := persist.NewInMemoryStore()
+	first := time.Unix(1600000000, 0)
+	poll := func(at time.Time, octets, errors, discards int) []*otlpMetric {
+		recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, nil)
+		assert.NoError(t, err)
+		ms := recorder.Writer().NewMetricSet("SNMPInterfaceSample", attribute.Attr("index", "1"))
+		assert.NoError(t, ms.SetMetric("ifInOctets", octets, metric.PRATE))
+		assert.NoError(t, ms.SetMetric("ifInErrors", errors, metric.PDELTA))
+		assert.NoError(t, ms.SetMetric("ifInDiscards", discards, metric.DELTA))
+		e := recorder.reported()[0]
+		e.sets[0].timestamp = at
+		readings := loadOTLPReadings(state)
+		metrics := newOTLPResourceMetrics(e, readings, processStart).ScopeMetrics[0].Metrics
+		readings.save(state)
+		return metrics
+	}
+
+	// The first reading only sets the base of the next ones
+	assert.Empty(t, poll(first, 1000, 3, 10))
+
+	metrics := poll(first.Add(10*time.Second), 2000, 5, 8)
+	if len(metrics) != 3 {
+		t.Fatalf("expected 3 metrics, got %d", len(metrics))
+	}
+	assert.Equal(t, "snmp.ifInOctets", metrics[0].Name)
+	assert.Nil(t, metrics[0].Sum)
+	assert.Equal(t, float64(100), metrics[0].Gauge.DataPoints[0].AsDouble)
+	assert.Equal(t, "snmp.ifInErrors", metrics[1].Name)
+	assert.Equal(t, otlpDelta, metrics[1].Sum.AggregationTemporality)
+	assert.True(t, metrics[1].Sum.IsMonotonic)
+	assert.Equal(t, float64(2), metrics[1].Sum.DataPoints[0].AsDouble)
+	assert.Equal(t, strconv.FormatInt(first.UnixNano(), 10), metrics[1].Sum.DataPoints[0].StartTimeUnixNano)
+	assert.False(t, metrics[2].Sum.IsMonotonic)
+	assert.Equal(t, float64(-2), metrics[2].Sum.DataPoints[0].AsDouble)
+
+	// Positive metrics going backwards are left out
+	metrics = poll(first.Add(20*time.Second), 500, 1, 8)
+	if assert.Len(t, metrics, 1) {
+		assert.Equal(t, "snmp.ifInDiscards", metrics[0].Name)
+	}
+}
+
+func TestOTLPReadings(t *testing.T) {
+	state := persist.NewInMemoryStore()
+	first := time.Unix(1600000000, 0)
+	poll := func(at time.Time, set string, rows map[string]string) int {
+		recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, nil)
+		assert.NoError(t, err)
+		for index, status := range rows {
+			ms := recorder.Writer().NewMetricSet("SNMPInterfaceSample",
+				attribute.Attr("device", "core"), attribute.Attr("name", set), attribute.Attr("index", index), attribute.Attr("ifAlias", status))
+			assert.NoError(t, ms.SetMetric("ifInOctets", 1000, metric.PRATE))
+		}
+		e := recorder.reported()[0]
+		for _, s := range e.sets {
+			s.timestamp = at
+		}
+		readings := loadOTLPReadings(state)
+		metrics := newOTLPResourceMetrics(e, readings, processStart).ScopeMetrics[0].Metrics
+		readings.save(state)
+		if len(metrics) == 0 {
+			return 0
+		}
+		return len(metrics[0].Gauge.DataPoints)
+	}
+	stored := func() map[string]otlpReading {
+		var values map[string]otlpReading
+		_, err := state.Get(otlpReadingsKey, &values)
+		assert.NoError(t, err)
+		return values
+	}
+
+	assert.Equal(t, 0, poll(first, "interfaces", map[string]string{"1": "uplink", "2": "spare"}))
+	assert.Equal(t, 0, poll(first, "storage", map[string]string{"1": ""}))
+	assert.Len(t, stored(), 3)
+
+	// A change of a string attribute doesn't reset the reading
+	assert.Equal(t, 1, poll(first.Add(time.Minute), "interfaces", map[string]string{"1": "uplink to core-02"}))
+	// The row that went away is dropped, the metric sets not collected are kept
+	values := stored()
+	assert.Len(t, values, 2)
+	for key := range values {
+		assert.NotContains(t, key, "|2|")
+	}
+}
+
+func TestOTLPResourceMetrics_TypeConflict(t *testing.T) {
+	recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, nil)
+	assert.NoError(t, err)
+	writer := recorder.Writer()
+	assert.NoError(t, writer.NewMetricSet("A").SetMetric("value", 1, metric.GAUGE))
+	assert.NoError(t, createMetric("value", -1, gosnmp.SnmpPDU{Type: gosnmp.Counter32, Value: uint(2)}, writer.NewMetricSet("B")))
+
+	metrics := newOTLPResourceMetrics(recorder.reported()[0], loadOTLPReadings(persist.NewInMemoryStore()), processStart).ScopeMetrics[0].Metrics
+	if assert.Len(t, metrics, 1) {
+		assert.Nil(t, metrics[0].Sum)
+		assert.Len(t, metrics[0].Gauge.DataPoints, 1)
+	}
+}
+
+func TestOTLPStartTime(t *testing.T) {
+	state := persist.NewInMemoryStore()
+	readAt := time.Unix(1600000000, 0)
+	assert.Equal(t, processStart, otlpStartTime(state, nil))
+
+	boot := otlpStartTime(state, &sysUpTime{ticks: 100000, readAt: readAt})
+	assert.Equal(t, readAt.Add(-1000*time.Second).UnixNano(), boot.UnixNano())
+	// The latency of the probe doesn't move the start time
+	assert.Equal(t, boot.UnixNano(), otlpStartTime(state, &sysUpTime{ticks: 200000, readAt: readAt.Add(1000*time.Second + 30*time.Millisecond)}).UnixNano())
+	// A restart does
+	restart := otlpStartTime(state, &sysUpTime{ticks: 500, readAt: readAt.Add(time.Hour)})
+	assert.Equal(t, readAt.Add(time.Hour-5*time.Second).UnixNano(), restart.UnixNano())
+}
+
+func TestOTLPSink_Rejected(t *testing.T) {
+	collector := &fakeCollector{status: http.StatusUnauthorized}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, nil)
+	assert.NoError(t, err)
+	output, err := newOTLPSink(recorder, server.URL, "", time.Second)
+	assert.NoError(t, err)
+	device := output.Writer()
+
+	// Nothing is sent without samples
+	assert.NoError(t, output.Publish())
+	assert.Empty(t, collector.requests)
+
+	failed := device.NewMetricSet("SNMPSample")
+	assert.NoError(t, failed.SetMetric("errorCode", "SNMPError", metric.ATTRIBUTE))
+	assert.Error(t, output.Publish())
+	assert.Len(t, collector.requests, 1)
+
+	_, err = newOTLPSink(recorder, server.URL, "api-key", time.Second)
+	assert.Error(t, err)
+}
+
+type otlpTestRequest struct {
+	ResourceMetrics []struct {
+		Resource     otlpTestAttributes `json:"resource"`
+		ScopeMetrics []struct {
+			Scope   otlpScope `json:"scope"`
+			Metrics []struct {
+				Name  string `json:"name"`
+				Gauge *struct {
+					DataPoints []otlpTestDataPoint `json:"dataPoints"`
+				} `json:"gauge"`
+				Sum *struct {
+					DataPoints             []otlpTestDataPoint `json:"dataPoints"`
+					AggregationTemporality int                 `json:"aggregationTemporality"`
+					IsMonotonic            bool                `json:"isMonotonic"`
+				} `json:"sum"`
+			} `json:"metrics"`
+		} `json:"scopeMetrics"`
+	} `json:"resourceMetrics"`
+}
+
+type otlpTestAttributes struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+func (a otlpTestAttributes) attributes() map[string]string {
+	attributes := make(map[string]string)
+	for _, kv := range a.Attributes {
+		attributes[kv.Key] = kv.Value.StringValue
+	}
+	return attributes
+}
+
+type otlpTestDataPoint struct {
+	otlpTestAttributes
+	StartTimeUnixNano string  `json:"startTimeUnixNano"`
+	TimeUnixNano      string  `json:"timeUnixNano"`
+	AsDouble          float64 `json:"asDouble"`
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/newrelic/infra-integrations-sdk/log"
+)
+
+// sink receives the samples of a run through its writer and delivers them
+// once all the collections have been polled
+type sink interface {
+	// Writer returns the writer for the samples of the device
+	Writer() sampleWriter
+	Publish() error
+}
+
+// sinkOrder is the order in which the sinks of a run are published
+var sinkOrder = []string{outputEvent, outputDimensional, outputOTLP, outputJSONLines}
+
+// metricSetter is the part of metric.Set that createMetric writes values into
+type metricSetter interface {
+	SetMetric(name string, value interface{}, sourceType metric.SourceType) error
+}
+
+// counterSetter is implemented by the metric sets of sinks that report the raw
+// value of a counter PDU as a counter instead of a gauge
+type counterSetter interface {
+	SetCounter(name string, value interface{}) error
+}
+
+// setCounter writes the raw value of a counter PDU read with the auto metric
+// type, as a gauge into the sinks that don't tell counters apart
+func setCounter(ms metricSetter, name string, value interface{}) error {
+	if cs, ok := ms.(counterSetter); ok {
+		return cs.SetCounter(name, value)
+	}
+	return ms.SetMetric(name, value, metric.GAUGE)
+}
+
+// sampleWriter receives the samples produced by the metric set collectors
+type sampleWriter interface {
+	// NewMetricSet starts a new sample identified by the given attributes
+	NewMetricSet(eventType string, attributes ...attribute.Attribute) metricSetter
+	// RowWriter returns the writer for the entity created for a table row
+	RowWriter(def *rowEntity, indexKey string, indexValues map[string]string) (sampleWriter, error)
+	// SetInventoryItem sets a field of an inventory item of the entity
+	SetInventoryItem(category, name string, value interface{}) error
+}
+
+// sdkSink reports samples as event samples of the integrations SDK payload
+type sdkSink struct {
+	integration *integration.Integration
+	entity      *integration.Entity
+	// attributes are the attributes of the device, added to the samples of the
+	// device and of its row entities
+	attributes []attribute.Attribute
+}
+
+func (s *sdkSink) Writer() sampleWriter {
+	return &sdkWriter{integration: s.integration, entity: s.entity, attributes: s.attributes}
+}
+
+func (s *sdkSink) Publish() error {
+	return s.integration.Publish()
+}
+
+// sdkWriter writes samples as metric sets of an integrations SDK entity
+type sdkWriter struct {
+	integration *integration.Integration
+	entity      *integration.Entity
+	attributes  []attribute.Attribute
+}
+
+// NewMetricSet merges the attributes of the device, those of the target first,
+// with the attributes of the sample, which take precedence
+func (w *sdkWriter) NewMetricSet(eventType string, attributes ...attribute.Attribute) metricSetter {
+	return w.entity.NewMetricSet(eventType, mergeAttributes(w.attributes, attributes)...)
+}
+
+func (w *sdkWriter) RowWriter(def *rowEntity, indexKey string, indexValues map[string]string) (sampleWriter, error) {
+	rowEntity, err := newRowEntity(w.integration, w.entity, def, indexKey, indexValues)
+	if err != nil {
+		return nil, err
+	}
+	return &sdkWriter{integration: w.integration, entity: rowEntity, attributes: w.attributes}, nil
+}
+
+func (w *sdkWriter) SetInventoryItem(category, name string, value interface{}) error {
+	return w.entity.SetInventoryItem(category, name, value)
+}
+
+// newSinks returns the sinks of the configured outputs by output name. The
+// event sink reports through the SDK, the others record the samples of the
+// device entity and render them when published. Inventory and topology are
+// written into the event sink. The event and dimensional sinks both write to
+// stdout, each payload on a line of its own.
+func newSinks(i *integration.Integration, entity *integration.Entity, attributes []attribute.Attribute) (map[string]sink, error) {
+	newRecorder := func() (*sampleRecorder, error) {
+		return newSampleRecorder(entity.Metadata.Name, entity.Metadata.Namespace, entity.Metadata.IDAttrs, attributes)
+	}
+	sinks := map[string]sink{
+		outputEvent: &sdkSink{integration: i, entity: entity, attributes: attributes},
+	}
+
+	recorder, err := newRecorder()
+	if err != nil {
+		return nil, err
+	}
+	sinks[outputDimensional] = &dimensionalSink{sampleRecorder: recorder, out: os.Stdout}
+
+	if args.OTLPEndpoint != "" {
+		recorder, err := newRecorder()
+		if err != nil {
+			return nil, err
+		}
+		sinks[outputOTLP], err = newOTLPSink(recorder, args.OTLPEndpoint, args.OTLPHeaders, time.Duration(args.Timeout)*time.Second)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if args.JSONLinesFile != "" {
+		recorder, err := newRecorder()
+		if err != nil {
+			return nil, err
+		}
+		sinks[outputJSONLines] = &jsonLinesSink{sampleRecorder: recorder, path: args.JSONLinesFile}
+	}
+	return sinks, nil
+}
+
+// publishSinks publishes every sink, logging the sinks that fail
+func publishSinks(sinks map[string]sink) {
+	for _, name := range sinkOrder {
+		s, ok := sinks[name]
+		if !ok {
+			continue
+		}
+		if err := s.Publish(); err != nil {
+			log.Error("unable to publish %s output. %v", name, err)
+		}
+	}
+}
+
+// numericValue converts the numeric values produced by createMetric into a float
+func numericValue(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	case int:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("unsupported value type %T for a metric", value)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSDKSink_RowEntityAttributes(t *testing.T) {
+	defer restoreTarget()()
+	targetHost, targetPort = "192.0.2.10", 161
+	args.EntityName, args.EntityType, args.Attributes = "$sysName", "snmp-device", "site=ams1"
+
+	i, err := integration.New("test", "0.0.0", integration.InMemoryStore(), integration.Writer(ioutil.Discard))
+	assert.NoError(t, err)
+	identity := map[string]string{"host": "192.0.2.10", "port": "161", "sysName": "core-sw-01"}
+	attributes, err := deviceAttributes(identity)
+	assert.NoError(t, err)
+	entity, err := newDeviceEntity(i, identity)
+	assert.NoError(t, err)
+	sinks, err := newSinks(i, entity, attributes)
+	assert.NoError(t, err)
+
+	row, err := sinks[outputEvent].Writer().RowWriter(&rowEntity{name: "${device}/${ifName}", entityType: "snmp-interface"}, "2", map[string]string{"ifName": "Gi1/0/2"})
+	assert.NoError(t, err)
+	row.NewMetricSet("SNMPInterfaceSample", attribute.Attr("name", "ifTable"), attribute.Attr("index", "2"))
+
+	// The samples of row entities carry the attributes of the device
+	rowEntity, err := i.Entity("core-sw-01/Gi1/0/2", "snmp-interface",
+		integration.NewIDAttribute("index", "2"), integration.NewIDAttribute("ifName", "Gi1/0/2"))
+	assert.NoError(t, err)
+	if assert.Len(t, rowEntity.Metrics, 1) {
+		metrics := rowEntity.Metrics[0].Metrics
+		assert.Equal(t, "192.0.2.10:161", metrics["targetAddress"])
+		assert.Equal(t, "core-sw-01", metrics["sysName"])
+		assert.Equal(t, "ams1", metrics["site"])
+		assert.Equal(t, "ifTable", metrics["name"])
+		assert.Equal(t, "2", metrics["index"])
+	}
+}
+
+func TestAttributePrecedence(t *testing.T) {
+	defer restoreTarget()()
+	targetHost, targetPort = "192.0.2.10", 161
+	args.EntityName, args.EntityType = "${host}:${port}", "snmp-device"
+	args.Attributes = "site=target,environment=target,owner=target"
+	dir, err := ioutil.TempDir("", "nri-snmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	args.JSONLinesFile = filepath.Join(dir, "samples.jsonl")
+
+	c, err := unmarshalCollection([]byte(`
+collect:
+- device: core
+  attributes:
+    site: collection
+    environment: collection
+  metric_sets:
+  - name: system
+    type: scalar
+    event_type: SNMPSample
+    attributes:
+      site: metric-set
+    metrics:
+    - metric_name: sysUpTime
+      oid: .1.3.6.1.2.1.1.3.0
+`))
+	assert.NoError(t, err)
+	collections, err := parseCollection(c)
+	assert.NoError(t, err)
+	defer simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public"}, simulatorConfig{},
+		simulatedData(gosnmp.SnmpPDU{Name: sysUpTimeOid, Type: gosnmp.TimeTicks, Value: uint32(8745123)}))()
+
+	i, err := integration.New("test", "0.0.0", integration.InMemoryStore(), integration.Writer(ioutil.Discard))
+	assert.NoError(t, err)
+	identity := baseIdentity()
+	attributes, err := deviceAttributes(identity)
+	assert.NoError(t, err)
+	entity, err := newDeviceEntity(i, identity)
+	assert.NoError(t, err)
+	sinks, err := newSinks(i, entity, attributes)
+	assert.NoError(t, err)
+	collectMetricSets(collections[0], sinks[outputEvent].Writer())
+	collectMetricSets(collections[0], sinks[outputJSONLines].Writer())
+	assert.NoError(t, sinks[outputJSONLines].Publish())
+
+	// The metric set overrides the collection, which overrides the target
+	expected := map[string]string{"site": "metric-set", "environment": "collection", "owner": "target"}
+	if assert.Len(t, entity.Metrics, 1) {
+		for k, v := range expected {
+			assert.Equal(t, v, entity.Metrics[0].Metrics[k], k)
+		}
+		assert.Equal(t, "system", entity.Metrics[0].Metrics["name"])
+	}
+	content, err := ioutil.ReadFile(args.JSONLinesFile)
+	assert.NoError(t, err)
+	var sample jsonLinesSample
+	assert.NoError(t, json.Unmarshal(content, &sample))
+	for k, v := range expected {
+		assert.Equal(t, v, sample.Attributes[k], k)
+	}
+	assert.Equal(t, "system", sample.Attributes["name"])
+}
+
+func TestReservedAttributes(t *testing.T) {
+	defer restoreTarget()()
+	args.Attributes = "index=1"
+	_, err := deviceAttributes(nil)
+	assert.EqualError(t, err, "invalid attributes: attribute index is reserved")
+
+	for _, document := range []string{`
+collect:
+- device: core
+  attributes:
+    device: edge
+`, `
+collect:
+- device: core
+  metric_sets:
+  - name: system
+    type: scalar
+    event_type: SNMPSample
+    attributes:
+      name: uplinks
+`} {
+		c, err := unmarshalCollection([]byte(document))
+		assert.NoError(t, err)
+		_, err = parseCollection(c)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "is reserved")
+	}
+}
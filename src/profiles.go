@@ -0,0 +1,45 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// bundledProfiles maps the name used in the `profiles` argument to a
+// collection definition shipped inside the binary. Profiles use exactly
+// the same format as user supplied collection files.
+var bundledProfiles = map[string]string{
+	"if-mib":             ifMibProfile,
+	"host-resources-mib": hostResourcesMibProfile,
+	"entity-sensor-mib":  entitySensorMibProfile,
+	"ucd-snmp-mib":       ucdSnmpMibProfile,
+	"ip-mib":             ipMibProfile,
+	"cisco":              ciscoProfile,
+	"juniper":            juniperProfile,
+	"arista":             aristaProfile,
+	"apc-ups":            apcUpsProfile,
+	"hp-printer":         hpPrinterProfile,
+}
+
+// profileNames returns the names of all bundled profiles in alphabetical order
+func profileNames() []string {
+	names := make([]string, 0, len(bundledProfiles))
+	for name := range bundledProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseProfile looks up a bundled profile by name and parses it into a collectionParser
+func parseProfile(name string) (*collectionParser, error) {
+	profile, ok := bundledProfiles[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %s. valid profiles are: %s", name, strings.Join(profileNames(), ", "))
+	}
+	return unmarshalCollection([]byte(profile))
+}
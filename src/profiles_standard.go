@@ -0,0 +1,314 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+// Collection definitions for standard MIBs implemented by most agents
+
+const ifMibProfile = `
+collect:
+- device: IF-MIB
+  metric_sets:
+  - name: interfaces
+    type: scalar
+    event_type: SNMPSample
+    metrics:
+    - metric_name: ifNumber
+      oid: .1.3.6.1.2.1.2.1.0
+  - name: ifTable
+    type: table
+    event_type: SNMPInterfaceSample
+    root_oid: .1.3.6.1.2.1.2.2.1
+    index:
+    - metric_name: ifDescr
+      oid: .1.3.6.1.2.1.2.2.1.2
+    metrics:
+    - metric_name: ifType
+      oid: .1.3.6.1.2.1.2.2.1.3
+      metric_type: attribute
+    - metric_name: ifMtu
+      oid: .1.3.6.1.2.1.2.2.1.4
+    - metric_name: ifSpeed
+      oid: .1.3.6.1.2.1.2.2.1.5
+    - metric_name: ifAdminStatus
+      oid: .1.3.6.1.2.1.2.2.1.7
+    - metric_name: ifOperStatus
+      oid: .1.3.6.1.2.1.2.2.1.8
+    - metric_name: ifInOctetsPerSecond
+      oid: .1.3.6.1.2.1.2.2.1.10
+      metric_type: prate
+    - metric_name: ifInDiscardsPerSecond
+      oid: .1.3.6.1.2.1.2.2.1.13
+      metric_type: prate
+    - metric_name: ifInErrorsPerSecond
+      oid: .1.3.6.1.2.1.2.2.1.14
+      metric_type: prate
+    - metric_name: ifOutOctetsPerSecond
+      oid: .1.3.6.1.2.1.2.2.1.16
+      metric_type: prate
+    - metric_name: ifOutDiscardsPerSecond
+      oid: .1.3.6.1.2.1.2.2.1.19
+      metric_type: prate
+    - metric_name: ifOutErrorsPerSecond
+      oid: .1.3.6.1.2.1.2.2.1.20
+      metric_type: prate
+  - name: ifXTable
+    type: table
+    event_type: SNMPInterfaceSample
+    root_oid: .1.3.6.1.2.1.31.1.1.1
+    index:
+    - metric_name: ifName
+      oid: .1.3.6.1.2.1.31.1.1.1.1
+    - metric_name: ifAlias
+      oid: .1.3.6.1.2.1.31.1.1.1.18
+    metrics:
+    - metric_name: ifHCInOctetsPerSecond
+      oid: .1.3.6.1.2.1.31.1.1.1.6
+      metric_type: prate
+    - metric_name: ifHCInUcastPktsPerSecond
+      oid: .1.3.6.1.2.1.31.1.1.1.7
+      metric_type: prate
+    - metric_name: ifHCInMulticastPktsPerSecond
+      oid: .1.3.6.1.2.1.31.1.1.1.8
+      metric_type: prate
+    - metric_name: ifHCInBroadcastPktsPerSecond
+      oid: .1.3.6.1.2.1.31.1.1.1.9
+      metric_type: prate
+    - metric_name: ifHCOutOctetsPerSecond
+      oid: .1.3.6.1.2.1.31.1.1.1.10
+      metric_type: prate
+    - metric_name: ifHCOutUcastPktsPerSecond
+      oid: .1.3.6.1.2.1.31.1.1.1.11
+      metric_type: prate
+    - metric_name: ifHCOutMulticastPktsPerSecond
+      oid: .1.3.6.1.2.1.31.1.1.1.12
+      metric_type: prate
+    - metric_name: ifHCOutBroadcastPktsPerSecond
+      oid: .1.3.6.1.2.1.31.1.1.1.13
+      metric_type: prate
+    - metric_name: ifHighSpeed
+      oid: .1.3.6.1.2.1.31.1.1.1.15
+`
+
+const hostResourcesMibProfile = `
+collect:
+- device: HOST-RESOURCES-MIB
+  metric_sets:
+  - name: hrSystem
+    type: scalar
+    event_type: SNMPSample
+    metrics:
+    - metric_name: hrSystemNumUsers
+      oid: .1.3.6.1.2.1.25.1.5.0
+    - metric_name: hrSystemProcesses
+      oid: .1.3.6.1.2.1.25.1.6.0
+    - metric_name: hrSystemMaxProcesses
+      oid: .1.3.6.1.2.1.25.1.7.0
+    - metric_name: hrMemorySize
+      oid: .1.3.6.1.2.1.25.2.2.0
+  - name: hrStorageTable
+    type: table
+    event_type: SNMPStorageSample
+    root_oid: .1.3.6.1.2.1.25.2.3.1
+    index:
+    - metric_name: hrStorageDescr
+      oid: .1.3.6.1.2.1.25.2.3.1.3
+    - metric_name: hrStorageType
+      oid: .1.3.6.1.2.1.25.2.3.1.2
+    metrics:
+    - metric_name: hrStorageAllocationUnits
+      oid: .1.3.6.1.2.1.25.2.3.1.4
+    - metric_name: hrStorageSize
+      oid: .1.3.6.1.2.1.25.2.3.1.5
+    - metric_name: hrStorageUsed
+      oid: .1.3.6.1.2.1.25.2.3.1.6
+    - metric_name: hrStorageAllocationFailures
+      oid: .1.3.6.1.2.1.25.2.3.1.7
+      metric_type: delta
+  - name: hrProcessorTable
+    type: table
+    event_type: SNMPProcessorSample
+    root_oid: .1.3.6.1.2.1.25.3.3.1
+    index:
+    - metric_name: hrProcessorFrwID
+      oid: .1.3.6.1.2.1.25.3.3.1.1
+    metrics:
+    - metric_name: hrProcessorLoad
+      oid: .1.3.6.1.2.1.25.3.3.1.2
+  inventory:
+  - oid: .1.3.6.1.2.1.1.1.0
+    category: system
+    name: sysDescr
+  - oid: .1.3.6.1.2.1.1.2.0
+    category: system
+    name: sysObjectID
+`
+
+const entitySensorMibProfile = `
+collect:
+- device: ENTITY-SENSOR-MIB
+  metric_sets:
+  - name: entPhySensorTable
+    type: table
+    event_type: SNMPSensorSample
+    root_oid: .1.3.6.1.2.1.99.1.1.1
+    index:
+    - metric_name: entPhySensorType
+      oid: .1.3.6.1.2.1.99.1.1.1.1
+    - metric_name: entPhySensorUnitsDisplay
+      oid: .1.3.6.1.2.1.99.1.1.1.6
+    metrics:
+    - metric_name: entPhySensorScale
+      oid: .1.3.6.1.2.1.99.1.1.1.2
+    - metric_name: entPhySensorPrecision
+      oid: .1.3.6.1.2.1.99.1.1.1.3
+    - metric_name: entPhySensorValue
+      oid: .1.3.6.1.2.1.99.1.1.1.4
+    - metric_name: entPhySensorOperStatus
+      oid: .1.3.6.1.2.1.99.1.1.1.5
+`
+
+const ucdSnmpMibProfile = `
+collect:
+- device: UCD-SNMP-MIB
+  metric_sets:
+  - name: memory
+    type: scalar
+    event_type: SNMPSample
+    metrics:
+    - metric_name: memTotalSwap
+      oid: .1.3.6.1.4.1.2021.4.3.0
+    - metric_name: memAvailSwap
+      oid: .1.3.6.1.4.1.2021.4.4.0
+    - metric_name: memTotalReal
+      oid: .1.3.6.1.4.1.2021.4.5.0
+    - metric_name: memAvailReal
+      oid: .1.3.6.1.4.1.2021.4.6.0
+    - metric_name: memTotalFree
+      oid: .1.3.6.1.4.1.2021.4.11.0
+    - metric_name: memShared
+      oid: .1.3.6.1.4.1.2021.4.13.0
+    - metric_name: memBuffer
+      oid: .1.3.6.1.4.1.2021.4.14.0
+    - metric_name: memCached
+      oid: .1.3.6.1.4.1.2021.4.15.0
+  - name: systemStats
+    type: scalar
+    event_type: SNMPSample
+    metrics:
+    - metric_name: ssCpuRawUserPerSecond
+      oid: .1.3.6.1.4.1.2021.11.50.0
+      metric_type: prate
+    - metric_name: ssCpuRawNicePerSecond
+      oid: .1.3.6.1.4.1.2021.11.51.0
+      metric_type: prate
+    - metric_name: ssCpuRawSystemPerSecond
+      oid: .1.3.6.1.4.1.2021.11.52.0
+      metric_type: prate
+    - metric_name: ssCpuRawIdlePerSecond
+      oid: .1.3.6.1.4.1.2021.11.53.0
+      metric_type: prate
+    - metric_name: ssCpuRawWaitPerSecond
+      oid: .1.3.6.1.4.1.2021.11.54.0
+      metric_type: prate
+    - metric_name: ssIORawSentPerSecond
+      oid: .1.3.6.1.4.1.2021.11.57.0
+      metric_type: prate
+    - metric_name: ssIORawReceivedPerSecond
+      oid: .1.3.6.1.4.1.2021.11.58.0
+      metric_type: prate
+    - metric_name: ssRawInterruptsPerSecond
+      oid: .1.3.6.1.4.1.2021.11.59.0
+      metric_type: prate
+    - metric_name: ssRawContextsPerSecond
+      oid: .1.3.6.1.4.1.2021.11.60.0
+      metric_type: prate
+  - name: laTable
+    type: table
+    event_type: SNMPLoadAverageSample
+    root_oid: .1.3.6.1.4.1.2021.10.1
+    index:
+    - metric_name: laNames
+      oid: .1.3.6.1.4.1.2021.10.1.2
+    metrics:
+    - metric_name: laLoadInt
+      oid: .1.3.6.1.4.1.2021.10.1.5
+  - name: dskTable
+    type: table
+    event_type: SNMPDiskSample
+    root_oid: .1.3.6.1.4.1.2021.9.1
+    index:
+    - metric_name: dskPath
+      oid: .1.3.6.1.4.1.2021.9.1.2
+    - metric_name: dskDevice
+      oid: .1.3.6.1.4.1.2021.9.1.3
+    metrics:
+    - metric_name: dskTotal
+      oid: .1.3.6.1.4.1.2021.9.1.6
+    - metric_name: dskAvail
+      oid: .1.3.6.1.4.1.2021.9.1.7
+    - metric_name: dskUsed
+      oid: .1.3.6.1.4.1.2021.9.1.8
+    - metric_name: dskPercent
+      oid: .1.3.6.1.4.1.2021.9.1.9
+`
+
+const ipMibProfile = `
+collect:
+- device: IP-MIB
+  metric_sets:
+  - name: ip
+    type: scalar
+    event_type: SNMPSample
+    metrics:
+    - metric_name: ipForwarding
+      oid: .1.3.6.1.2.1.4.1.0
+    - metric_name: ipDefaultTTL
+      oid: .1.3.6.1.2.1.4.2.0
+    - metric_name: ipInReceivesPerSecond
+      oid: .1.3.6.1.2.1.4.3.0
+      metric_type: prate
+    - metric_name: ipInHdrErrorsPerSecond
+      oid: .1.3.6.1.2.1.4.4.0
+      metric_type: prate
+    - metric_name: ipInAddrErrorsPerSecond
+      oid: .1.3.6.1.2.1.4.5.0
+      metric_type: prate
+    - metric_name: ipForwDatagramsPerSecond
+      oid: .1.3.6.1.2.1.4.6.0
+      metric_type: prate
+    - metric_name: ipInDiscardsPerSecond
+      oid: .1.3.6.1.2.1.4.8.0
+      metric_type: prate
+    - metric_name: ipInDeliversPerSecond
+      oid: .1.3.6.1.2.1.4.9.0
+      metric_type: prate
+    - metric_name: ipOutRequestsPerSecond
+      oid: .1.3.6.1.2.1.4.10.0
+      metric_type: prate
+    - metric_name: ipOutDiscardsPerSecond
+      oid: .1.3.6.1.2.1.4.11.0
+      metric_type: prate
+    - metric_name: ipOutNoRoutesPerSecond
+      oid: .1.3.6.1.2.1.4.12.0
+      metric_type: prate
+    - metric_name: ipReasmFailsPerSecond
+      oid: .1.3.6.1.2.1.4.16.0
+      metric_type: prate
+    - metric_name: ipFragFailsPerSecond
+      oid: .1.3.6.1.2.1.4.18.0
+      metric_type: prate
+  - name: ipAddrTable
+    type: table
+    event_type: SNMPIPAddressSample
+    root_oid: .1.3.6.1.2.1.4.20.1
+    index:
+    - metric_name: ipAdEntAddr
+      oid: .1.3.6.1.2.1.4.20.1.1
+    metrics:
+    - metric_name: ipAdEntIfIndex
+      oid: .1.3.6.1.2.1.4.20.1.2
+      metric_type: attribute
+    - metric_name: ipAdEntNetMask
+      oid: .1.3.6.1.2.1.4.20.1.3
+`
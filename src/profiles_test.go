@@ -0,0 +1,189 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadRecording reads a snmprec formatted file (oid|tag|value) into PDUs keyed
+// by OID. The recordings under testdata are synthetic, written by hand after
+// the MIBs rather than captured from real agents.
+func loadRecording(t *testing.T, path string) map[string]gosnmp.SnmpPDU {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	pdus := make(map[string]gosnmp.SnmpPDU)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "#") {
+			continue
+		}
+		fields := strings.SplitN(scanner.Text(), "|", 3)
+		if len(fields) != 3 {
+			t.Fatalf("malformed line %q in %s", scanner.Text(), path)
+		}
+		pdu := gosnmp.SnmpPDU{Name: "." + fields[0]}
+		switch fields[1] {
+		case "2":
+			pdu.Type = gosnmp.Integer
+			pdu.Value, err = strconv.Atoi(fields[2])
+		case "4":
+			pdu.Type = gosnmp.OctetString
+			pdu.Value = []byte(fields[2])
+		case "4x":
+			pdu.Type = gosnmp.OctetString
+			pdu.Value, err = hex.DecodeString(fields[2])
+		case "6":
+			pdu.Type = gosnmp.ObjectIdentifier
+			pdu.Value = "." + fields[2]
+		case "64":
+			pdu.Type = gosnmp.IPAddress
+			pdu.Value = fields[2]
+		case "65", "66":
+			pdu.Type = gosnmp.Counter32
+			if fields[1] == "66" {
+				pdu.Type = gosnmp.Gauge32
+			}
+			var v uint64
+			v, err = strconv.ParseUint(fields[2], 10, 32)
+			pdu.Value = uint(v)
+		case "67":
+			var v uint64
+			v, err = strconv.ParseUint(fields[2], 10, 32)
+			pdu.Type = gosnmp.TimeTicks
+			pdu.Value = uint32(v)
+		case "70":
+			pdu.Type = gosnmp.Counter64
+			pdu.Value, err = strconv.ParseUint(fields[2], 10, 64)
+		default:
+			t.Fatalf("unsupported tag %s in %s", fields[1], path)
+		}
+		if err != nil {
+			t.Fatalf("invalid value in line %q: %v", scanner.Text(), err)
+		}
+		pdus[pdu.Name] = pdu
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return pdus
+}
+
+func mustParseProfile(t *testing.T, name string) []*collection {
+	t.Helper()
+	parser, err := parseProfile(name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	collections, err := parseCollection(parser)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return collections
+}
+
+func TestBundledProfilesParse(t *testing.T) {
+	for _, name := range profileNames() {
+		collections := mustParseProfile(t, name)
+		if !assert.Len(t, collections, 1, name) {
+			continue
+		}
+
+		col := collections[0]
+		assert.NotEmpty(t, col.Device, name)
+		assert.NotEmpty(t, col.MetricSets, name)
+		for _, ms := range col.MetricSets {
+			assert.NotEmpty(t, ms.Name, name)
+			assert.NotEmpty(t, ms.EventType, "%s: %s", name, ms.Name)
+			assert.NotEmpty(t, ms.Metrics, "%s: %s", name, ms.Name)
+			switch ms.Type {
+			case "scalar":
+			case "table":
+				assert.NotEmpty(t, ms.RootOid, "%s: %s", name, ms.Name)
+				assert.NotEmpty(t, ms.Index, "%s: %s", name, ms.Name)
+				for _, idx := range ms.Index {
+					assert.True(t, strings.HasPrefix(idx.oid, ms.RootOid+"."), "%s: index %s outside of %s", name, idx.oid, ms.RootOid)
+				}
+				for _, m := range ms.Metrics {
+					assert.True(t, strings.HasPrefix(m.oid, ms.RootOid+"."), "%s: metric %s outside of %s", name, m.oid, ms.RootOid)
+				}
+			default:
+				t.Errorf("%s: invalid metric set type %s", name, ms.Type)
+			}
+		}
+	}
+}
+
+func TestParseProfile_Unknown(t *testing.T) {
+	_, err := parseProfile("no-such-profile")
+	assert.Error(t, err)
+}
+
+func TestBundledProfilesAgainstSyntheticRecordings(t *testing.T) {
+	for _, name := range profileNames() {
+		pdus := loadRecording(t, filepath.Join("testdata", "profiles", name+".snmprec"))
+		collections := mustParseProfile(t, name)
+
+		for _, ms := range collections[0].MetricSets {
+			if ms.Type == "scalar" {
+				set := metric.NewSet(ms.EventType, persist.NewInMemoryStore(), attribute.Attr("name", ms.Name))
+				for _, m := range ms.Metrics {
+					pdu, ok := pdus[m.oid]
+					if !assert.True(t, ok, "%s: no recorded value for %s (%s)", name, m.metricName, m.oid) {
+						continue
+					}
+					assert.NoError(t, createMetric(m.metricName, m.metricType, pdu, set), name)
+				}
+				continue
+			}
+
+			rows := make(map[string]bool)
+			for _, idx := range ms.Index {
+				found := false
+				for oid, pdu := range pdus {
+					if !strings.HasPrefix(oid, idx.oid+".") {
+						continue
+					}
+					found = true
+					rows[strings.TrimPrefix(oid, idx.oid+".")] = true
+					_, err := extractIndexValue(pdu)
+					assert.NoError(t, err, "%s: index %s", name, oid)
+				}
+				assert.True(t, found, "%s: no recorded rows for index %s (%s)", name, idx.name, idx.oid)
+			}
+			for row := range rows {
+				set := metric.NewSet(ms.EventType, persist.NewInMemoryStore(), attribute.Attr("index", row))
+				for _, m := range ms.Metrics {
+					pdu, ok := pdus[m.oid+"."+row]
+					if !assert.True(t, ok, "%s: no recorded value for %s row %s", name, m.metricName, row) {
+						continue
+					}
+					assert.NoError(t, createMetric(m.metricName, m.metricType, pdu, set), name)
+				}
+			}
+		}
+
+		for _, item := range collections[0].Inventory {
+			_, ok := pdus[item.oid]
+			assert.True(t, ok, "%s: no recorded value for inventory item %s", name, item.name)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+// Collection definitions for vendor specific MIBs
+
+const ciscoProfile = `
+collect:
+- device: CISCO
+  metric_sets:
+  - name: cpmCPUTotalTable
+    type: table
+    event_type: SNMPCiscoCPUSample
+    root_oid: .1.3.6.1.4.1.9.9.109.1.1.1.1
+    index:
+    - metric_name: cpmCPUTotalPhysicalIndex
+      oid: .1.3.6.1.4.1.9.9.109.1.1.1.1.2
+    metrics:
+    - metric_name: cpmCPUTotal5secRev
+      oid: .1.3.6.1.4.1.9.9.109.1.1.1.1.6
+    - metric_name: cpmCPUTotal1minRev
+      oid: .1.3.6.1.4.1.9.9.109.1.1.1.1.7
+    - metric_name: cpmCPUTotal5minRev
+      oid: .1.3.6.1.4.1.9.9.109.1.1.1.1.8
+    - metric_name: cpmCPUMemoryUsed
+      oid: .1.3.6.1.4.1.9.9.109.1.1.1.1.12
+    - metric_name: cpmCPUMemoryFree
+      oid: .1.3.6.1.4.1.9.9.109.1.1.1.1.13
+  - name: ciscoMemoryPoolTable
+    type: table
+    event_type: SNMPCiscoMemoryPoolSample
+    root_oid: .1.3.6.1.4.1.9.9.48.1.1.1
+    index:
+    - metric_name: ciscoMemoryPoolName
+      oid: .1.3.6.1.4.1.9.9.48.1.1.1.2
+    metrics:
+    - metric_name: ciscoMemoryPoolUsed
+      oid: .1.3.6.1.4.1.9.9.48.1.1.1.5
+    - metric_name: ciscoMemoryPoolFree
+      oid: .1.3.6.1.4.1.9.9.48.1.1.1.6
+    - metric_name: ciscoMemoryPoolLargestFree
+      oid: .1.3.6.1.4.1.9.9.48.1.1.1.7
+  - name: ciscoEnvMonTemperatureStatusTable
+    type: table
+    event_type: SNMPCiscoTemperatureSample
+    root_oid: .1.3.6.1.4.1.9.9.13.1.3.1
+    index:
+    - metric_name: ciscoEnvMonTemperatureStatusDescr
+      oid: .1.3.6.1.4.1.9.9.13.1.3.1.2
+    metrics:
+    - metric_name: ciscoEnvMonTemperatureStatusValue
+      oid: .1.3.6.1.4.1.9.9.13.1.3.1.3
+    - metric_name: ciscoEnvMonTemperatureThreshold
+      oid: .1.3.6.1.4.1.9.9.13.1.3.1.4
+    - metric_name: ciscoEnvMonTemperatureState
+      oid: .1.3.6.1.4.1.9.9.13.1.3.1.6
+  - name: ciscoEnvMonFanStatusTable
+    type: table
+    event_type: SNMPCiscoFanSample
+    root_oid: .1.3.6.1.4.1.9.9.13.1.4.1
+    index:
+    - metric_name: ciscoEnvMonFanStatusDescr
+      oid: .1.3.6.1.4.1.9.9.13.1.4.1.2
+    metrics:
+    - metric_name: ciscoEnvMonFanState
+      oid: .1.3.6.1.4.1.9.9.13.1.4.1.3
+  inventory:
+  - oid: .1.3.6.1.2.1.1.1.0
+    category: system
+    name: sysDescr
+  - oid: .1.3.6.1.2.1.1.2.0
+    category: system
+    name: sysObjectID
+`
+
+const juniperProfile = `
+collect:
+- device: JUNIPER
+  metric_sets:
+  - name: jnxOperatingTable
+    type: table
+    event_type: SNMPJuniperOperatingSample
+    root_oid: .1.3.6.1.4.1.2636.3.1.13.1
+    index:
+    - metric_name: jnxOperatingDescr
+      oid: .1.3.6.1.4.1.2636.3.1.13.1.5
+    metrics:
+    - metric_name: jnxOperatingState
+      oid: .1.3.6.1.4.1.2636.3.1.13.1.6
+    - metric_name: jnxOperatingTemp
+      oid: .1.3.6.1.4.1.2636.3.1.13.1.7
+    - metric_name: jnxOperatingCPU
+      oid: .1.3.6.1.4.1.2636.3.1.13.1.8
+    - metric_name: jnxOperatingBuffer
+      oid: .1.3.6.1.4.1.2636.3.1.13.1.11
+    - metric_name: jnxOperatingHeap
+      oid: .1.3.6.1.4.1.2636.3.1.13.1.12
+  inventory:
+  - oid: .1.3.6.1.4.1.2636.3.1.2.0
+    category: chassis
+    name: jnxBoxDescr
+  - oid: .1.3.6.1.4.1.2636.3.1.3.0
+    category: chassis
+    name: jnxBoxSerialNo
+  - oid: .1.3.6.1.2.1.1.1.0
+    category: system
+    name: sysDescr
+`
+
+// Arista EOS exposes its health data through the standard MIBs, so the profile
+// combines the relevant parts of HOST-RESOURCES-MIB and ENTITY-SENSOR-MIB
+const aristaProfile = `
+collect:
+- device: ARISTA
+  metric_sets:
+  - name: hrProcessorTable
+    type: table
+    event_type: SNMPProcessorSample
+    root_oid: .1.3.6.1.2.1.25.3.3.1
+    index:
+    - metric_name: hrProcessorFrwID
+      oid: .1.3.6.1.2.1.25.3.3.1.1
+    metrics:
+    - metric_name: hrProcessorLoad
+      oid: .1.3.6.1.2.1.25.3.3.1.2
+  - name: hrStorageTable
+    type: table
+    event_type: SNMPStorageSample
+    root_oid: .1.3.6.1.2.1.25.2.3.1
+    index:
+    - metric_name: hrStorageDescr
+      oid: .1.3.6.1.2.1.25.2.3.1.3
+    metrics:
+    - metric_name: hrStorageAllocationUnits
+      oid: .1.3.6.1.2.1.25.2.3.1.4
+    - metric_name: hrStorageSize
+      oid: .1.3.6.1.2.1.25.2.3.1.5
+    - metric_name: hrStorageUsed
+      oid: .1.3.6.1.2.1.25.2.3.1.6
+  - name: entPhySensorTable
+    type: table
+    event_type: SNMPSensorSample
+    root_oid: .1.3.6.1.2.1.99.1.1.1
+    index:
+    - metric_name: entPhySensorType
+      oid: .1.3.6.1.2.1.99.1.1.1.1
+    metrics:
+    - metric_name: entPhySensorScale
+      oid: .1.3.6.1.2.1.99.1.1.1.2
+    - metric_name: entPhySensorPrecision
+      oid: .1.3.6.1.2.1.99.1.1.1.3
+    - metric_name: entPhySensorValue
+      oid: .1.3.6.1.2.1.99.1.1.1.4
+    - metric_name: entPhySensorOperStatus
+      oid: .1.3.6.1.2.1.99.1.1.1.5
+  inventory:
+  - oid: .1.3.6.1.2.1.1.1.0
+    category: system
+    name: sysDescr
+  - oid: .1.3.6.1.2.1.47.1.1.1.1.11.1
+    category: chassis
+    name: entPhysicalSerialNum
+`
+
+const apcUpsProfile = `
+collect:
+- device: PowerNet-MIB
+  metric_sets:
+  - name: ups
+    type: scalar
+    event_type: SNMPUPSSample
+    metrics:
+    - metric_name: upsBasicBatteryStatus
+      oid: .1.3.6.1.4.1.318.1.1.1.2.1.1.0
+    - metric_name: upsAdvBatteryCapacity
+      oid: .1.3.6.1.4.1.318.1.1.1.2.2.1.0
+    - metric_name: upsAdvBatteryTemperature
+      oid: .1.3.6.1.4.1.318.1.1.1.2.2.2.0
+    - metric_name: upsAdvBatteryReplaceIndicator
+      oid: .1.3.6.1.4.1.318.1.1.1.2.2.4.0
+    - metric_name: upsAdvInputLineVoltage
+      oid: .1.3.6.1.4.1.318.1.1.1.3.2.1.0
+    - metric_name: upsAdvInputFrequency
+      oid: .1.3.6.1.4.1.318.1.1.1.3.2.4.0
+    - metric_name: upsBasicOutputStatus
+      oid: .1.3.6.1.4.1.318.1.1.1.4.1.1.0
+    - metric_name: upsAdvOutputVoltage
+      oid: .1.3.6.1.4.1.318.1.1.1.4.2.1.0
+    - metric_name: upsAdvOutputFrequency
+      oid: .1.3.6.1.4.1.318.1.1.1.4.2.2.0
+    - metric_name: upsAdvOutputLoad
+      oid: .1.3.6.1.4.1.318.1.1.1.4.2.3.0
+    - metric_name: upsAdvOutputCurrent
+      oid: .1.3.6.1.4.1.318.1.1.1.4.2.4.0
+  inventory:
+  - oid: .1.3.6.1.4.1.318.1.1.1.1.1.1.0
+    category: ups
+    name: upsBasicIdentModel
+  - oid: .1.3.6.1.4.1.318.1.1.1.1.2.1.0
+    category: ups
+    name: upsAdvIdentFirmwareRevision
+  - oid: .1.3.6.1.4.1.318.1.1.1.1.2.3.0
+    category: ups
+    name: upsAdvIdentSerialNumber
+`
+
+// HP printers implement the standard Printer-MIB (RFC 3805) for supplies and page counts
+const hpPrinterProfile = `
+collect:
+- device: Printer-MIB
+  metric_sets:
+  - name: prtMarkerSuppliesTable
+    type: table
+    event_type: SNMPPrinterSupplySample
+    root_oid: .1.3.6.1.2.1.43.11.1.1
+    index:
+    - metric_name: prtMarkerSuppliesDescription
+      oid: .1.3.6.1.2.1.43.11.1.1.6
+    metrics:
+    - metric_name: prtMarkerSuppliesType
+      oid: .1.3.6.1.2.1.43.11.1.1.5
+      metric_type: attribute
+    - metric_name: prtMarkerSuppliesMaxCapacity
+      oid: .1.3.6.1.2.1.43.11.1.1.8
+    - metric_name: prtMarkerSuppliesLevel
+      oid: .1.3.6.1.2.1.43.11.1.1.9
+  - name: prtMarkerTable
+    type: table
+    event_type: SNMPPrinterMarkerSample
+    root_oid: .1.3.6.1.2.1.43.10.2.1
+    index:
+    - metric_name: prtMarkerMarkTech
+      oid: .1.3.6.1.2.1.43.10.2.1.2
+    metrics:
+    - metric_name: prtMarkerLifeCount
+      oid: .1.3.6.1.2.1.43.10.2.1.4
+  inventory:
+  - oid: .1.3.6.1.2.1.1.1.0
+    category: system
+    name: sysDescr
+  - oid: .1.3.6.1.2.1.43.5.1.1.17.1
+    category: printer
+    name: prtGeneralSerialNumber
+`
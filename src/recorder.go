@@ -0,0 +1,182 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/inventory"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+)
+
+// sampleRecorder keeps the samples written during a run in memory so that
+// sinks can render them in their own format once the run completes
+type sampleRecorder struct {
+	device   *recordedEntity
+	entities []*recordedEntity
+	byKey    map[string]*recordedEntity
+}
+
+// recordedEntity is the device or the entity of a table row
+type recordedEntity struct {
+	name         string
+	entityType   string
+	key          string
+	idAttributes []integration.IDAttribute
+	attributes   []attribute.Attribute
+	// parent is the device reporting a table row, nil for the device itself
+	parent    *recordedEntity
+	sets      []*recordedSet
+	inventory *inventory.Inventory
+}
+
+// recordedSet is a single sample. Its attributes apply to all of its metrics.
+type recordedSet struct {
+	eventType  string
+	timestamp  time.Time
+	attributes map[string]string
+	metrics    []recordedMetric
+}
+
+type recordedMetric struct {
+	name       string
+	sourceType metric.SourceType
+	value      float64
+	// counter is set for the raw value of a counter PDU read with the auto
+	// metric type, whose source type is gauge
+	counter bool
+}
+
+// recordingWriter writes samples into the recorder for an entity
+type recordingWriter struct {
+	recorder *sampleRecorder
+	entity   *recordedEntity
+}
+
+// newSampleRecorder returns a recorder for the samples of the given device entity
+func newSampleRecorder(name, entityType string, idAttributes []integration.IDAttribute, attributes []attribute.Attribute) (*sampleRecorder, error) {
+	r := &sampleRecorder{byKey: make(map[string]*recordedEntity)}
+	device, err := r.entity(name, entityType, idAttributes, attributes, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.device = device
+	return r, nil
+}
+
+// Writer returns the writer for the samples of the device
+func (r *sampleRecorder) Writer() sampleWriter {
+	return &recordingWriter{recorder: r, entity: r.device}
+}
+
+// reported returns the entities with samples or inventory, in the order they were created
+func (r *sampleRecorder) reported() []*recordedEntity {
+	var entities []*recordedEntity
+	for _, e := range r.entities {
+		if len(e.sets) > 0 || len(e.inventory.Items()) > 0 {
+			entities = append(entities, e)
+		}
+	}
+	return entities
+}
+
+// entity returns the recorded entity, creating it the first time
+func (r *sampleRecorder) entity(name, entityType string, idAttributes []integration.IDAttribute, attributes []attribute.Attribute, parent *recordedEntity) (*recordedEntity, error) {
+	metadata := integration.EntityMetadata{Name: name, Namespace: entityType, IDAttrs: idAttributes}
+	key, err := metadata.Key()
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := r.byKey[key.String()]; ok {
+		return e, nil
+	}
+	e := &recordedEntity{
+		name:         name,
+		entityType:   entityType,
+		key:          key.String(),
+		idAttributes: idAttributes,
+		attributes:   attributes,
+		parent:       parent,
+		inventory:    inventory.New(),
+	}
+	r.byKey[e.key] = e
+	r.entities = append(r.entities, e)
+	return e, nil
+}
+
+// inheritedAttributes returns the attributes of the entity preceded by those of its parents
+func (e *recordedEntity) inheritedAttributes() []attribute.Attribute {
+	if e.parent == nil {
+		return e.attributes
+	}
+	return append(append([]attribute.Attribute{}, e.parent.inheritedAttributes()...), e.attributes...)
+}
+
+// NewMetricSet merges the attributes of the entity, those of the device first,
+// with the attributes of the sample, which take precedence
+func (w *recordingWriter) NewMetricSet(eventType string, attributes ...attribute.Attribute) metricSetter {
+	merged := mergeAttributes(w.entity.inheritedAttributes(), attributes)
+	set := &recordedSet{
+		eventType:  eventType,
+		timestamp:  time.Now(),
+		attributes: make(map[string]string, len(merged)),
+	}
+	for _, a := range merged {
+		set.attributes[a.Key] = a.Value
+	}
+	w.entity.sets = append(w.entity.sets, set)
+	return set
+}
+
+func (w *recordingWriter) RowWriter(def *rowEntity, indexKey string, indexValues map[string]string) (sampleWriter, error) {
+	name, idAttributes, err := rowEntityIdentity(w.entity.name, def, indexKey, indexValues)
+	if err != nil {
+		return nil, err
+	}
+	e, err := w.recorder.entity(name, def.entityType, idAttributes, nil, w.entity)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingWriter{recorder: w.recorder, entity: e}, nil
+}
+
+func (w *recordingWriter) SetInventoryItem(category, name string, value interface{}) error {
+	return w.entity.inventory.SetItem(category, name, value)
+}
+
+// SetMetric adds a metric to the set. Attributes apply to all the metrics of the set.
+func (s *recordedSet) SetMetric(name string, value interface{}, sourceType metric.SourceType) error {
+	if sourceType == metric.ATTRIBUTE {
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("non-string source type for attribute %s", name)
+		}
+		s.attributes[name] = v
+		return nil
+	}
+	floatValue, err := numericValue(value)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	s.metrics = append(s.metrics, recordedMetric{name: name, sourceType: sourceType, value: floatValue})
+	return nil
+}
+
+// SetCounter adds the raw value of a counter PDU to the set
+func (s *recordedSet) SetCounter(name string, value interface{}) error {
+	if err := s.SetMetric(name, value, metric.GAUGE); err != nil {
+		return err
+	}
+	s.metrics[len(s.metrics)-1].counter = true
+	return nil
+}
+
+// failed reports whether the set carries an error instead of metrics
+func (s *recordedSet) failed() bool {
+	_, ok := s.attributes["errorCode"]
+	return ok && len(s.metrics) == 0
+}
@@ -4,17 +4,17 @@
 package main
 
 import (
-	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/newrelic/infra-integrations-sdk/data/attribute"
 	"github.com/newrelic/infra-integrations-sdk/data/metric"
-	"github.com/newrelic/infra-integrations-sdk/integration"
 	"github.com/newrelic/infra-integrations-sdk/log"
 	"github.com/soniah/gosnmp"
 )
 
-func populateScalarMetrics(device string, metricSet metricSet, entity *integration.Entity) error {
+func populateScalarMetrics(device string, metricSet metricSet, writer sampleWriter) error {
 	var oids []string
 	oidToMetricMap := make(map[string]*metricDef)
 	for _, metric := range metricSet.Metrics {
@@ -31,35 +31,66 @@ func populateScalarMetrics(device string, metricSet metricSet, entity *integrati
 	if len(oids) == 0 {
 		return nil
 	}
-	if len(oids) > 200 {
-		return fmt.Errorf("Metric Set %s has %d metrics, the current limit is 200. This metric set will not be reported", metricSet.Name, len(oids))
-	}
 
-	ms := entity.NewMetricSet(metricSet.EventType,
+	attributes := append(expandAttributes(metricSet.Attributes, deviceIdentity),
 		attribute.Attr("device", device),
 		attribute.Attr("name", metricSet.Name))
+	ms := writer.NewMetricSet(metricSet.EventType, attributes...)
+
+	// OIDs that failed on previous runs are skipped until they are due to be retried
+	knownBad := loadKnownBadOids()
+	failed := make(map[string]gosnmp.SNMPError)
+	var polled []string
+	for _, oid := range oids {
+		if status, skip := knownBad.skip(oid, time.Now()); skip {
+			log.Debug("skipping OID %s, known to fail with %s", oid, getErrorCode(status))
+			theExplain.skip(oid, "skipped, known to fail with "+getErrorCode(status))
+			failed[oid] = status
+			continue
+		}
+		polled = append(polled, oid)
+	}
 
-	snmpGetResult, err := theSNMP.Get(oids)
+	maxOids := metricSet.MaxOidsPerRequest
+	if maxOids == 0 {
+		maxOids = args.MaxOidsPerRequest
+	}
+	if maxOids <= 0 || maxOids > theSNMP.MaxOids {
+		maxOids = theSNMP.MaxOids
+	}
+	variables, failedStatus, err := getChunked(theClient.Get, polled, maxOids)
 	if err != nil {
 		return err
 	}
+	knownBad.update(polled, failedStatus, time.Now())
+	for oid, status := range failedStatus {
+		log.Warn("OID %s failed on target %s: %s", oid, targetHost, getErrorMessage(status))
+		theExplain.skip(oid, "failed with "+getErrorCode(status))
+		failed[oid] = status
+	}
 
-	// Response received with errors
-	if snmpGetResult.Error != gosnmp.NoError {
-		err = ms.SetMetric("errorCode", getErrorCode(snmpGetResult.Error), metric.ATTRIBUTE)
-		if err != nil {
-			log.Error(err.Error())
+	// Response received with errors. The values of the other OIDs are still reported.
+	if len(failed) > 0 {
+		if len(failed) == len(oids) {
+			err = ms.SetMetric("errorCode", getErrorCode(failed[oids[0]]), metric.ATTRIBUTE)
+			if err != nil {
+				log.Error(err.Error())
+			}
+			err = ms.SetMetric("errorMessage", getErrorMessage(failed[oids[0]]), metric.ATTRIBUTE)
+			if err != nil {
+				log.Error(err.Error())
+			}
 		}
-		err = ms.SetMetric("errorMessage", getErrorMessage(snmpGetResult.Error), metric.ATTRIBUTE)
+		err = ms.SetMetric("failedOids", formatFailedOids(failed), metric.ATTRIBUTE)
 		if err != nil {
 			log.Error(err.Error())
 		}
-		return nil
 	}
 
-	for _, pdu := range snmpGetResult.Variables {
+	for _, pdu := range variables {
 		if pdu.Type == gosnmp.NoSuchObject || pdu.Type == gosnmp.NoSuchInstance {
 			log.Warn("OID %s not supported by target %s", pdu.Name, targetHost)
+			theExplain.skip(pdu.Name, "not supported by target: "+pdu.Type.String())
 			continue
 		}
 		oid := strings.TrimSpace(pdu.Name)
@@ -74,13 +105,86 @@ func populateScalarMetrics(device string, metricSet metricSet, entity *integrati
 				log.Error(err.Error())
 			}
 		} else {
-			errorMessage, ok := knownErrorOids[oid]
-			if ok {
-				log.Error(errorMessage)
-			} else {
-				log.Debug("unexpected OID %s received")
-			}
+			log.Debug("unexpected OID %s received", oid)
 		}
 	}
 	return nil
 }
+
+// getChunked sends the OIDs in GET requests of at most maxOids OIDs and merges
+// the variables of the responses. A request answered with tooBig is retried
+// with half as many OIDs, and the smaller size is kept for the next requests.
+// A request that fails for another reason is bisected to isolate the failing
+// OIDs, which are returned with their error status.
+func getChunked(get func(oids []string) (*gosnmp.SnmpPacket, error), oids []string, maxOids int) ([]gosnmp.SnmpPDU, map[string]gosnmp.SNMPError, error) {
+	var variables []gosnmp.SnmpPDU
+	failed := make(map[string]gosnmp.SNMPError)
+	for len(oids) > 0 {
+		n := maxOids
+		if n > len(oids) {
+			n = len(oids)
+		}
+		result, err := get(oids[:n])
+		if err != nil {
+			return nil, nil, err
+		}
+		if result.Error == gosnmp.TooBig && n > 1 {
+			maxOids = n / 2
+			log.Debug("target %s answered tooBig to %d OIDs, retrying with %d", targetHost, n, maxOids)
+			continue
+		}
+		if err := checkReport(result); err != nil {
+			return nil, nil, err
+		}
+		if result.Error != gosnmp.NoError {
+			bisected, err := getBisecting(get, oids[:n], result.Error, failed)
+			if err != nil {
+				return nil, nil, err
+			}
+			variables = append(variables, bisected...)
+		} else {
+			variables = append(variables, result.Variables...)
+		}
+		oids = oids[n:]
+	}
+	return variables, failed, nil
+}
+
+// getBisecting splits a request the device rejected with status in halves
+// until the failing OIDs are isolated, and returns the variables of the others
+func getBisecting(get func(oids []string) (*gosnmp.SnmpPacket, error), oids []string, status gosnmp.SNMPError, failed map[string]gosnmp.SNMPError) ([]gosnmp.SnmpPDU, error) {
+	if len(oids) == 1 {
+		failed[oids[0]] = status
+		return nil, nil
+	}
+	var variables []gosnmp.SnmpPDU
+	for _, half := range [][]string{oids[:len(oids)/2], oids[len(oids)/2:]} {
+		result, err := get(half)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkReport(result); err != nil {
+			return nil, err
+		}
+		if result.Error != gosnmp.NoError {
+			bisected, err := getBisecting(get, half, result.Error, failed)
+			if err != nil {
+				return nil, err
+			}
+			variables = append(variables, bisected...)
+			continue
+		}
+		variables = append(variables, result.Variables...)
+	}
+	return variables, nil
+}
+
+// formatFailedOids lists the failed OIDs sorted, each with its error code
+func formatFailedOids(failed map[string]gosnmp.SNMPError) string {
+	pairs := make([]string, 0, len(failed))
+	for oid, status := range failed {
+		pairs = append(pairs, oid+"="+getErrorCode(status))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
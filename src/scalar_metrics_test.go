@@ -0,0 +1,106 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/persist"
+
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetChunked(t *testing.T) {
+	var oids []string
+	for i := 1; i <= 10; i++ {
+		oids = append(oids, fmt.Sprintf(".1.3.6.1.4.1.9.9.%d.0", i))
+	}
+
+	// The agent answers tooBig to more than 3 OIDs
+	var requests []int
+	get := func(oids []string) (*gosnmp.SnmpPacket, error) {
+		requests = append(requests, len(oids))
+		if len(oids) > 3 {
+			return &gosnmp.SnmpPacket{Error: gosnmp.TooBig}, nil
+		}
+		var variables []gosnmp.SnmpPDU
+		for _, oid := range oids {
+			variables = append(variables, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.Integer, Value: 1})
+		}
+		return &gosnmp.SnmpPacket{Variables: variables}, nil
+	}
+
+	variables, failed, err := getChunked(get, oids, 8)
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.Len(t, variables, 10)
+	assert.Equal(t, oids[9], variables[9].Name)
+	// 8 is halved to 4 and then 2, which is kept for the remaining requests
+	assert.Equal(t, []int{8, 4, 2, 2, 2, 2, 2}, requests)
+}
+
+func TestGetChunked_Bisect(t *testing.T) {
+	var oids []string
+	for i := 1; i <= 8; i++ {
+		oids = append(oids, fmt.Sprintf(".1.3.6.1.4.1.9.9.%d.0", i))
+	}
+	bad := map[string]gosnmp.SNMPError{oids[2]: gosnmp.NoSuchName, oids[7]: gosnmp.GenErr}
+
+	// The agent rejects any request with a bad OID as a whole
+	requests := 0
+	get := func(oids []string) (*gosnmp.SnmpPacket, error) {
+		requests++
+		var variables []gosnmp.SnmpPDU
+		for _, oid := range oids {
+			if status, ok := bad[oid]; ok {
+				return &gosnmp.SnmpPacket{Error: status}, nil
+			}
+			variables = append(variables, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.Integer, Value: 1})
+		}
+		return &gosnmp.SnmpPacket{Variables: variables}, nil
+	}
+
+	variables, failed, err := getChunked(get, oids, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, bad, failed)
+	assert.Len(t, variables, 6)
+	// 1 rejected request, then 2 halves, 4 quarters and 4 single OIDs
+	assert.Equal(t, 11, requests)
+	assert.Equal(t, ".1.3.6.1.4.1.9.9.3.0=ERR_NoSuchName,.1.3.6.1.4.1.9.9.8.0=ERR_GenErr", formatFailedOids(failed))
+
+	// A tooBig answer to a single OID can't be split further
+	get = func(oids []string) (*gosnmp.SnmpPacket, error) {
+		return &gosnmp.SnmpPacket{Error: gosnmp.TooBig}, nil
+	}
+	variables, failed, err = getChunked(get, oids[:2], 2)
+	assert.NoError(t, err)
+	assert.Empty(t, variables)
+	assert.Equal(t, map[string]gosnmp.SNMPError{oids[0]: gosnmp.TooBig, oids[1]: gosnmp.TooBig}, failed)
+}
+
+func TestKnownBadOids(t *testing.T) {
+	defer func(store persist.Storer) { theDeviceState = store }(theDeviceState)
+	theDeviceState = persist.NewInMemoryStore()
+	now := time.Now()
+
+	known := loadKnownBadOids()
+	known.update([]string{".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.9.0"}, map[string]gosnmp.SNMPError{".1.3.6.1.2.1.1.9.0": gosnmp.NoAccess}, now)
+
+	// The next run skips the bad OID until it is due to be retried
+	known = loadKnownBadOids()
+	status, skip := known.skip(".1.3.6.1.2.1.1.9.0", now.Add(time.Hour))
+	assert.True(t, skip)
+	assert.Equal(t, gosnmp.NoAccess, status)
+	_, skip = known.skip(".1.3.6.1.2.1.1.1.0", now)
+	assert.False(t, skip)
+	_, skip = known.skip(".1.3.6.1.2.1.1.9.0", now.Add(knownBadOidRetry))
+	assert.False(t, skip)
+
+	// An OID that answers again is forgotten
+	known.update([]string{".1.3.6.1.2.1.1.9.0"}, nil, now)
+	assert.Empty(t, loadKnownBadOids())
+}
@@ -0,0 +1,358 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	mrand "math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/soniah/gosnmp"
+)
+
+// simulatorEngineID is the authoritative engine ID of the simulator, in the
+// text format of RFC 3411 under the net-snmp enterprise
+const simulatorEngineID = "\x80\x00\x1f\x88\x04nri-snmp"
+
+// simulatorConfig sets how the simulator misbehaves
+type simulatorConfig struct {
+	// Delay is waited before answering each request
+	Delay time.Duration
+	// Loss is the fraction of requests, from 0 to 1, dropped without an answer
+	Loss float64
+	// Errors maps OID subtrees to the error status of the requests for them
+	Errors map[string]gosnmp.SNMPError
+	// CounterIncrement is added to a counter every time it is read
+	CounterIncrement uint64
+	// Seed makes the dropped requests reproducible
+	Seed int64
+}
+
+// simulator is an SNMP agent answering GET, GETNEXT and GETBULK requests from
+// a snapshot, used to test collection files and profiles without a device.
+// It serves SNMP v1 and v2c requests with the community of its session or,
+// when the session is SNMPv3, the requests of its user.
+type simulator struct {
+	snapshot  *snapshot
+	config    simulatorConfig
+	community string
+	// user holds the SNMPv3 credentials and level their requests need, nil for v1 and v2c
+	user    *gosnmp.UsmSecurityParameters
+	level   gosnmp.SnmpV3MsgFlags
+	decoder *gosnmp.GoSNMP
+	start   time.Time
+	conn    net.PacketConn
+	done    chan struct{}
+
+	mu   sync.Mutex
+	rand *mrand.Rand
+}
+
+// newSimulator returns a simulator for the version and credentials of session
+func newSimulator(data *snapshot, session *gosnmp.GoSNMP, config simulatorConfig) (*simulator, error) {
+	s := &simulator{
+		snapshot:  data,
+		config:    config,
+		community: session.Community,
+		decoder:   &gosnmp.GoSNMP{Version: gosnmp.Version2c},
+		start:     time.Now(),
+		rand:      mrand.New(mrand.NewSource(config.Seed)),
+	}
+	if session.Version == gosnmp.Version3 {
+		usm, ok := session.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+		if !ok {
+			return nil, fmt.Errorf("the simulator only supports the SNMPv3 user security model")
+		}
+		s.user = &gosnmp.UsmSecurityParameters{
+			UserName:                 usm.UserName,
+			AuthenticationProtocol:   usm.AuthenticationProtocol,
+			AuthenticationPassphrase: usm.AuthenticationPassphrase,
+			PrivacyProtocol:          usm.PrivacyProtocol,
+			PrivacyPassphrase:        usm.PrivacyPassphrase,
+		}
+		s.level = session.MsgFlags & gosnmp.AuthPriv
+		// Keys are localized for each request, from the engine ID it carries
+		s.decoder = &gosnmp.GoSNMP{
+			Version:            gosnmp.Version3,
+			SecurityModel:      gosnmp.UserSecurityModel,
+			MsgFlags:           s.level,
+			SecurityParameters: s.user,
+		}
+	}
+	return s, nil
+}
+
+// listen opens the UDP socket of the simulator and returns its address
+func (s *simulator) listen(address string) (net.Addr, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	s.conn, s.done = conn, make(chan struct{})
+	return conn.LocalAddr(), nil
+}
+
+// serve answers requests one at a time, as most agents do, until close
+func (s *simulator) serve() {
+	defer close(s.done)
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		response := s.answer(append([]byte(nil), buf[:n]...))
+		if response == nil {
+			continue
+		}
+		if s.config.Delay > 0 {
+			time.Sleep(s.config.Delay)
+		}
+		if _, err := s.conn.WriteTo(response, addr); err != nil {
+			log.Debug("simulator: unable to answer %s. %v", addr, err)
+		}
+	}
+}
+
+// close stops serving and waits for the request in progress
+func (s *simulator) close() error {
+	err := s.conn.Close()
+	<-s.done
+	return err
+}
+
+// answer returns the encoded response to a request, nil to drop it
+func (s *simulator) answer(b []byte) []byte {
+	if s.config.Loss > 0 {
+		s.mu.Lock()
+		lost := s.rand.Float64() < s.config.Loss
+		s.mu.Unlock()
+		if lost {
+			return nil
+		}
+	}
+	// Decoding blanks the digest and decrypts in place
+	raw := append([]byte(nil), b...)
+	request, err := s.decoder.SnmpDecodePacket(b)
+	if err != nil {
+		log.Debug("simulator: dropping undecodable request. %v", err)
+		return nil
+	}
+
+	var response *gosnmp.SnmpPacket
+	switch {
+	case request.Version == gosnmp.Version3 && s.user != nil:
+		if response = s.answerV3(raw, request); response == nil {
+			return nil
+		}
+	case request.Version != gosnmp.Version3 && s.user == nil:
+		if s.community != "" && request.Community != s.community {
+			log.Debug("simulator: dropping request for community %q", request.Community)
+			return nil
+		}
+		response = s.respond(request)
+	default:
+		log.Debug("simulator: dropping request of version %s", request.Version)
+		return nil
+	}
+	out, err := response.MarshalMsg()
+	if err != nil {
+		log.Debug("simulator: unable to encode response. %v", err)
+		return nil
+	}
+	return out
+}
+
+// respond answers a request from the snapshot, the errors injected first
+func (s *simulator) respond(request *gosnmp.SnmpPacket) *gosnmp.SnmpPacket {
+	for i, v := range request.Variables {
+		if status, ok := s.injectedError(v.Name); ok {
+			return errorResponse(request, status, i+1)
+		}
+	}
+	response := s.snapshot.respond(request)
+	s.snapshot.increment(response.Variables, s.config.CounterIncrement)
+	return response
+}
+
+// injectedError returns the error status configured for the subtree of oid
+func (s *simulator) injectedError(oid string) (gosnmp.SNMPError, bool) {
+	for subtree, status := range s.config.Errors {
+		if oid == subtree || strings.HasPrefix(oid, subtree+".") {
+			return status, true
+		}
+	}
+	return gosnmp.NoError, false
+}
+
+// errorResponse answers a request with an error status, its variables unchanged
+func errorResponse(request *gosnmp.SnmpPacket, status gosnmp.SNMPError, index int) *gosnmp.SnmpPacket {
+	response := &gosnmp.SnmpPacket{
+		Version:    request.Version,
+		Community:  request.Community,
+		PDUType:    gosnmp.GetResponse,
+		RequestID:  request.RequestID,
+		Error:      status,
+		ErrorIndex: uint8(index),
+	}
+	for _, v := range request.Variables {
+		response.Variables = append(response.Variables, gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.Null})
+	}
+	return response
+}
+
+// answerV3 checks the engine, user, security level and digest of a request
+// the way the user security model does, answering with a report when any of
+// them is wrong
+func (s *simulator) answerV3(raw []byte, request *gosnmp.SnmpPacket) *gosnmp.SnmpPacket {
+	params, ok := request.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if !ok {
+		return nil
+	}
+	var report string
+	switch {
+	case params.AuthoritativeEngineID != simulatorEngineID:
+		report = usmStatsUnknownEngineIDs
+	case params.UserName != s.user.UserName:
+		report = usmStatsUnknownUserNames
+	case request.MsgFlags&gosnmp.AuthPriv < s.level:
+		report = usmStatsUnsupportedSecLevels
+	case request.MsgFlags&gosnmp.AuthNoPriv != 0 && !authentic(raw, params):
+		report = usmStatsWrongDigests
+	}
+
+	engine := &gosnmp.UsmSecurityParameters{
+		AuthoritativeEngineID:    simulatorEngineID,
+		AuthoritativeEngineBoots: 1,
+		AuthoritativeEngineTime:  uint32(time.Since(s.start) / time.Second),
+		UserName:                 params.UserName,
+	}
+	var response *gosnmp.SnmpPacket
+	flags := gosnmp.NoAuthNoPriv
+	if report != "" {
+		response = &gosnmp.SnmpPacket{
+			PDUType:   gosnmp.Report,
+			RequestID: request.RequestID,
+			Variables: []gosnmp.SnmpPDU{{Name: report, Type: gosnmp.Counter32, Value: uint32(1)}},
+		}
+	} else {
+		response = s.respond(request)
+		flags = request.MsgFlags &^ gosnmp.Reportable
+		engine.AuthenticationProtocol = params.AuthenticationProtocol
+		engine.PrivacyProtocol = params.PrivacyProtocol
+		engine.SecretKey = params.SecretKey
+		engine.PrivacyKey = params.PrivacyKey
+		if flags&gosnmp.AuthPriv == gosnmp.AuthPriv {
+			engine.PrivacyParameters = make([]byte, 8)
+			if _, err := rand.Read(engine.PrivacyParameters); err != nil {
+				return nil
+			}
+		}
+	}
+	response.Version = gosnmp.Version3
+	response.MsgFlags = flags
+	response.SecurityModel = gosnmp.UserSecurityModel
+	response.SecurityParameters = engine
+	response.MsgID = request.MsgID
+	response.ContextEngineID = simulatorEngineID
+	response.ContextName = request.ContextName
+	return response
+}
+
+// authentic checks the HMAC-96 digest of a request, computed with its digest blanked
+func authentic(raw []byte, params *gosnmp.UsmSecurityParameters) bool {
+	digest := []byte(params.AuthenticationParameters)
+	if len(digest) != 12 {
+		return false
+	}
+	i := bytes.Index(raw, append([]byte{byte(gosnmp.OctetString), 12}, digest...))
+	if i < 0 {
+		return false
+	}
+	blanked := append([]byte(nil), raw...)
+	copy(blanked[i+2:i+14], make([]byte, 12))
+	newHash := md5.New
+	if params.AuthenticationProtocol == gosnmp.SHA {
+		newHash = func() hash.Hash { return sha1.New() }
+	}
+	mac := hmac.New(newHash, params.SecretKey)
+	mac.Write(blanked)
+	return hmac.Equal(mac.Sum(nil)[:12], digest)
+}
+
+// parseSimulatedErrors parses a comma separated list of oid=status, e.g. .1.3.6.1.2.1.2.2=genErr
+func parseSimulatedErrors(list string) (map[string]gosnmp.SNMPError, error) {
+	errs := make(map[string]gosnmp.SNMPError)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid simulated error %q, expected oid=status", item)
+		}
+		status, ok := parseSNMPError(strings.TrimSpace(parts[1]))
+		if !ok {
+			return nil, fmt.Errorf("invalid simulated error %q, unknown status %s", item, parts[1])
+		}
+		errs[absoluteOid(strings.TrimSpace(parts[0]))] = status
+	}
+	return errs, nil
+}
+
+// parseSNMPError returns the error status named as in RFC 3416, e.g. tooBig or genErr
+func parseSNMPError(name string) (gosnmp.SNMPError, bool) {
+	for status := gosnmp.TooBig; status <= gosnmp.InconsistentName; status++ {
+		if strings.EqualFold(status.String(), name) {
+			return status, true
+		}
+	}
+	return gosnmp.NoError, false
+}
+
+// runSimulator serves the snapshot file on the target address with the SNMP
+// version and credentials of the connection arguments until killed
+func runSimulator(path string) error {
+	data, err := loadSnapshot(path, false)
+	if err != nil {
+		return err
+	}
+	session, err := newSession(targetHost, targetPort)
+	if err != nil {
+		return err
+	}
+	errs, err := parseSimulatedErrors(args.SimulateErrors)
+	if err != nil {
+		return err
+	}
+	s, err := newSimulator(data, session, simulatorConfig{
+		Delay:            time.Duration(args.SimulateDelay) * time.Millisecond,
+		Loss:             float64(args.SimulateLoss) / 100,
+		Errors:           errs,
+		CounterIncrement: uint64(args.SimulateCounterStep),
+		Seed:             time.Now().UnixNano(),
+	})
+	if err != nil {
+		return err
+	}
+	addr, err := s.listen(net.JoinHostPort(targetHost, strconv.Itoa(targetPort)))
+	if err != nil {
+		return err
+	}
+	log.Info("Simulating %d variables from %s on %s", len(data.oids), path, addr)
+	s.serve()
+	return nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+// simulate serves data from a simulator with the version and credentials of
+// session and connects the integration to it. Calling the returned function
+// disconnects and stops the simulator.
+func simulate(t *testing.T, session *gosnmp.GoSNMP, config simulatorConfig, data *snapshot) func() {
+	t.Helper()
+	s, err := newSimulator(data, session, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := s.listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.serve()
+
+	snmp, client, tuner, store := theSNMP, theClient, theRepetitions, theDeviceState
+	session.Target, session.Port = "127.0.0.1", uint16(addr.(*net.UDPAddr).Port)
+	if session.Timeout == 0 {
+		session.Timeout = time.Second
+	}
+	if err := session.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	session.Conn = countingConn{session.Conn}
+	theSNMP, theClient = session, instrumentedClient{session}
+	theRepetitions = newRepetitionTuner(10, false, 0)
+	theDeviceState = persist.NewInMemoryStore()
+	return func() {
+		session.Conn.Close()
+		s.close()
+		theSNMP, theClient, theRepetitions, theDeviceState = snmp, client, tuner, store
+	}
+}
+
+// simulatedData returns a snapshot of the given PDUs
+func simulatedData(pdus ...gosnmp.SnmpPDU) *snapshot {
+	s := newSnapshot("")
+	for _, pdu := range pdus {
+		s.add(pdu)
+	}
+	return s
+}
+
+func mustLoadSnapshot(t *testing.T, name string) *snapshot {
+	t.Helper()
+	s, err := loadSnapshot(filepath.Join("testdata", "profiles", name+".snmprec"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSimulator_Versions(t *testing.T) {
+	data := simulatedData(octets(".1.3.6.1.2.1.1.5.0", []byte("core-1")), integer(".1.3.6.1.2.1.1.7.0", 72))
+	usm := func(auth gosnmp.SnmpV3AuthProtocol, priv gosnmp.SnmpV3PrivProtocol) *gosnmp.UsmSecurityParameters {
+		return &gosnmp.UsmSecurityParameters{
+			UserName:                 "monitor",
+			AuthenticationProtocol:   auth,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          priv,
+			PrivacyPassphrase:        "privpassword",
+		}
+	}
+	v3 := func(flags gosnmp.SnmpV3MsgFlags, params *gosnmp.UsmSecurityParameters) *gosnmp.GoSNMP {
+		return &gosnmp.GoSNMP{Version: gosnmp.Version3, SecurityModel: gosnmp.UserSecurityModel, MsgFlags: flags, SecurityParameters: params}
+	}
+	sessions := map[string]*gosnmp.GoSNMP{
+		"v1":           {Version: gosnmp.Version1, Community: "public"},
+		"v2c":          {Version: gosnmp.Version2c, Community: "public"},
+		"noAuthNoPriv": v3(gosnmp.NoAuthNoPriv, &gosnmp.UsmSecurityParameters{UserName: "monitor"}),
+		"authNoPriv":   v3(gosnmp.AuthNoPriv, usm(gosnmp.MD5, gosnmp.NoPriv)),
+		"authPriv AES": v3(gosnmp.AuthPriv, usm(gosnmp.SHA, gosnmp.AES)),
+		"authPriv DES": v3(gosnmp.AuthPriv, usm(gosnmp.MD5, gosnmp.DES)),
+	}
+	for name, session := range sessions {
+		stop := simulate(t, session, simulatorConfig{}, data)
+		result, err := theClient.Get([]string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.1.7.0"})
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, gosnmp.GetResponse, result.PDUType, name)
+			assert.Equal(t, []byte("core-1"), result.Variables[0].Value, name)
+			assert.Equal(t, 72, result.Variables[1].Value, name)
+		}
+		stop()
+	}
+}
+
+func TestSimulator_V1Errors(t *testing.T) {
+	defer simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version1, Community: "public"}, simulatorConfig{},
+		simulatedData(octets(".1.3.6.1.2.1.1.5.0", []byte("core-1"))))()
+
+	// SNMP v1 reports the first variable that doesn't exist
+	result, err := theClient.Get([]string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.1.6.0"})
+	assert.NoError(t, err)
+	assert.Equal(t, gosnmp.NoSuchName, result.Error)
+	assert.Equal(t, uint8(2), result.ErrorIndex)
+}
+
+func TestSimulator_V3Reports(t *testing.T) {
+	data := simulatedData(octets(".1.3.6.1.2.1.1.5.0", []byte("core-1")))
+	agent := &gosnmp.GoSNMP{Version: gosnmp.Version3, SecurityModel: gosnmp.UserSecurityModel, MsgFlags: gosnmp.AuthNoPriv,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{UserName: "monitor", AuthenticationProtocol: gosnmp.SHA, AuthenticationPassphrase: "authpassword"}}
+	s, err := newSimulator(data, agent, simulatorConfig{})
+	assert.NoError(t, err)
+	addr, err := s.listen("127.0.0.1:0")
+	assert.NoError(t, err)
+	go s.serve()
+	defer s.close()
+
+	tests := map[string]struct {
+		flags  gosnmp.SnmpV3MsgFlags
+		params *gosnmp.UsmSecurityParameters
+		report string
+	}{
+		"wrong passphrase": {gosnmp.AuthNoPriv, &gosnmp.UsmSecurityParameters{UserName: "monitor", AuthenticationProtocol: gosnmp.SHA, AuthenticationPassphrase: "wrongpassword"}, usmStatsWrongDigests},
+		"unknown user":     {gosnmp.AuthNoPriv, &gosnmp.UsmSecurityParameters{UserName: "admin", AuthenticationProtocol: gosnmp.SHA, AuthenticationPassphrase: "authpassword"}, usmStatsUnknownUserNames},
+		"security level":   {gosnmp.NoAuthNoPriv, &gosnmp.UsmSecurityParameters{UserName: "monitor"}, usmStatsUnsupportedSecLevels},
+	}
+	for name, test := range tests {
+		client := &gosnmp.GoSNMP{
+			Target: "127.0.0.1", Port: uint16(addr.(*net.UDPAddr).Port), Timeout: time.Second,
+			Version: gosnmp.Version3, SecurityModel: gosnmp.UserSecurityModel, MsgFlags: test.flags, SecurityParameters: test.params,
+		}
+		assert.NoError(t, client.Connect(), name)
+		result, err := client.Get([]string{".1.3.6.1.2.1.1.5.0"})
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, gosnmp.Report, result.PDUType, name)
+			assert.Equal(t, test.report, result.Variables[0].Name, name)
+			assert.Error(t, checkReport(result), name)
+		}
+		client.Conn.Close()
+	}
+}
+
+func TestSimulator_Misbehaviour(t *testing.T) {
+	data := simulatedData(
+		octets(".1.3.6.1.2.1.1.5.0", []byte("core-1")),
+		gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.2.2.1.10.1", Type: gosnmp.Counter32, Value: uint(4294967200)},
+		gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: gosnmp.Counter64, Value: uint64(1000)},
+	)
+	stop := simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public"}, simulatorConfig{
+		Errors:           map[string]gosnmp.SNMPError{".1.3.6.1.2.1.1.5": gosnmp.NoAccess},
+		CounterIncrement: 100,
+	}, data)
+	result, err := theClient.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	assert.NoError(t, err)
+	assert.Equal(t, gosnmp.NoAccess, result.Error)
+	assert.Equal(t, uint8(1), result.ErrorIndex)
+
+	// Counters grow every time they are read, Counter32 wrapping around
+	var values []uint64
+	for i := 0; i < 2; i++ {
+		result, err = theClient.Get([]string{".1.3.6.1.2.1.2.2.1.10.1", ".1.3.6.1.2.1.31.1.1.1.6.1"})
+		assert.NoError(t, err)
+		values = append(values, gosnmp.ToBigInt(result.Variables[0].Value).Uint64(), gosnmp.ToBigInt(result.Variables[1].Value).Uint64())
+	}
+	assert.Equal(t, []uint64{4294967200, 1000, 4, 1100}, values)
+	stop()
+
+	// Requests that are dropped are retried, those delayed past the timeout time out
+	stop = simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Timeout: 200 * time.Millisecond, Retries: 10},
+		simulatorConfig{Loss: 0.5, Seed: 1}, data)
+	packets := theStats.counters.packets
+	for i := 0; i < 5; i++ {
+		_, err = theClient.Get([]string{".1.3.6.1.2.1.2.2.1.10.1"})
+		assert.NoError(t, err)
+	}
+	assert.True(t, theStats.counters.packets-packets > 5)
+	stop()
+
+	stop = simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Timeout: 50 * time.Millisecond},
+		simulatorConfig{Delay: 150 * time.Millisecond}, data)
+	_, err = theClient.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout")
+	stop()
+
+	// Requests for another community are not answered
+	stop = simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Timeout: 50 * time.Millisecond}, simulatorConfig{}, data)
+	theSNMP.Community = "private"
+	_, err = theClient.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	assert.Error(t, err)
+	stop()
+}
+
+func TestParseSimulatedErrors(t *testing.T) {
+	errs, err := parseSimulatedErrors("1.3.6.1.2.1.2.2=genErr, .1.3.6.1.2.1.1.5.0=tooBig")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]gosnmp.SNMPError{".1.3.6.1.2.1.2.2": gosnmp.GenErr, ".1.3.6.1.2.1.1.5.0": gosnmp.TooBig}, errs)
+
+	_, err = parseSimulatedErrors(".1.3.6.1.2.1.2.2")
+	assert.EqualError(t, err, `invalid simulated error ".1.3.6.1.2.1.2.2", expected oid=status`)
+	_, err = parseSimulatedErrors(".1.3.6.1.2.1.2.2=broken")
+	assert.EqualError(t, err, `invalid simulated error ".1.3.6.1.2.1.2.2=broken", unknown status broken`)
+}
@@ -0,0 +1,553 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/soniah/gosnmp"
+)
+
+// theRecording gathers the responses of the target when RECORD_FILE is set, nil otherwise
+var theRecording *snapshot
+
+// theReplay answers the requests of the session when REPLAY_FILE is set, nil otherwise
+var theReplay *snapshot
+
+// snapshotTags are the snmprec tags of the PDU types a snapshot stores
+var snapshotTags = map[gosnmp.Asn1BER]string{
+	gosnmp.Integer:          "2",
+	gosnmp.OctetString:      "4",
+	gosnmp.Null:             "5",
+	gosnmp.ObjectIdentifier: "6",
+	gosnmp.IPAddress:        "64",
+	gosnmp.Counter32:        "65",
+	gosnmp.Gauge32:          "66",
+	gosnmp.TimeTicks:        "67",
+	gosnmp.Counter64:        "70",
+	gosnmp.NoSuchObject:     "128",
+	gosnmp.NoSuchInstance:   "129",
+}
+
+// snapshotEntry is what a request for an OID was answered with: a variable,
+// an error status or an SNMPv3 report
+type snapshotEntry struct {
+	pdu    gosnmp.SnmpPDU
+	status gosnmp.SNMPError
+	report string
+}
+
+// value tells whether the entry is a variable a walk can return
+func (e snapshotEntry) value() bool {
+	return e.status == gosnmp.NoError && e.report == "" &&
+		e.pdu.Type != gosnmp.NoSuchObject && e.pdu.Type != gosnmp.NoSuchInstance
+}
+
+// snapshot holds the responses of a target in OID order, run by run. It is
+// saved in the snmprec format of the files in testdata/profiles, one
+// oid|tag|value line per variable, extended with the e tag for error statuses
+// (oid|e|genErr) and the r tag for reports (oid|r|usmStats OID). The responses
+// of the first run are followed by the ones that changed in each later run,
+// after a "# run N" line, and a replay moves on to the next run every run.
+type snapshot struct {
+	path string
+	mu   sync.Mutex
+	runs []map[string]snapshotEntry
+	oids []string
+	// run is the run replayed and recorded to
+	run int
+}
+
+func newSnapshot(path string) *snapshot {
+	return &snapshot{path: path}
+}
+
+// loadSnapshot reads a snapshot file, an empty snapshot when the file doesn't exist and create is set
+func loadSnapshot(path string, create bool) (*snapshot, error) {
+	s := newSnapshot(path)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && create {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := s.read(f); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// newRecording loads the snapshot file the responses of this run are added to, as a new run
+func newRecording(path string) (*snapshot, error) {
+	s, err := loadSnapshot(path, true)
+	if err != nil {
+		return nil, err
+	}
+	s.run = len(s.runs)
+	return s, nil
+}
+
+func (s *snapshot) read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "# run ") {
+			run, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "# run ")))
+			if err != nil || run < s.run {
+				return fmt.Errorf("line %d: invalid run %q", n, line)
+			}
+			s.run = run
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		oid, entry, err := parseSnapshotLine(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+		s.put(oid, entry)
+	}
+	s.run = 0
+	return scanner.Err()
+}
+
+// parseSnapshotLine parses an oid|tag|value line
+func parseSnapshotLine(line string) (string, snapshotEntry, error) {
+	fields := strings.SplitN(line, "|", 3)
+	if len(fields) != 3 {
+		return "", snapshotEntry{}, fmt.Errorf("expected oid|tag|value, got %q", line)
+	}
+	oid := absoluteOid(fields[0])
+	pdu := gosnmp.SnmpPDU{Name: oid}
+	value := fields[2]
+	var err error
+	switch fields[1] {
+	case "e":
+		status, ok := parseSNMPError(value)
+		if !ok {
+			return oid, snapshotEntry{}, fmt.Errorf("unknown error status %s", value)
+		}
+		return oid, snapshotEntry{status: status}, nil
+	case "r":
+		return oid, snapshotEntry{report: absoluteOid(value)}, nil
+	case "2":
+		pdu.Type = gosnmp.Integer
+		pdu.Value, err = strconv.Atoi(value)
+	case "4":
+		pdu.Type, pdu.Value = gosnmp.OctetString, []byte(value)
+	case "4x":
+		pdu.Type = gosnmp.OctetString
+		pdu.Value, err = hex.DecodeString(value)
+	case "5":
+		pdu.Type = gosnmp.Null
+	case "6":
+		pdu.Type, pdu.Value = gosnmp.ObjectIdentifier, absoluteOid(value)
+	case "64":
+		pdu.Type, pdu.Value = gosnmp.IPAddress, value
+	case "65", "66", "67":
+		types := map[string]gosnmp.Asn1BER{"65": gosnmp.Counter32, "66": gosnmp.Gauge32, "67": gosnmp.TimeTicks}
+		var v uint64
+		v, err = strconv.ParseUint(value, 10, 32)
+		pdu.Type, pdu.Value = types[fields[1]], uint(v)
+	case "70":
+		pdu.Type = gosnmp.Counter64
+		pdu.Value, err = strconv.ParseUint(value, 10, 64)
+	case "128":
+		pdu.Type = gosnmp.NoSuchObject
+	case "129":
+		pdu.Type = gosnmp.NoSuchInstance
+	default:
+		return oid, snapshotEntry{}, fmt.Errorf("unsupported tag %s", fields[1])
+	}
+	return oid, snapshotEntry{pdu: pdu}, err
+}
+
+// formatSnapshotLine renders an entry as an oid|tag|value line, false for the PDU types a snapshot doesn't store
+func formatSnapshotLine(oid string, entry snapshotEntry) (string, bool) {
+	oid = strings.TrimPrefix(strings.TrimSpace(oid), ".")
+	switch {
+	case entry.report != "":
+		return oid + "|r|" + strings.TrimPrefix(entry.report, "."), true
+	case entry.status != gosnmp.NoError:
+		return oid + "|e|" + entry.status.String(), true
+	}
+	pdu := entry.pdu
+	tag, ok := snapshotTags[pdu.Type]
+	if !ok {
+		return "", false
+	}
+	var value string
+	switch v := pdu.Value.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+		// Binary and multi-line strings are stored in hex
+		for _, r := range value {
+			if r < ' ' || r > '~' {
+				tag, value = "4x", hex.EncodeToString(v)
+				break
+			}
+		}
+	case string:
+		value = strings.TrimPrefix(v, ".")
+	default:
+		value = gosnmp.ToBigInt(v).String()
+	}
+	return oid + "|" + tag + "|" + value, true
+}
+
+// add stores a variable in the current run, replacing the previous value of its OID
+func (s *snapshot) add(pdu gosnmp.SnmpPDU) {
+	s.put(pdu.Name, snapshotEntry{pdu: pdu})
+}
+
+// put stores the entry of an OID in the current run
+func (s *snapshot) put(oid string, entry snapshotEntry) {
+	oid = absoluteOid(oid)
+	entry.pdu.Name = oid
+	i := sort.Search(len(s.oids), func(i int) bool { return !oidLess(s.oids[i], oid) })
+	if i == len(s.oids) || s.oids[i] != oid {
+		s.oids = append(s.oids, "")
+		copy(s.oids[i+1:], s.oids[i:])
+		s.oids[i] = oid
+	}
+	for len(s.runs) <= s.run {
+		s.runs = append(s.runs, make(map[string]snapshotEntry))
+	}
+	s.runs[s.run][oid] = entry
+}
+
+// lookup returns the entry of an OID as of the current run, and the run it was stored in
+func (s *snapshot) lookup(oid string) (snapshotEntry, int, bool) {
+	run := s.run
+	if run >= len(s.runs) {
+		run = len(s.runs) - 1
+	}
+	for ; run >= 0; run-- {
+		if entry, ok := s.runs[run][oid]; ok {
+			return entry, run, true
+		}
+	}
+	return snapshotEntry{}, 0, false
+}
+
+// record stores what the target answered to a request for oids, nil-safe.
+// tooBig is not stored as it depends on the size of the request.
+func (s *snapshot) record(oids []string, result *gosnmp.SnmpPacket) {
+	if s == nil || result == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case result.PDUType == gosnmp.Report:
+		if len(result.Variables) > 0 {
+			for _, oid := range oids {
+				s.put(oid, snapshotEntry{report: result.Variables[0].Name})
+			}
+		}
+	case result.Error == gosnmp.TooBig:
+	case result.Error != gosnmp.NoError:
+		if i := int(result.ErrorIndex); i > 0 && i <= len(oids) {
+			oids = oids[i-1 : i]
+		}
+		for _, oid := range oids {
+			s.put(oid, snapshotEntry{status: result.Error})
+		}
+	default:
+		for _, pdu := range result.Variables {
+			if _, ok := snapshotTags[pdu.Type]; ok {
+				s.add(pdu)
+			}
+		}
+	}
+}
+
+// save writes the snapshot to its file, nil-safe. The entries of a run that
+// are the same as in the previous runs are left out.
+func (s *snapshot) save() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	last := len(s.runs) - 1
+	for last > 0 && len(s.runs[last]) == 0 {
+		last--
+	}
+	previous := make(map[string]string)
+	for run := 0; run <= last; run++ {
+		if run > 0 {
+			fmt.Fprintf(w, "# run %d\n", run)
+		}
+		for _, oid := range s.oids {
+			entry, ok := s.runs[run][oid]
+			if !ok {
+				continue
+			}
+			if line, ok := formatSnapshotLine(oid, entry); ok && line != previous[oid] {
+				fmt.Fprintln(w, line)
+				previous[oid] = line
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// advance moves the snapshot on to the next run, nil-safe
+func (s *snapshot) advance() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.run++
+	s.mu.Unlock()
+}
+
+// next returns the first variable after oid
+func (s *snapshot) next(oid string) (gosnmp.SnmpPDU, bool) {
+	i := sort.Search(len(s.oids), func(i int) bool { return oidLess(oid, s.oids[i]) })
+	for ; i < len(s.oids); i++ {
+		if entry, _, ok := s.lookup(s.oids[i]); ok && entry.value() {
+			return entry.pdu, true
+		}
+	}
+	return gosnmp.SnmpPDU{}, false
+}
+
+// increment adds step to the counters among pdus, so they grow every time they are read
+func (s *snapshot) increment(pdus []gosnmp.SnmpPDU, step uint64) {
+	if step == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pdu := range pdus {
+		stored, run, ok := s.lookup(pdu.Name)
+		if !ok || stored.pdu.Type != pdu.Type || !stored.value() {
+			continue
+		}
+		switch pdu.Type {
+		case gosnmp.Counter32:
+			stored.pdu.Value = uint(uint32(gosnmp.ToBigInt(stored.pdu.Value).Uint64() + step))
+		case gosnmp.Counter64:
+			stored.pdu.Value = gosnmp.ToBigInt(stored.pdu.Value).Uint64() + step
+		default:
+			continue
+		}
+		s.runs[run][pdu.Name] = stored
+	}
+}
+
+// respond answers a GET, GETNEXT or GETBULK request from the snapshot, with
+// the error status or report recorded for any of its OIDs
+func (s *snapshot) respond(request *gosnmp.SnmpPacket) *gosnmp.SnmpPacket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if request.Version == gosnmp.Version1 && request.PDUType == gosnmp.GetBulkRequest {
+		return errorResponse(request, gosnmp.GenErr, 0)
+	}
+	response := &gosnmp.SnmpPacket{
+		Version:   request.Version,
+		Community: request.Community,
+		PDUType:   gosnmp.GetResponse,
+		RequestID: request.RequestID,
+	}
+	for i, v := range request.Variables {
+		entry, _, ok := s.lookup(v.Name)
+		switch {
+		case !ok:
+		case entry.report != "":
+			response.PDUType = gosnmp.Report
+			response.Variables = []gosnmp.SnmpPDU{{Name: entry.report, Type: gosnmp.Counter32, Value: uint32(1)}}
+			return response
+		case entry.status != gosnmp.NoError:
+			return errorResponse(request, entry.status, i+1)
+		}
+	}
+	next := func(oid string) gosnmp.SnmpPDU {
+		if pdu, ok := s.next(oid); ok {
+			return pdu
+		}
+		return gosnmp.SnmpPDU{Name: oid, Type: gosnmp.EndOfMibView}
+	}
+	switch request.PDUType {
+	case gosnmp.GetRequest:
+		for _, v := range request.Variables {
+			entry, _, ok := s.lookup(v.Name)
+			if !ok {
+				entry.pdu = gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.NoSuchObject}
+			}
+			response.Variables = append(response.Variables, entry.pdu)
+		}
+	case gosnmp.GetNextRequest:
+		for _, v := range request.Variables {
+			response.Variables = append(response.Variables, next(v.Name))
+		}
+	case gosnmp.GetBulkRequest:
+		nonRepeaters := int(request.NonRepeaters)
+		if nonRepeaters > len(request.Variables) {
+			nonRepeaters = len(request.Variables)
+		}
+		for _, v := range request.Variables[:nonRepeaters] {
+			response.Variables = append(response.Variables, next(v.Name))
+		}
+		repeaters := request.Variables[nonRepeaters:]
+		oids := make([]string, len(repeaters))
+		for i, v := range repeaters {
+			oids[i] = v.Name
+		}
+		for r := 0; r < int(request.MaxRepetitions) && len(oids) > 0; r++ {
+			for i, oid := range oids {
+				pdu := next(oid)
+				response.Variables = append(response.Variables, pdu)
+				oids[i] = pdu.Name
+			}
+			if response.Variables[len(response.Variables)-1].Type == gosnmp.EndOfMibView {
+				break
+			}
+		}
+	default:
+		response.Error = gosnmp.GenErr
+	}
+	// SNMP v1 has no exceptions, variables that don't exist are an error
+	if request.Version == gosnmp.Version1 {
+		for i, pdu := range response.Variables {
+			switch pdu.Type {
+			case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView:
+				return errorResponse(request, gosnmp.NoSuchName, i+1)
+			}
+		}
+	}
+	return response
+}
+
+// replayConn is a connection that answers the requests of the session from a
+// snapshot in-process, without sending anything to the network
+type replayConn struct {
+	snapshot *snapshot
+	decoder  *gosnmp.GoSNMP
+	mu       sync.Mutex
+	queue    [][]byte
+}
+
+func newReplayConn(s *snapshot) *replayConn {
+	return &replayConn{snapshot: s, decoder: &gosnmp.GoSNMP{Version: gosnmp.Version2c}}
+}
+
+// errReplayTimeout is returned when a request is read with no response pending,
+// as a target that doesn't answer
+var errReplayTimeout = replayTimeout{}
+
+type replayTimeout struct{}
+
+func (replayTimeout) Error() string   { return "replay: i/o timeout" }
+func (replayTimeout) Timeout() bool   { return true }
+func (replayTimeout) Temporary() bool { return true }
+
+func (c *replayConn) Write(b []byte) (int, error) {
+	request, err := c.decoder.SnmpDecodePacket(b)
+	if err != nil {
+		return 0, fmt.Errorf("replay: %v", err)
+	}
+	out, err := c.snapshot.respond(request).MarshalMsg()
+	if err != nil {
+		return 0, fmt.Errorf("replay: %v", err)
+	}
+	c.mu.Lock()
+	c.queue = append(c.queue, out)
+	c.mu.Unlock()
+	return len(b), nil
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queue) == 0 {
+		return 0, errReplayTimeout
+	}
+	n := copy(b, c.queue[0])
+	c.queue = c.queue[1:]
+	return n, nil
+}
+
+func (c *replayConn) Close() error                       { return nil }
+func (c *replayConn) LocalAddr() net.Addr                { return replayAddr{} }
+func (c *replayConn) RemoteAddr() net.Addr               { return replayAddr{} }
+func (c *replayConn) SetDeadline(t time.Time) error      { return nil }
+func (c *replayConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *replayConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type replayAddr struct{}
+
+func (replayAddr) Network() string { return "replay" }
+func (replayAddr) String() string  { return "replay" }
+
+// saveRecording writes the responses recorded during the run to RECORD_FILE,
+// the next run is recorded as a new one
+func saveRecording() {
+	if err := theRecording.save(); err != nil {
+		log.Warn("unable to save the recording of target %s. %v", targetHost, err)
+	}
+	theRecording.advance()
+}
+
+// connectReplay opens a session answered from the snapshot file instead of the target
+func connectReplay(path string) error {
+	s, err := loadSnapshot(path, false)
+	if err != nil {
+		return err
+	}
+	if len(s.oids) == 0 {
+		return errors.New("replay snapshot " + path + " is empty")
+	}
+	if args.V3 {
+		log.Warn("replay answers SNMP v2c requests only, the SNMP v3 arguments are ignored")
+	}
+	theSNMP = &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      161,
+		Version:   gosnmp.Version2c,
+		Community: "replay",
+		Timeout:   time.Second,
+		MaxOids:   8900,
+	}
+	if args.MaxOids > 0 {
+		theSNMP.MaxOids = args.MaxOids
+	}
+	// Connect prepares the session, the socket it opens is replaced right away
+	if err := theSNMP.Connect(); err != nil {
+		return err
+	}
+	theSNMP.Conn.Close()
+	theSNMP.Conn = countingConn{newReplayConn(s)}
+	theClient = instrumentedClient{theSNMP}
+	theReplay = s
+	log.Info("Replaying target %s from %s", targetHost, path)
+	return nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+// sampleValues flattens the reported samples into metric name and row, the
+// concatenated values of the row attributes, to value
+func sampleValues(recorder *sampleRecorder, rowAttributes ...string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, e := range recorder.reported() {
+		for _, set := range e.sets {
+			row := ""
+			for _, name := range rowAttributes {
+				row += set.attributes[name]
+			}
+			for _, m := range set.metrics {
+				values[m.name+"/"+row] = m.value
+			}
+		}
+	}
+	return values
+}
+
+func TestReplaySnapshot(t *testing.T) {
+	defer func(snmp *gosnmp.GoSNMP, client snmpClient, tuner *repetitionTuner, store persist.Storer, replay *snapshot) {
+		theSNMP, theClient, theRepetitions, theDeviceState, theReplay = snmp, client, tuner, store, replay
+	}(theSNMP, theClient, theRepetitions, theDeviceState, theReplay)
+	theDeviceState = persist.NewInMemoryStore()
+	theRepetitions = newRepetitionTuner(4, false, 0)
+
+	assert.NoError(t, connectReplay(filepath.Join("testdata", "profiles", "if-mib.snmprec")))
+	defer disconnect()
+	packets := theStats.counters.packets
+
+	recorder, err := newSampleRecorder("edge-01", "snmp-device", nil, nil)
+	assert.NoError(t, err)
+	for _, c := range mustParseProfile(t, "if-mib") {
+		collectMetricSets(c, recorder.Writer())
+	}
+
+	values := sampleValues(recorder, "ifDescr", "ifName")
+	assert.Equal(t, float64(2), values["ifNumber/"])
+	assert.Equal(t, float64(1500), values["ifMtu/eth0"])
+	assert.Equal(t, float64(987654321), values["ifInOctetsPerSecond/eth0"])
+	assert.Equal(t, float64(5925925926), values["ifHCInOctetsPerSecond/eth0"])
+	for _, e := range recorder.reported() {
+		for _, set := range e.sets {
+			assert.False(t, set.failed(), "%s: %v", set.eventType, set.attributes)
+		}
+	}
+	// Requests go through the whole session, encoding included
+	assert.True(t, theStats.counters.packets > packets)
+}
+
+func TestReplaySnapshot_Empty(t *testing.T) {
+	f, err := ioutil.TempFile("", "nri-snmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	assert.EqualError(t, connectReplay(f.Name()), "replay snapshot "+f.Name()+" is empty")
+}
+
+func TestSnapshotRespond(t *testing.T) {
+	s := newSnapshot("")
+	s.add(integer(".1.3.6.1.2.1.2.2.1.1.2", 2))
+	s.add(integer(".1.3.6.1.2.1.2.2.1.1.10", 10))
+	s.add(integer(".1.3.6.1.2.1.2.2.1.1.1", 1))
+	s.add(octets(".1.3.6.1.2.1.1.5.0", []byte("core-1")))
+	assert.Equal(t, []string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.2.2.1.1.1", ".1.3.6.1.2.1.2.2.1.1.2", ".1.3.6.1.2.1.2.2.1.1.10"}, s.oids)
+
+	get := s.respond(&gosnmp.SnmpPacket{Version: gosnmp.Version2c, PDUType: gosnmp.GetRequest, RequestID: 7, Variables: []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.5.0"}, {Name: ".1.3.6.1.2.1.1.6.0"},
+	}})
+	assert.Equal(t, gosnmp.GetResponse, get.PDUType)
+	assert.Equal(t, uint32(7), get.RequestID)
+	assert.Equal(t, []byte("core-1"), get.Variables[0].Value)
+	assert.Equal(t, gosnmp.NoSuchObject, get.Variables[1].Type)
+
+	bulk := s.respond(&gosnmp.SnmpPacket{Version: gosnmp.Version2c, PDUType: gosnmp.GetBulkRequest, NonRepeaters: 1, MaxRepetitions: 5, Variables: []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.4.0"}, {Name: ".1.3.6.1.2.1.2.2.1.1"},
+	}})
+	var names []string
+	for _, pdu := range bulk.Variables {
+		names = append(names, pdu.Name)
+	}
+	assert.Equal(t, []string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.2.2.1.1.1", ".1.3.6.1.2.1.2.2.1.1.2", ".1.3.6.1.2.1.2.2.1.1.10", ".1.3.6.1.2.1.2.2.1.1.10"}, names)
+	assert.Equal(t, gosnmp.EndOfMibView, bulk.Variables[4].Type)
+}
+
+func TestSnapshotRespond_Recorded(t *testing.T) {
+	s := simulatedData(octets(".1.3.6.1.2.1.1.5.0", []byte("core-1")), integer(".1.3.6.1.2.1.2.2.1.1.1", 1))
+	s.put(".1.3.6.1.2.1.1.6.0", snapshotEntry{pdu: gosnmp.SnmpPDU{Type: gosnmp.NoSuchInstance}})
+	s.put(".1.3.6.1.2.1.2.2.1.1", snapshotEntry{status: gosnmp.GenErr})
+
+	get := s.respond(&gosnmp.SnmpPacket{Version: gosnmp.Version2c, PDUType: gosnmp.GetRequest, Variables: []gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.1.6.0"}}})
+	assert.Equal(t, gosnmp.NoSuchInstance, get.Variables[0].Type)
+	// Walks skip the exceptions
+	next := s.respond(&gosnmp.SnmpPacket{Version: gosnmp.Version2c, PDUType: gosnmp.GetNextRequest, Variables: []gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0"}}})
+	assert.Equal(t, ".1.3.6.1.2.1.2.2.1.1.1", next.Variables[0].Name)
+
+	bulk := s.respond(&gosnmp.SnmpPacket{Version: gosnmp.Version2c, PDUType: gosnmp.GetBulkRequest, MaxRepetitions: 5, Variables: []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.5.0"}, {Name: ".1.3.6.1.2.1.2.2.1.1"},
+	}})
+	assert.Equal(t, gosnmp.GenErr, bulk.Error)
+	assert.Equal(t, uint8(2), bulk.ErrorIndex)
+
+	s.put(".1.3.6.1.2.1.1.5.0", snapshotEntry{report: ".1.3.6.1.6.3.15.1.1.5.0"})
+	report := s.respond(&gosnmp.SnmpPacket{Version: gosnmp.Version2c, PDUType: gosnmp.GetRequest, Variables: []gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0"}}})
+	assert.Equal(t, gosnmp.Report, report.PDUType)
+	assert.Equal(t, ".1.3.6.1.6.3.15.1.1.5.0", report.Variables[0].Name)
+}
+
+func TestSnapshotRecordAndSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nri-snmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "device.snmprec")
+
+	s, err := newRecording(path)
+	assert.NoError(t, err)
+	s.record([]string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.1.6.0"}, &gosnmp.SnmpPacket{PDUType: gosnmp.GetResponse, Variables: []gosnmp.SnmpPDU{
+		octets(".1.3.6.1.2.1.1.5.0", []byte("core-1")),
+		octets(".1.3.6.1.2.1.2.2.1.6.2", []byte{0x52, 0x54, 0x00, 0xa1}),
+		{Name: ".1.3.6.1.2.1.1.6.0", Type: gosnmp.NoSuchObject},
+		{Name: ".1.3.6.1.2.1.1.2.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.9.1.1"},
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(8745123)},
+		{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: gosnmp.Counter64, Value: uint64(5925925926)},
+		{Name: ".1.3.6.1.2.1.4.20.1.1.10.0.0.1", Type: gosnmp.IPAddress, Value: "10.0.0.1"},
+	}})
+	s.record([]string{".1.3.6.1.2.1.2.2.1.10", ".1.3.6.1.2.1.2.2.1.16"}, &gosnmp.SnmpPacket{PDUType: gosnmp.GetResponse, Error: gosnmp.GenErr, ErrorIndex: 2})
+	s.record([]string{".1.3.6.1.2.1.25.1.1.0"}, &gosnmp.SnmpPacket{PDUType: gosnmp.GetResponse, Error: gosnmp.TooBig})
+	var nilSnapshot *snapshot
+	nilSnapshot.record(nil, &gosnmp.SnmpPacket{})
+	assert.NoError(t, nilSnapshot.save())
+	assert.NoError(t, s.save())
+	s.advance()
+
+	// The next run only adds what changed
+	s.record([]string{".1.3.6.1.2.1.31.1.1.1.6.1", ".1.3.6.1.2.1.1.5.0"}, &gosnmp.SnmpPacket{PDUType: gosnmp.GetResponse, Variables: []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: gosnmp.Counter64, Value: uint64(5925935926)},
+		octets(".1.3.6.1.2.1.1.5.0", []byte("core-1")),
+	}})
+	s.record([]string{".1.3.6.1.2.1.1.3.0"}, &gosnmp.SnmpPacket{PDUType: gosnmp.Report, Variables: []gosnmp.SnmpPDU{integer(".1.3.6.1.6.3.15.1.1.5.0", 3)}})
+	assert.NoError(t, s.save())
+
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `1.3.6.1.2.1.1.2.0|6|1.3.6.1.4.1.9.1.1
+1.3.6.1.2.1.1.3.0|67|8745123
+1.3.6.1.2.1.1.5.0|4|core-1
+1.3.6.1.2.1.1.6.0|128|
+1.3.6.1.2.1.2.2.1.6.2|4x|525400a1
+1.3.6.1.2.1.2.2.1.16|e|GenErr
+1.3.6.1.2.1.4.20.1.1.10.0.0.1|64|10.0.0.1
+1.3.6.1.2.1.31.1.1.1.6.1|70|5925925926
+# run 1
+1.3.6.1.2.1.1.3.0|r|1.3.6.1.6.3.15.1.1.5.0
+1.3.6.1.2.1.31.1.1.1.6.1|70|5925935926
+`, string(content))
+
+	// A later run adds to the recording, and a replay goes through the runs
+	s, err = newRecording(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, s.run)
+	s.run = 0
+	counter := func() interface{} {
+		entry, _, _ := s.lookup(".1.3.6.1.2.1.31.1.1.1.6.1")
+		return entry.pdu.Value
+	}
+	assert.Equal(t, uint64(5925925926), counter())
+	s.advance()
+	assert.Equal(t, uint64(5925935926), counter())
+	s.advance()
+	assert.Equal(t, uint64(5925935926), counter())
+	entry, _, _ := s.lookup(".1.3.6.1.2.1.1.5.0")
+	assert.Equal(t, []byte("core-1"), entry.pdu.Value)
+	assert.Len(t, s.oids, 8)
+
+	_, err = loadSnapshot(filepath.Join(dir, "missing.snmprec"), false)
+	assert.Error(t, err)
+	assert.NoError(t, ioutil.WriteFile(path, []byte("1.3.6.1.2.1.1.5.0|99|x\n"), 0644))
+	_, err = loadSnapshot(path, true)
+	assert.EqualError(t, err, "invalid snapshot "+path+": line 1: unsupported tag 99")
+}
+
+func TestReplaySnapshot_Recorded(t *testing.T) {
+	defer func(snmp *gosnmp.GoSNMP, client snmpClient, replay *snapshot) {
+		theSNMP, theClient, theReplay = snmp, client, replay
+	}(theSNMP, theClient, theReplay)
+	f, err := ioutil.TempFile("", "nri-snmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprint(f, `1.3.6.1.2.1.1.5.0|4|core-1
+1.3.6.1.2.1.1.6.0|e|noAccess
+# run 1
+1.3.6.1.2.1.1.5.0|r|1.3.6.1.6.3.15.1.1.3.0
+`)
+	f.Close()
+
+	assert.NoError(t, connectReplay(f.Name()))
+	defer disconnect()
+	result, err := theClient.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte("core-1"), result.Variables[0].Value)
+	}
+	result, err = theClient.Get([]string{".1.3.6.1.2.1.1.5.0", ".1.3.6.1.2.1.1.6.0"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, gosnmp.NoAccess, result.Error)
+		assert.Equal(t, uint8(2), result.ErrorIndex)
+	}
+
+	theReplay.advance()
+	result, err = theClient.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	if assert.NoError(t, err) {
+		assert.Error(t, checkReport(result))
+	}
+}
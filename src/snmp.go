@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	sdkArgs "github.com/newrelic/infra-integrations-sdk/args"
 	"github.com/newrelic/infra-integrations-sdk/data/metric"
@@ -19,21 +20,54 @@ import (
 
 type argumentList struct {
 	sdkArgs.DefaultArgumentList
-	SNMPHost           string `default:"127.0.0.1" help:"Hostname or IP where the SNMP server is running."`
-	SNMPPort           int    `default:"161" help:"Port on which SNMP server is listening."`
-	Timeout            int    `default:"10" help:"The number of seconds to wait before a request times out."`
-	Retries            int    `default:"0" help:"The number of attemps to fetch metrics."`
-	ExponentialTimeout bool   `default:"false" help:"Double timeout in each attempt."`
-	Community          string `default:"public" help:"SNMP Version 2 Community string "`
-	V3                 bool   `default:"false" help:"Use SNMP Version 3."`
-	SecurityLevel      string `default:"" help:"Valid values are noAuthnoPriv, authNoPriv or authPriv"`
-	Username           string `default:"" help:"The security name that identifies the SNMPv3 user."`
-	AuthProtocol       string `default:"SHA" help:"The algorithm used for SNMPv3 authentication (SHA or MD5)."`
-	AuthPassphrase     string `default:"" help:"The password used to generate the key used for SNMPv3 authentication."`
-	PrivProtocol       string `default:"AES" help:"The algorithm used for SNMPv3 message integrity."`
-	PrivPassphrase     string `default:"" help:"The password used to generate the key used to verify SNMPv3 message integrity."`
-	CollectionFiles    string `default:"" help:"A comma separated list of full paths to metrics configuration files"`
-	ShowVersion        bool   `default:"false" help:"Print build information and exit"`
+	SNMPHost               string `default:"127.0.0.1" help:"Hostname or IP where the SNMP server is running."`
+	SNMPPort               int    `default:"161" help:"Port on which SNMP server is listening."`
+	Timeout                int    `default:"10" help:"The number of seconds to wait before a request times out."`
+	Retries                int    `default:"0" help:"The number of attemps to fetch metrics."`
+	ExponentialTimeout     bool   `default:"false" help:"Double timeout in each attempt."`
+	Community              string `default:"public" help:"SNMP Version 2 Community string "`
+	V3                     bool   `default:"false" help:"Use SNMP Version 3."`
+	SecurityLevel          string `default:"" help:"Valid values are noAuthnoPriv, authNoPriv or authPriv"`
+	Username               string `default:"" help:"The security name that identifies the SNMPv3 user."`
+	AuthProtocol           string `default:"SHA" help:"The algorithm used for SNMPv3 authentication (SHA or MD5)."`
+	AuthPassphrase         string `default:"" help:"The password used to generate the key used for SNMPv3 authentication."`
+	PrivProtocol           string `default:"AES" help:"The algorithm used for SNMPv3 message integrity."`
+	PrivPassphrase         string `default:"" help:"The password used to generate the key used to verify SNMPv3 message integrity."`
+	CollectionFiles        string `default:"" help:"A comma separated list of full paths to metrics configuration files"`
+	Profiles               string `default:"" help:"A comma separated list of bundled device profiles to collect (e.g. if-mib,host-resources-mib)"`
+	Topology               bool   `default:"false" help:"Collect LLDP and CDP neighbour topology."`
+	EntityName             string `default:"${host}:${port}" help:"Template for the entity name. Supports $host, $port, $alias, $sysName and $sysObjectID"`
+	EntityType             string `default:"address" help:"The entity type (namespace) of the reported device."`
+	EntityIDAttributes     string `default:"" help:"A comma separated list of identity values added as entity ID attributes (host, port, alias, sysName, sysObjectID, engineID)"`
+	Alias                  string `default:"" help:"A user defined name for the device, available to the entity name template as $alias"`
+	ExporterAddress        string `default:"" help:"Run as an OpenMetrics exporter serving /metrics on this address (e.g. :9116) instead of reporting once."`
+	ExporterCacheTTL       int    `default:"0" help:"Seconds a scrape result is served to later scrapes. 0 polls the device on every scrape."`
+	OTLPEndpoint           string `default:"" help:"OTLP/HTTP metrics endpoint (e.g. http://localhost:4318/v1/metrics) for collection files with output: otlp"`
+	OTLPHeaders            string `default:"" help:"A comma separated list of key=value headers sent to the OTLP endpoint"`
+	JSONLinesFile          string `default:"" help:"File that collection files with output: jsonl append one JSON object per sample to"`
+	Attributes             string `default:"" help:"A comma separated list of key=value attributes added to every sample. Values may reference $sysName, $sysLocation and the other identity values"`
+	Daemon                 bool   `default:"false" help:"Keep running and poll each metric set on its own interval, publishing a payload every time metric sets are polled."`
+	Interval               int    `default:"60" help:"Default polling interval in seconds of the metric sets and inventory in daemon mode."`
+	MaxOids                int    `default:"0" help:"Maximum number of OIDs in a single GET request. 0 uses 8900 for SNMP v2c and 60 for v3."`
+	MaxRepetitions         int    `default:"50" help:"The max-repetitions of GETBULK requests used to walk tables (1-255). The upper bound in adaptive mode."`
+	AdaptiveMaxRepetitions bool   `default:"false" help:"Halve the max-repetitions when the device times out or answers tooBig and grow it back on success, remembering the learned value between runs."`
+	MaxOidsPerRequest      int    `default:"60" help:"Maximum number of OIDs sent in each GET of a scalar metric set. Requests the device answers with tooBig are split further."`
+	IndexCacheTTL          int    `default:"0" help:"Seconds the index columns of tables are cached, on disk between runs, so that only the metric columns are walked. 0 disables the cache."`
+	BreakerThreshold       int    `default:"3" help:"Consecutive failed probes after which the target is only probed, on a backoff schedule, until it answers. 0 disables the circuit breaker."`
+	BreakerMaxBackoff      int    `default:"3600" help:"Maximum number of seconds between the probes of a target whose circuit breaker is open."`
+	DryRun                 bool   `default:"false" help:"Poll the metric sets and print each OID, its value and the metric made of it instead of publishing a payload."`
+	Generate               string `default:"" help:"Walk the subtree under this OID and print a draft collection file of its scalars and tables."`
+	GenerateFromWalk       string `default:"" help:"Read the walk to generate a collection file from this file, saved with snmpwalk -One, instead of walking the target."`
+	MibFiles               string `default:"" help:"A comma separated list of MIB files used to name the generated metrics and find the index of the tables."`
+	RecordFile             string `default:"" help:"Save every variable the target returns during the run to this snapshot file, in the snmprec format."`
+	ReplayFile             string `default:"" help:"Answer the requests from this snapshot file, in the snmprec format, instead of the target."`
+	Simulate               string `default:"" help:"Run an SNMP agent on the target address and port answering from this snapshot file, in the snmprec format, with the version and credentials of the connection arguments."`
+	SimulateDelay          int    `default:"0" help:"Milliseconds the simulated agent waits before answering each request."`
+	SimulateLoss           int    `default:"0" help:"Percentage of the requests the simulated agent drops without answering."`
+	SimulateErrors         string `default:"" help:"A comma separated list of oid=status, e.g. .1.3.6.1.2.1.2.2=genErr, of the subtrees the simulated agent answers with an error."`
+	SimulateCounterStep    int    `default:"0" help:"Added by the simulated agent to a counter every time it is read."`
+	Validate               bool   `default:"false" help:"Check the collection files and profiles offline, print the problems found and exit non-zero if there are any."`
+	ShowVersion            bool   `default:"false" help:"Print build information and exit"`
 }
 
 const (
@@ -50,6 +84,9 @@ var theSNMP *gosnmp.GoSNMP
 var targetHost string
 var targetPort int
 
+// deviceIdentity holds the identity values of the target, available to attribute templates
+var deviceIdentity map[string]string
+
 func main() {
 	// Create Integration
 	snmpIntegration, err := integration.New(integrationName, integrationVersion, integration.Args(&args))
@@ -70,96 +107,302 @@ func main() {
 		os.Exit(0)
 	}
 
+	if args.Validate {
+		os.Exit(runValidate(os.Stdout))
+	}
+
 	targetHost = strings.TrimSpace(args.SNMPHost)
 	targetPort = args.SNMPPort
+
+	// The simulated agent serves until killed
+	if args.Simulate != "" {
+		if err := runSimulator(args.Simulate); err != nil {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	// A saved walk is turned into a collection file without the target
+	if args.GenerateFromWalk != "" {
+		if err := runGenerate(args.Generate, os.Stdout); err != nil {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if store, err := openDeviceState(); err != nil {
+		log.Warn("unable to open the state of target %s, it won't be kept between runs. %v", targetHost, err)
+	} else {
+		theDeviceState = store
+	}
+
 	err = connect(targetHost, targetPort)
 	if err != nil {
 		log.Error("Error connecting to snmp server " + targetHost)
 		log.Error(err.Error())
+		reportUnreachable(snmpIntegration, err)
 		return
 	}
 	defer disconnect()
 
-	// Ensure a collection file is specified
-	if args.CollectionFiles == "" {
-		log.Error("Must specify at least one collection file")
+	if args.RecordFile != "" {
+		theRecording, err = newRecording(args.RecordFile)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		// Dry runs and generated collections don't save the state of the target
+		if args.DryRun || args.Generate != "" {
+			defer saveRecording()
+		}
+	}
+
+	if args.Generate != "" {
+		theRepetitions = newRepetitionTuner(args.MaxRepetitions, false, 0)
+		if err := runGenerate(args.Generate, os.Stdout); err != nil {
+			log.Error(err.Error())
+		}
+		return
+	}
+
+	// Ensure a collection file or profile is specified
+	if args.CollectionFiles == "" && args.Profiles == "" {
+		log.Error("Must specify at least one collection file or profile")
+		return
+	}
+
+	collections, err := loadCollections()
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+
+	// The custom attributes of the target are checked before it is polled
+	if _, err := deviceAttributes(baseIdentity()); err != nil {
+		log.Error(err.Error())
+		return
+	}
+	learnedRepetitions := 0
+	if args.AdaptiveMaxRepetitions {
+		if _, err := theDeviceState.Get(maxRepetitionsKey, &learnedRepetitions); err == nil {
+			log.Debug("using learned max repetitions %d", learnedRepetitions)
+		}
+	}
+	theRepetitions = newRepetitionTuner(args.MaxRepetitions, args.AdaptiveMaxRepetitions, learnedRepetitions)
+	if args.IndexCacheTTL > 0 {
+		theIndexCache, err = newIndexCache(time.Duration(args.IndexCacheTTL) * time.Second)
+		if err != nil {
+			log.Warn("unable to open index cache, walking whole tables. %v", err)
+		}
+	}
+
+	// The daemon probes the target and resolves its identity on every run. A dry
+	// run polls once, even in daemon mode.
+	if args.Daemon && !args.DryRun {
+		runDaemon(snmpIntegration, collections)
+		return
+	}
+
+	// The target is probed before its identity is read, so a target that
+	// doesn't answer costs a single probe
+	status := checkTarget(time.Now())
+	deviceIdentity = baseIdentity()
+	if status.reachable {
+		deviceIdentity = resolveDeviceIdentity(identityReferences(collections))
+	}
+	attributes, err := deviceAttributes(deviceIdentity)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+
+	// A dry run only prints what would be reported
+	if args.DryRun {
+		if err := runExplain(collections, os.Stdout); err != nil {
+			log.Error(err.Error())
+		}
+		return
+	}
+
+	entity, err := newDeviceEntity(snmpIntegration, deviceIdentity)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+
+	if args.ExporterAddress != "" {
+		e := newExporter(collections, entity, attributes, time.Duration(args.ExporterCacheTTL)*time.Second)
+		if err := runExporter(args.ExporterAddress, e); err != nil {
+			log.Error(err.Error())
+		}
 		return
 	}
 
-	// For each collection definition file, parse and collect it
-	collectionFiles := strings.Split(args.CollectionFiles, ",")
+	// Each collection is reported through the sink of its output format
+	sinks, err := newSinks(snmpIntegration, entity, attributes)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	status.report(sinks[outputEvent].Writer())
+	if !status.breakerOpen {
+		runCollections(collections, sinks)
+
+		if args.Topology {
+			if err := populateTopology(sinks[outputEvent].Writer()); err != nil {
+				log.Error("unable to populate topology. %v", err)
+			}
+		}
+	}
+
+	theStats.report(sinks[outputEvent].Writer())
+	publishSinks(sinks)
+	saveState()
+}
+
+// loadCollections parses the collection files and the bundled profiles
+func loadCollections() ([]*collection, error) {
+	var collections []*collection
+
+	// For each collection definition file, parse it
+	var collectionFiles []string
+	if args.CollectionFiles != "" {
+		collectionFiles = strings.Split(args.CollectionFiles, ",")
+	}
 	for _, collectionFile := range collectionFiles {
 
 		// Check that the filepath is an absolute path
 		if !filepath.IsAbs(collectionFile) {
-			log.Error("invalid metrics collection path %s. Metrics collection files must be specified as absolute paths.", collectionFile)
-			return
+			return nil, fmt.Errorf("invalid metrics collection path %s. Metrics collection files must be specified as absolute paths", collectionFile)
 		}
 
 		// Parse the yaml file into a raw definition
 		collectionParser, err := parseYaml(collectionFile)
 		if err != nil {
-			log.Error("failed to parse collection definition file: " + collectionFile)
-			log.Error(err.Error())
-			return
+			return nil, fmt.Errorf("failed to parse collection definition file %s: %v", collectionFile, err)
 		}
-		collections, err := parseCollection(collectionParser)
+		fileCollections, err := parseCollection(collectionParser)
 		if err != nil {
-			log.Error("failed to parse collection definition: " + collectionFile)
-			log.Error(err.Error())
-			return
+			return nil, fmt.Errorf("failed to parse collection definition %s: %v", collectionFile, err)
 		}
+		collections = append(collections, fileCollections...)
+	}
 
-		for _, collection := range collections {
-			if err := runCollection(collection, snmpIntegration); err != nil {
-				log.Error("failed to complete collection execution")
-				log.Error(err.Error())
-			}
+	// For each bundled profile, parse it
+	var profiles []string
+	if args.Profiles != "" {
+		profiles = strings.Split(args.Profiles, ",")
+	}
+	for _, profile := range profiles {
+		collectionParser, err := parseProfile(profile)
+		if err != nil {
+			return nil, err
+		}
+		profileCollections, err := parseCollection(collectionParser)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse profile definition %s: %v", profile, err)
+		}
+		collections = append(collections, profileCollections...)
+	}
+	return collections, nil
+}
+
+// runCollections writes the metric sets of each collection into the sink of its
+// output and the inventory into the event sink
+func runCollections(collections []*collection, sinks map[string]sink) {
+	for _, collection := range collections {
+		s, ok := sinks[collection.Output]
+		if !ok {
+			log.Error("collection %s requests %s output which is not configured", collection.Device, collection.Output)
+			continue
 		}
+		collectMetricSets(collection, s.Writer())
+		collectInventory(collection, sinks[outputEvent].Writer())
 	}
+}
 
-	if err := snmpIntegration.Publish(); err != nil {
-		log.Error(err.Error())
+// collectMetricSets polls the metric sets of a collection and writes them into writer
+func collectMetricSets(collection *collection, writer sampleWriter) {
+	for _, metricSet := range collection.MetricSets {
+		collectMetricSet(collection.Device, metricSet, writer)
 	}
 }
 
-func runCollection(collection *collection, i *integration.Integration) error {
+// collectMetricSet polls a single metric set and writes it into writer
+func collectMetricSet(device string, metricSet metricSet, writer sampleWriter) {
+	start, before := time.Now(), theStats.counters
+	defer func() {
+		theStats.addMetricSet(device, metricSet.Name, time.Since(start), before)
+	}()
+	defer overrideSession(metricSet)()
+	theWalkBudget = newWalkBudget(metricSet.MaxWalkDuration, metricSet.MaxWalkRows, tableColumns(metricSet), start)
+	defer func() { theWalkBudget = nil }()
+
 	var err error
-	// Create an entity for the host
-	entity, err := i.Entity(fmt.Sprintf("%s:%d", targetHost, targetPort), "address")
-	if err != nil {
-		return err
+	metricSetType := metricSet.Type
+	switch metricSetType {
+	case "scalar":
+		err = populateScalarMetrics(device, metricSet, writer)
+		if err != nil {
+			log.Error("unable to populate metrics for scalar metric set [%s]. %v", metricSet.Name, err)
+			reportError(device, metricSet, writer, err)
+		}
+	case "table":
+		err = populateTableMetrics(device, metricSet, writer)
+		if err != nil {
+			log.Error("unable to populate metrics for table [%v] %v", metricSet.RootOid, err)
+			reportError(device, metricSet, writer, err)
+		}
+	default:
+		log.Error("invalid `metric_set` type: %s. check collection file", metricSetType)
 	}
+}
 
-	device := collection.Device
-	for _, metricSet := range collection.MetricSets {
-		metricSetType := metricSet.Type
-		switch metricSetType {
-		case "scalar":
-			err = populateScalarMetrics(device, metricSet, entity)
-			if err != nil {
-				log.Error("unable to populate metrics for scalar metric set [%s]. %v", metricSet.Name, err)
-				reportError(device, metricSet, entity, err.Error())
-			}
-		case "table":
-			err = populateTableMetrics(device, metricSet, entity)
-			if err != nil {
-				log.Error("unable to populate metrics for table [%v] %v", metricSet.RootOid, err)
-				reportError(device, metricSet, entity, err.Error())
-			}
-		default:
-			log.Error("invalid `metric_set` type: %s. check collection file", metricSetType)
-		}
+// overrideSession applies the timeout and retries of a metric set to the
+// session and returns the function that restores them
+func overrideSession(metricSet metricSet) func() {
+	if theSNMP == nil {
+		return func() {}
+	}
+	timeout, retries := theSNMP.Timeout, theSNMP.Retries
+	if metricSet.Timeout > 0 {
+		theSNMP.Timeout = metricSet.Timeout
+	}
+	if metricSet.Retries != nil {
+		theSNMP.Retries = *metricSet.Retries
 	}
-	err = populateInventory(collection.Inventory, entity)
+	return func() {
+		theSNMP.Timeout, theSNMP.Retries = timeout, retries
+	}
+}
+
+// collectInventory polls the inventory items and tables of a collection
+func collectInventory(collection *collection, writer sampleWriter) {
+	err := populateInventory(collection.Inventory, writer)
 	if err != nil {
 		log.Error("unable to populate inventory. %s", err)
 	}
-	return nil
+	err = populateTableInventory(collection.InventoryTables, writer)
+	if err != nil {
+		log.Error("unable to populate table inventory. %s", err)
+	}
 }
 
-func reportError(device string, metricSet metricSet, entity *integration.Entity, errorMessage string) {
-	ms := entity.NewMetricSet(metricSet.EventType)
+// reportError writes the sample of a metric set that failed. SNMPv3 reports and
+// truncated walks are reported with their own error code and a hint on how to
+// fix them.
+func reportError(device string, metricSet metricSet, writer sampleWriter, collectErr error) {
+	theExplain.fail(collectErr)
+	errorCode, errorMessage, errorHint := "SNMPError", collectErr.Error(), ""
+	switch e := collectErr.(type) {
+	case *snmpReportError:
+		errorCode, errorMessage, errorHint = e.report.code, e.message(), e.report.hint
+	case *walkTruncatedError:
+		errorCode, errorHint = "walkTruncated", "the rows read before the limit were reported, raise max_walk_duration or max_walk_rows of the metric set"
+	}
+
+	ms := writer.NewMetricSet(metricSet.EventType, expandAttributes(metricSet.Attributes, deviceIdentity)...)
 	err := ms.SetMetric("device", device, metric.ATTRIBUTE)
 	if err != nil {
 		log.Error(err.Error())
@@ -168,7 +411,7 @@ func reportError(device string, metricSet metricSet, entity *integration.Entity,
 	if err != nil {
 		log.Error(err.Error())
 	}
-	err = ms.SetMetric("errorCode", "SNMPError", metric.ATTRIBUTE)
+	err = ms.SetMetric("errorCode", errorCode, metric.ATTRIBUTE)
 	if err != nil {
 		log.Error(err.Error())
 	}
@@ -176,4 +419,10 @@ func reportError(device string, metricSet metricSet, entity *integration.Entity,
 	if err != nil {
 		log.Error(err.Error())
 	}
+	if errorHint != "" {
+		err = ms.SetMetric("errorHint", errorHint, metric.ATTRIBUTE)
+		if err != nil {
+			log.Error(err.Error())
+		}
+	}
 }
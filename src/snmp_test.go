@@ -4,10 +4,222 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
+	"sort"
 	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/inventory"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
 )
 
-// Insert here the logic for your tests
-func TestPlaceholder(t *testing.T) {
-	t.Skipped()
+func TestCollectMetricSets_Simulated(t *testing.T) {
+	data := mustLoadSnapshot(t, "host-resources-mib")
+	defer simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public"}, simulatorConfig{CounterIncrement: 5}, data)()
+
+	var values []map[string]float64
+	for poll := 0; poll < 2; poll++ {
+		recorder, err := newSampleRecorder("edge-01", "snmp-device", nil, nil)
+		assert.NoError(t, err)
+		for _, c := range mustParseProfile(t, "host-resources-mib") {
+			collectMetricSets(c, recorder.Writer())
+		}
+		for _, e := range recorder.reported() {
+			for _, set := range e.sets {
+				assert.False(t, set.failed(), "%s: %v", set.eventType, set.attributes)
+			}
+		}
+		values = append(values, sampleValues(recorder, "hrStorageDescr", "hrProcessorFrwID"))
+	}
+
+	// Scalars
+	assert.Equal(t, float64(187), values[0]["hrSystemProcesses/"])
+	assert.Equal(t, float64(8167048), values[0]["hrMemorySize/"])
+	// Table rows, with their index
+	assert.Equal(t, float64(4096), values[0]["hrStorageAllocationUnits//"])
+	assert.Equal(t, float64(8340012), values[0]["hrStorageUsed//"])
+	assert.Equal(t, float64(6022016), values[0]["hrStorageUsed/Physical memory"])
+	// Counters grow between polls
+	assert.Equal(t, float64(0), values[0]["hrStorageAllocationFailures/Virtual memory"])
+	assert.Equal(t, float64(5), values[1]["hrStorageAllocationFailures/Virtual memory"])
+	assert.Equal(t, values[0]["hrStorageUsed/Physical memory"], values[1]["hrStorageUsed/Physical memory"])
+}
+
+func TestCollectMetricSets_SimulatedErrors(t *testing.T) {
+	data := simulatedData(
+		octets(".1.3.6.1.2.1.1.1.0", []byte("Linux edge-01")),
+		octets(".1.3.6.1.2.1.1.5.0", []byte("edge-01")),
+		integer(".1.3.6.1.2.1.2.2.1.1.1", 1),
+		integer(".1.3.6.1.2.1.2.2.1.4.1", 1500),
+	)
+	defer simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public"}, simulatorConfig{
+		Errors: map[string]gosnmp.SNMPError{".1.3.6.1.2.1.1.5.0": gosnmp.NoAccess, ".1.3.6.1.2.1.2.2": gosnmp.GenErr},
+	}, data)()
+
+	recorder, err := newSampleRecorder("edge-01", "snmp-device", nil, nil)
+	assert.NoError(t, err)
+	collectMetricSets(&collection{
+		Device: "edge-01",
+		MetricSets: []metricSet{
+			{
+				Name: "system", Type: "scalar", EventType: "SNMPSample",
+				Metrics: []*metricDef{
+					{oid: ".1.3.6.1.2.1.1.1.0", metricName: "sysDescr", metricType: -1},
+					{oid: ".1.3.6.1.2.1.1.5.0", metricName: "sysName", metricType: -1},
+				},
+			},
+			{
+				Name: "interfaces", Type: "table", EventType: "SNMPInterfaceSample", RootOid: ".1.3.6.1.2.1.2.2.1",
+				Index:   []*index{{oid: ".1.3.6.1.2.1.2.2.1.1", name: "ifIndex"}},
+				Metrics: []*metricDef{{oid: ".1.3.6.1.2.1.2.2.1.4", metricName: "ifMtu", metricType: -1}},
+			},
+		},
+	}, recorder.Writer())
+
+	sets := recorder.device.sets
+	if assert.Len(t, sets, 2) {
+		// The OIDs that failed are isolated, the others still reported
+		assert.Equal(t, "Linux edge-01", sets[0].attributes["sysDescr"])
+		assert.Equal(t, ".1.3.6.1.2.1.1.5.0=ERR_NoAccess", sets[0].attributes["failedOids"])
+		assert.Equal(t, "interfaces", sets[1].attributes["name"])
+		assert.True(t, sets[1].failed())
+	}
+}
+
+func TestCollectMetricSet_MaxWalkRows(t *testing.T) {
+	var pdus []gosnmp.SnmpPDU
+	for i := 1; i <= 4; i++ {
+		pdus = append(pdus,
+			octets(fmt.Sprintf(".1.3.6.1.2.1.2.2.1.2.%d", i), []byte(fmt.Sprintf("eth%d", i))),
+			gosnmp.SnmpPDU{Name: fmt.Sprintf(".1.3.6.1.2.1.2.2.1.10.%d", i), Type: gosnmp.Counter32, Value: uint(i * 100)},
+			gosnmp.SnmpPDU{Name: fmt.Sprintf(".1.3.6.1.2.1.2.2.1.16.%d", i), Type: gosnmp.Counter32, Value: uint(i * 10)})
+	}
+	defer simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public"}, simulatorConfig{}, simulatedData(pdus...))()
+
+	ms := metricSet{
+		Name:      "interfaces",
+		Type:      "table",
+		EventType: "SNMPInterfaceSample",
+		RootOid:   ".1.3.6.1.2.1.2.2.1",
+		Index:     []*index{{oid: ".1.3.6.1.2.1.2.2.1.2", name: "ifDescr"}},
+		Metrics: []*metricDef{
+			{oid: ".1.3.6.1.2.1.2.2.1.10", metricName: "ifInOctets", metricType: metric.GAUGE},
+			{oid: ".1.3.6.1.2.1.2.2.1.16", metricName: "ifOutOctets", metricType: metric.GAUGE},
+		},
+		MaxWalkRows: 2,
+	}
+	recorder, err := newSampleRecorder("edge-01", "snmp-device", nil, nil)
+	assert.NoError(t, err)
+	collectMetricSet("edge", ms, recorder.Writer())
+
+	// The rows kept are complete, the truncation is reported besides them
+	var rows []string
+	truncated := false
+	for _, set := range recorder.reported()[0].sets {
+		if set.failed() {
+			assert.Equal(t, "walkTruncated", set.attributes["errorCode"])
+			truncated = true
+			continue
+		}
+		rows = append(rows, set.attributes["ifDescr"])
+		assert.Len(t, set.metrics, 2, set.attributes["ifDescr"])
+	}
+	sort.Strings(rows)
+	assert.Equal(t, []string{"eth1", "eth2"}, rows)
+	assert.True(t, truncated)
+}
+
+func TestDropPartialRows(t *testing.T) {
+	ms := metricSet{
+		Index:   []*index{{oid: ".1.3.6.1.2.1.2.2.1.2", name: "ifDescr"}},
+		Metrics: []*metricDef{{oid: ".1.3.6.1.2.1.2.2.1.10"}, {oid: ".1.3.6.1.2.1.2.2.1.16"}},
+	}
+	pdus := pduMap(
+		octets(".1.3.6.1.2.1.2.2.1.2.1", []byte("eth1")), octets(".1.3.6.1.2.1.2.2.1.2.2", []byte("eth2")),
+		integer(".1.3.6.1.2.1.2.2.1.10.1", 1), integer(".1.3.6.1.2.1.2.2.1.10.2", 2),
+		integer(".1.3.6.1.2.1.2.2.1.16.1", 1))
+	// The walk ran out of time after the ifOutOctets of the first row
+	e := &walkTruncatedError{lastOid: ".1.3.6.1.2.1.2.2.1.16.1"}
+	dropPartialRows(ms, pdus, func(column, oid string) bool { return e.read(oid) })
+	assert.Equal(t, pduMap(
+		octets(".1.3.6.1.2.1.2.2.1.2.1", []byte("eth1")),
+		integer(".1.3.6.1.2.1.2.2.1.10.1", 1),
+		integer(".1.3.6.1.2.1.2.2.1.16.1", 1)), pdus)
+}
+
+func TestCollectMetricSet_SessionOverride(t *testing.T) {
+	defer simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public", Timeout: time.Second, Retries: 1},
+		simulatorConfig{}, simulatedData(integer(".1.3.6.1.2.1.1.7.0", 72)))()
+	sessions := &sessionClient{snmpClient: theClient}
+	theClient = sessions
+
+	retries := 3
+	overridden := metricSet{Name: "slow", Type: "scalar", EventType: "SNMPSample", Timeout: 5 * time.Second, Retries: &retries,
+		Metrics: []*metricDef{{oid: ".1.3.6.1.2.1.1.7.0", metricName: "sysServices", metricType: metric.GAUGE}}}
+	plain := overridden
+	plain.Name, plain.Timeout, plain.Retries = "fast", 0, nil
+	collectMetricSet("edge", overridden, discardWriter{})
+	collectMetricSet("edge", plain, discardWriter{})
+
+	// The override of a metric set doesn't leak into the next one
+	assert.Equal(t, []string{"5s/3", "1s/1"}, sessions.seen)
+	assert.Equal(t, time.Second, theSNMP.Timeout)
+	assert.Equal(t, 1, theSNMP.Retries)
+}
+
+// sessionClient records the timeout and retries of the session of each GET
+type sessionClient struct {
+	snmpClient
+	seen []string
+}
+
+func (c *sessionClient) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	c.seen = append(c.seen, fmt.Sprintf("%s/%d", theSNMP.Timeout, theSNMP.Retries))
+	return c.snmpClient.Get(oids)
+}
+
+func TestPopulateInventory_Simulated(t *testing.T) {
+	data := simulatedData(
+		octets(".1.3.6.1.2.1.1.1.0", []byte("Linux edge-01")),
+		gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.1.2.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.8072.3.2.10"},
+		octets(".1.3.6.1.2.1.47.1.1.1.1.7.1", []byte("Chassis")),
+		octets(".1.3.6.1.2.1.47.1.1.1.1.7.2", []byte("PSU 1")),
+		octets(".1.3.6.1.2.1.47.1.1.1.1.11.1", []byte("FOC1234X0AB")),
+		octets(".1.3.6.1.2.1.47.1.1.1.1.11.2", []byte("LIT0987")),
+	)
+	defer simulate(t, &gosnmp.GoSNMP{
+		Version: gosnmp.Version3, SecurityModel: gosnmp.UserSecurityModel, MsgFlags: gosnmp.AuthPriv,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{
+			UserName:                 "monitor",
+			AuthenticationProtocol:   gosnmp.SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          gosnmp.AES,
+			PrivacyPassphrase:        "privpassword",
+		},
+	}, simulatorConfig{}, data)()
+
+	i, err := integration.New("test", "0.0.0", integration.InMemoryStore(), integration.Writer(ioutil.Discard))
+	assert.NoError(t, err)
+	entity := i.LocalEntity()
+	writer := &sdkWriter{integration: i, entity: entity}
+	assert.NoError(t, populateInventory([]inventoryItem{
+		{oid: ".1.3.6.1.2.1.1.1.0", category: "system", name: "sysDescr"},
+		{oid: ".1.3.6.1.2.1.1.2.0", category: "system", name: "sysObjectID"},
+	}, writer))
+	assert.NoError(t, populateTableInventory([]inventoryTable{{
+		rootOid:  ".1.3.6.1.2.1.47.1.1.1.1",
+		category: "hardware/${entPhysicalName}",
+		index:    []*index{{oid: ".1.3.6.1.2.1.47.1.1.1.1.7", name: "entPhysicalName"}},
+		fields:   []*inventoryItem{{oid: ".1.3.6.1.2.1.47.1.1.1.1.11", name: "serialNumber"}},
+	}}, writer))
+
+	assert.Equal(t, inventory.Items{
+		"system":           {"sysDescr": "Linux edge-01", "sysObjectID": ".1.3.6.1.4.1.8072.3.2.10"},
+		"hardware/Chassis": {"entPhysicalName": "Chassis", "serialNumber": "FOC1234X0AB"},
+		"hardware/PSU 1":   {"entPhysicalName": "PSU 1", "serialNumber": "LIT0987"},
+	}, entity.Inventory.Items())
 }
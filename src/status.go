@@ -0,0 +1,168 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/soniah/gosnmp"
+)
+
+// statusEventType is the event type of the reachability samples
+const statusEventType = "SNMPStatusSample"
+
+// Error classes of the requests that fail
+const (
+	errorClassTimeout         = "timeout"
+	errorClassAuthFailure     = "authFailure"
+	errorClassConnection      = "connectionError"
+	errorClassSNMP            = "snmpError"
+	errorClassUnknownUserName = "unknownUserName"
+	errorClassUnknownEngineID = "unknownEngineID"
+	errorClassWrongDigest     = "wrongDigest"
+	errorClassDecryption      = "decryptionError"
+	errorClassCircuitOpen     = "circuitOpen"
+)
+
+// gosnmpNotAuthentic is the error gosnmp returns when a response fails the
+// SNMPv3 authentication check. gosnmp has no error value for it.
+const gosnmpNotAuthentic = "Incoming packet is not authentic, discarding"
+
+// theSysUpTime is the uptime of the target read by the probe of the current
+// run, nil when the target wasn't probed or didn't answer
+var theSysUpTime *sysUpTime
+
+// sysUpTime is a reading of sysUpTime.0
+type sysUpTime struct {
+	// ticks is the uptime in hundredths of a second
+	ticks  uint32
+	readAt time.Time
+}
+
+// bootTime returns the time the SNMP agent of the target last started
+func (u *sysUpTime) bootTime() time.Time {
+	return u.readAt.Add(-time.Duration(u.ticks) * 10 * time.Millisecond)
+}
+
+// deviceStatus is the outcome of the reachability probe of the target. The
+// target is reachable when it answers the probe without errors.
+type deviceStatus struct {
+	reachable    bool
+	responseTime time.Duration
+	errorClass   string
+	errorMessage string
+	// breakerOpen is set when the target is only probed until it answers again
+	breakerOpen bool
+	// failures is the number of consecutive failed probes
+	failures int
+	// uptime is the uptime read by the probe, nil when it failed
+	uptime *sysUpTime
+}
+
+// probeDevice reads sysUpTime.0 to check that the target answers
+func probeDevice(client snmpClient) deviceStatus {
+	start := time.Now()
+	result, err := client.Get([]string{sysUpTimeOid})
+	status := deviceStatus{responseTime: time.Since(start)}
+	status.errorClass, status.errorMessage = classifyError(result, err)
+	status.reachable = status.errorClass == ""
+	if status.reachable && len(result.Variables) > 0 {
+		if ticks, ok := result.Variables[0].Value.(uint32); ok {
+			status.uptime = &sysUpTime{ticks: ticks, readAt: time.Now()}
+		}
+	}
+	return status
+}
+
+// unreachableStatus is the status of a target the session can't be opened to
+func unreachableStatus(err error) deviceStatus {
+	errorClass, errorMessage := classifyError(nil, err)
+	return deviceStatus{errorClass: errorClass, errorMessage: errorMessage}
+}
+
+// reportUnreachable publishes the status of a target the session can't be opened to
+func reportUnreachable(i *integration.Integration, connectErr error) {
+	deviceIdentity = baseIdentity()
+	attributes, err := deviceAttributes(deviceIdentity)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	entity, err := newDeviceEntity(i, deviceIdentity)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	sinks, err := newSinks(i, entity, attributes)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	status := unreachableStatus(connectErr)
+	b := loadBreaker()
+	b.record(false, time.Now())
+	status.breakerOpen, status.failures = b.state.Open, b.state.Failures
+	status.report(sinks[outputEvent].Writer())
+	publishSinks(sinks)
+	saveState()
+}
+
+// classifyError returns the error class and message of a request, empty when it succeeded
+func classifyError(result *gosnmp.SnmpPacket, err error) (string, string) {
+	if err != nil {
+		if e, ok := err.(*snmpReportError); ok {
+			return e.report.code, err.Error()
+		}
+		switch {
+		case isTimeout(err):
+			return errorClassTimeout, err.Error()
+		case err.Error() == gosnmpNotAuthentic:
+			return errorClassAuthFailure, err.Error()
+		default:
+			return errorClassConnection, err.Error()
+		}
+	}
+	if result.Error != gosnmp.NoError {
+		return errorClassSNMP, getErrorMessage(result.Error)
+	}
+	if err := checkReport(result); err != nil {
+		return err.(*snmpReportError).report.code, err.Error()
+	}
+	return "", ""
+}
+
+// report writes the SNMPStatusSample of the target
+func (s deviceStatus) report(writer sampleWriter) {
+	breakerState := "closed"
+	if s.breakerOpen {
+		breakerState = "open"
+	}
+	ms := writer.NewMetricSet(statusEventType, attribute.Attr("breakerState", breakerState))
+	reachable := 0
+	if s.reachable {
+		reachable = 1
+	}
+	if err := ms.SetMetric("reachable", reachable, metric.GAUGE); err != nil {
+		log.Error(err.Error())
+	}
+	if err := ms.SetMetric("consecutiveFailures", s.failures, metric.GAUGE); err != nil {
+		log.Error(err.Error())
+	}
+	if s.reachable {
+		if err := ms.SetMetric("responseTimeMs", float64(s.responseTime)/float64(time.Millisecond), metric.GAUGE); err != nil {
+			log.Error(err.Error())
+		}
+		return
+	}
+	if err := ms.SetMetric("errorClass", s.errorClass, metric.ATTRIBUTE); err != nil {
+		log.Error(err.Error())
+	}
+	if err := ms.SetMetric("errorMessage", s.errorMessage, metric.ATTRIBUTE); err != nil {
+		log.Error(err.Error())
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		result *gosnmp.SnmpPacket
+		err    error
+		class  string
+	}{
+		{&gosnmp.SnmpPacket{Variables: []gosnmp.SnmpPDU{{Name: sysUpTimeOid}}}, nil, ""},
+		{nil, errors.New("Request timeout (after 2 retries)"), errorClassTimeout},
+		{nil, errors.New(gosnmpNotAuthentic), errorClassAuthFailure},
+		{nil, errors.New("dial udp: lookup authentic.example.com: no such host"), errorClassConnection},
+		{nil, &snmpReportError{oid: ".1.3.6.1.6.3.15.1.1.3.0", report: knownErrorOids[".1.3.6.1.6.3.15.1.1.3.0"]}, errorClassUnknownUserName},
+		{nil, errors.New("dial udp: lookup nowhere: no such host"), errorClassConnection},
+		{&gosnmp.SnmpPacket{Error: gosnmp.GenErr}, nil, errorClassSNMP},
+		{&gosnmp.SnmpPacket{PDUType: gosnmp.Report, Variables: []gosnmp.SnmpPDU{{Name: ".1.3.6.1.6.3.15.1.1.4.0", Type: gosnmp.Counter32}}}, nil, errorClassUnknownEngineID},
+		{&gosnmp.SnmpPacket{PDUType: gosnmp.Report, Variables: []gosnmp.SnmpPDU{{Name: ".1.3.6.1.6.3.15.1.1.5.0", Type: gosnmp.Counter32}}}, nil, errorClassWrongDigest},
+	}
+	for _, c := range cases {
+		class, _ := classifyError(c.result, c.err)
+		assert.Equal(t, c.class, class)
+	}
+}
+
+func TestDeviceStatus(t *testing.T) {
+	recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, nil)
+	assert.NoError(t, err)
+
+	agent := newFakeAgent(10, integer(sysUpTimeOid, 100))
+	status := probeDevice(agent)
+	assert.True(t, status.reachable)
+	status.report(recorder.Writer())
+
+	unreachableStatus(errors.New("Request timeout (after 0 retries)")).report(recorder.Writer())
+
+	sets := recorder.reported()[0].sets
+	if len(sets) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(sets))
+	}
+	assert.Equal(t, statusEventType, sets[0].eventType)
+	assert.Equal(t, "reachable", sets[0].metrics[0].name)
+	assert.Equal(t, float64(1), sets[0].metrics[0].value)
+	assert.Equal(t, "responseTimeMs", sets[0].metrics[2].name)
+	assert.Equal(t, "closed", sets[0].attributes["breakerState"])
+
+	assert.Equal(t, float64(0), sets[1].metrics[0].value)
+	assert.Len(t, sets[1].metrics, 2)
+	assert.Equal(t, errorClassTimeout, sets[1].attributes["errorClass"])
+}
+
+func TestProbeDevice_Uptime(t *testing.T) {
+	agent := newFakeAgent(10, gosnmp.SnmpPDU{Name: sysUpTimeOid, Type: gosnmp.TimeTicks, Value: uint32(8745123)})
+	status := probeDevice(agent)
+	if assert.NotNil(t, status.uptime) {
+		assert.Equal(t, uint32(8745123), status.uptime.ticks)
+		assert.Equal(t, status.uptime.readAt.Add(-87451230*time.Millisecond), status.uptime.bootTime())
+	}
+
+	assert.Nil(t, probeDevice(newFakeAgent(10)).uptime)
+}
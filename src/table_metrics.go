@@ -10,35 +10,207 @@ import (
 
 	"github.com/newrelic/infra-integrations-sdk/data/attribute"
 	"github.com/newrelic/infra-integrations-sdk/data/metric"
-	"github.com/newrelic/infra-integrations-sdk/integration"
 	"github.com/newrelic/infra-integrations-sdk/log"
 	"github.com/soniah/gosnmp"
 )
 
-func populateTableMetrics(device string, metricSet metricSet, entity *integration.Entity) error {
-	var err error
-
-	tableRootOid := metricSet.RootOid
+func populateTableMetrics(device string, metricSet metricSet, writer sampleWriter) error {
 	if len(metricSet.Index) == 0 {
-		return fmt.Errorf("Table index not specified for table OID `" + tableRootOid + "`")
+		return fmt.Errorf("Table index not specified for table OID `%s`", metricSet.RootOid)
+	}
+
+	metrics, indexKeyMaps, err := walkTable(metricSet)
+	truncated, isTruncated := err.(*walkTruncatedError)
+	if err != nil && !isTruncated {
+		return err
+	}
+
+	for indexKey, indexNVPairs := range indexKeyMaps {
+		rowWriter := writer
+		if metricSet.Entity != nil {
+			rowWriter, err = writer.RowWriter(metricSet.Entity, indexKey, indexNVPairs)
+			if err != nil {
+				log.Error(err.Error())
+				continue
+			}
+		}
+		attributes := append(expandAttributes(metricSet.Attributes, rowTemplateValues(indexKey, indexNVPairs)),
+			attribute.Attr("device", device),
+			attribute.Attr("name", metricSet.Name),
+			attribute.Attr("index", indexKey))
+		ms := rowWriter.NewMetricSet(metricSet.EventType, attributes...)
+
+		for n, v := range indexNVPairs {
+			err = ms.SetMetric(n, v, metric.ATTRIBUTE)
+			if err != nil {
+				log.Error(err.Error())
+			}
+		}
+		for _, metric := range metricSet.Metrics {
+			baseOid := strings.TrimSpace(metric.oid)
+			metricName := metric.metricName
+			oid := baseOid + "." + indexKey
+			if pdu, ok := metrics[oid]; ok {
+				if metricName == "" {
+					metricName = oid
+				}
+				err = createMetric(metricName, metric.metricType, pdu, ms)
+				if err != nil {
+					log.Error(err.Error())
+				}
+			} else {
+				log.Warn("No data for " + oid)
+				theExplain.skip(oid, "no data")
+			}
+		}
+	}
+	if isTruncated {
+		// The rows read before the walk was aborted are reported along with the error
+		return truncated
 	}
+	return nil
+}
 
+// walkTable returns the PDUs of the table along with its index key maps. When
+// the index cache holds the rows of the table only the metric columns are
+// walked; the index columns are walked again when a metric column has a row
+// that isn't cached, and cached rows without any value are left out. When a walk
+// is truncated the complete rows read so far are returned with the
+// walkTruncatedError, and they are not cached.
+func walkTable(metricSet metricSet) (map[string]gosnmp.SnmpPDU, map[string]map[string]string, error) {
+	if theIndexCache == nil {
+		metrics, err := walkOids(metricSet.RootOid)
+		if err != nil {
+			return truncatedTable(metricSet, metrics, err)
+		}
+		return metrics, buildIndexKeyMaps(metricSet, metrics), nil
+	}
+
+	key := indexCacheKey(metricSet)
+	cached, hit := theIndexCache.get(key)
+	if !hit {
+		metrics, err := walkOids(metricSet.RootOid)
+		if err != nil {
+			return truncatedTable(metricSet, metrics, err)
+		}
+		rows := buildIndexKeyMaps(metricSet, metrics)
+		theIndexCache.set(key, rows)
+		return metrics, rows, nil
+	}
+
+	// The other columns are still walked when one is truncated, so that the
+	// rows kept by the row limit are complete
 	metrics := make(map[string]gosnmp.SnmpPDU)
-	snmpWalkCallback := func(pdu gosnmp.SnmpPDU) error {
-		oid := strings.TrimSpace(pdu.Name)
-		errorMessage, ok := knownErrorOids[oid]
-		if ok {
-			return fmt.Errorf("Error Message: %s", errorMessage)
+	truncated := make(map[string]*walkTruncatedError)
+	var truncatedErr error
+	for _, m := range metricSet.Metrics {
+		if err := walkInto(metrics, m.oid); err != nil {
+			e, ok := err.(*walkTruncatedError)
+			if !ok {
+				return nil, nil, err
+			}
+			truncated[absoluteOid(strings.TrimSpace(m.oid))] = e
+			if truncatedErr == nil {
+				truncatedErr = e
+			}
 		}
-		metrics[oid] = pdu
-		return nil
+	}
+	if truncatedErr != nil {
+		dropPartialRows(metricSet, metrics, func(column, oid string) bool {
+			e, ok := truncated[column]
+			return !ok || e.read(oid)
+		})
+		// Only the rows that are still in the cache are reported
+		rows, _ := cachedRows(cached, metricSet, metrics)
+		return metrics, rows, truncatedErr
+	}
+	if rows, ok := cachedRows(cached, metricSet, metrics); ok {
+		return metrics, rows, nil
 	}
 
-	err = theSNMP.BulkWalk(tableRootOid, snmpWalkCallback)
-	if err != nil {
-		return err
+	log.Debug("rows of table %s changed, walking its index columns", metricSet.RootOid)
+	for _, index := range metricSet.Index {
+		if err := walkInto(metrics, index.oid); err != nil {
+			return truncatedTable(metricSet, metrics, err)
+		}
+	}
+	rows := buildIndexKeyMaps(metricSet, metrics)
+	theIndexCache.set(key, rows)
+	return metrics, rows, nil
+}
+
+// truncatedTable returns the complete rows read before a walk was truncated,
+// or only the error when the walk failed otherwise
+func truncatedTable(metricSet metricSet, metrics map[string]gosnmp.SnmpPDU, err error) (map[string]gosnmp.SnmpPDU, map[string]map[string]string, error) {
+	if e, ok := err.(*walkTruncatedError); ok {
+		dropPartialRows(metricSet, metrics, func(column, oid string) bool {
+			return e.read(oid)
+		})
+		return metrics, buildIndexKeyMaps(metricSet, metrics), err
+	}
+	return nil, nil, err
+}
+
+// tableColumns returns the index and metric columns of a table metric set
+func tableColumns(metricSet metricSet) []string {
+	var columns []string
+	for _, index := range metricSet.Index {
+		columns = append(columns, absoluteOid(strings.TrimSpace(index.oid)))
+	}
+	for _, m := range metricSet.Metrics {
+		columns = append(columns, absoluteOid(strings.TrimSpace(m.oid)))
 	}
+	return columns
+}
 
+// dropPartialRows removes the PDUs of the rows that a truncated walk didn't
+// read in every column of the metric set, as a walk reads a table column by
+// column. read reports whether the walk of a column read the given OID.
+func dropPartialRows(metricSet metricSet, pdus map[string]gosnmp.SnmpPDU, read func(column, oid string) bool) {
+	columns := tableColumns(metricSet)
+	partial := make(map[string]bool)
+	for oid := range pdus {
+		for _, column := range columns {
+			if !strings.HasPrefix(oid, column+".") {
+				continue
+			}
+			indexKey := strings.TrimPrefix(oid, column+".")
+			if _, seen := partial[indexKey]; seen {
+				break
+			}
+			partial[indexKey] = false
+			for _, c := range columns {
+				if !read(c, c+"."+indexKey) {
+					partial[indexKey] = true
+					break
+				}
+			}
+			break
+		}
+	}
+	for oid := range pdus {
+		for _, column := range columns {
+			if strings.HasPrefix(oid, column+".") && partial[strings.TrimPrefix(oid, column+".")] {
+				log.Debug("dropping %s of a row the truncated walk didn't read entirely", oid)
+				delete(pdus, oid)
+				break
+			}
+		}
+	}
+}
+
+// walkInto walks a column and adds its PDUs to pdus, those read before a
+// truncated walk included
+func walkInto(pdus map[string]gosnmp.SnmpPDU, columnOid string) error {
+	column, err := walkOids(strings.TrimSpace(columnOid))
+	for oid, pdu := range column {
+		pdus[oid] = pdu
+	}
+	return err
+}
+
+// buildIndexKeyMaps extracts the index columns of each row from the PDUs of a table
+func buildIndexKeyMaps(metricSet metricSet, metrics map[string]gosnmp.SnmpPDU) map[string]map[string]string {
 	//an `index` uniquely identifies a row in an SNMP table.
 	//an `index key` is my term for the OID portion that is appended to the index OID and metric OID to produce SNMP table column data
 	//an `index key map` holds column data (as name-value pairs) for a certain row (aka index key)
@@ -70,37 +242,21 @@ func populateTableMetrics(device string, metricSet metricSet, entity *integratio
 			}
 		}
 	}
+	return indexKeyMaps
+}
 
-	for indexKey, indexNVPairs := range indexKeyMaps {
-		ms := entity.NewMetricSet(metricSet.EventType,
-			attribute.Attr("device", device),
-			attribute.Attr("name", metricSet.Name),
-			attribute.Attr("index", indexKey))
-
-		for n, v := range indexNVPairs {
-			err = ms.SetMetric(n, v, metric.ATTRIBUTE)
-			if err != nil {
-				log.Error(err.Error())
-			}
-		}
-		for _, metric := range metricSet.Metrics {
-			baseOid := strings.TrimSpace(metric.oid)
-			metricName := metric.metricName
-			oid := baseOid + "." + indexKey
-			if pdu, ok := metrics[oid]; ok {
-				if metricName == "" {
-					metricName = oid
-				}
-				err = createMetric(metricName, metric.metricType, pdu, ms)
-				if err != nil {
-					log.Error(err.Error())
-				}
-			} else {
-				log.Warn("No data for " + oid)
-			}
-		}
+// rowTemplateValues returns the values available to the attribute templates of
+// a table row: the device identity, the row index and the index columns
+func rowTemplateValues(indexKey string, indexValues map[string]string) map[string]string {
+	values := make(map[string]string, len(deviceIdentity)+len(indexValues)+1)
+	for k, v := range deviceIdentity {
+		values[k] = v
 	}
-	return nil
+	values["index"] = indexKey
+	for k, v := range indexValues {
+		values[k] = v
+	}
+	return values
 }
 
 func extractIndexValue(pdu gosnmp.SnmpPDU) (string, error) {
@@ -111,7 +267,7 @@ func extractIndexValue(pdu gosnmp.SnmpPDU) (string, error) {
 			indexValue = string(v)
 			return indexValue, nil
 		}
-		return "", fmt.Errorf("unable to assert OctetString as []byte, Oid[" + pdu.Name + "]")
+		return "", fmt.Errorf("unable to assert OctetString as []byte, Oid[%s]", pdu.Name)
 	case gosnmp.Gauge32, gosnmp.Counter32, gosnmp.Counter64, gosnmp.Integer, gosnmp.Uinteger32:
 		indexValue = gosnmp.ToBigInt(pdu.Value).String()
 		return indexValue, nil
@@ -120,7 +276,7 @@ func extractIndexValue(pdu gosnmp.SnmpPDU) (string, error) {
 			indexValue = v
 			return indexValue, nil
 		}
-		return "", fmt.Errorf("unable to assert ObjectIdentifier or IPAddress as string, Oid[" + pdu.Name + "]")
+		return "", fmt.Errorf("unable to assert ObjectIdentifier or IPAddress as string, Oid[%s]", pdu.Name)
 	case gosnmp.Boolean:
 		return "", fmt.Errorf("unsupported PDU type[Boolean] for index")
 	case gosnmp.BitString:
@@ -132,7 +288,7 @@ func extractIndexValue(pdu gosnmp.SnmpPDU) (string, error) {
 	case gosnmp.OpaqueDouble:
 		return fmt.Sprintf("%f", pdu.Value.(float64)), nil
 	case gosnmp.Null:
-		return "", fmt.Errorf("null value for table index: [" + pdu.Name + "]")
+		return "", fmt.Errorf("null value for table index: [%s]", pdu.Name)
 	case gosnmp.NoSuchObject, gosnmp.NoSuchInstance:
 		return "", fmt.Errorf("no such table index: [%v]", pdu.Name)
 	default:
@@ -0,0 +1,161 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"net"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/soniah/gosnmp"
+)
+
+// collectionEventType is the event type of the self-telemetry samples
+const collectionEventType = "SNMPCollectionSample"
+
+// theClient sends the requests of the collectors through the SNMP session and
+// records them in theStats
+var theClient snmpClient
+
+// theStats gathers the self-telemetry of the current run
+var theStats = newCollectionStats()
+
+// requestCounters counts the requests sent to the target and their outcome
+type requestCounters struct {
+	requests  int
+	packets   int
+	responses int
+	varbinds  int
+	timeouts  int
+	errors    int
+}
+
+func (c requestCounters) sub(o requestCounters) requestCounters {
+	return requestCounters{
+		requests:  c.requests - o.requests,
+		packets:   c.packets - o.packets,
+		responses: c.responses - o.responses,
+		varbinds:  c.varbinds - o.varbinds,
+		timeouts:  c.timeouts - o.timeouts,
+		errors:    c.errors - o.errors,
+	}
+}
+
+// retries is the number of packets sent again because the target didn't answer in time
+func (c requestCounters) retries() int {
+	if c.packets < c.requests {
+		return 0
+	}
+	return c.packets - c.requests
+}
+
+// collectionStats is the self-telemetry of a run: the requests of the whole
+// run and the duration and requests of each metric set
+type collectionStats struct {
+	started    time.Time
+	counters   requestCounters
+	metricSets []metricSetStats
+}
+
+type metricSetStats struct {
+	device   string
+	name     string
+	duration time.Duration
+	counters requestCounters
+}
+
+func newCollectionStats() *collectionStats {
+	return &collectionStats{started: time.Now()}
+}
+
+// record counts a request and its response
+func (s *collectionStats) record(result *gosnmp.SnmpPacket, err error) {
+	s.counters.requests++
+	if err != nil {
+		if isTimeout(err) {
+			s.counters.timeouts++
+		} else {
+			s.counters.errors++
+		}
+		return
+	}
+	s.counters.responses++
+	s.counters.varbinds += len(result.Variables)
+	if result.Error != gosnmp.NoError {
+		s.counters.errors++
+	}
+}
+
+// addMetricSet records the requests sent since before as those of a metric set
+func (s *collectionStats) addMetricSet(device, name string, duration time.Duration, before requestCounters) {
+	s.metricSets = append(s.metricSets, metricSetStats{device: device, name: name, duration: duration, counters: s.counters.sub(before)})
+}
+
+// report writes an SNMPCollectionSample for the whole run and one per metric set
+func (s *collectionStats) report(writer sampleWriter) {
+	writeCollectionSample(writer, time.Since(s.started), s.counters, attribute.Attr("scope", "target"))
+	for _, ms := range s.metricSets {
+		writeCollectionSample(writer, ms.duration, ms.counters,
+			attribute.Attr("scope", "metricSet"),
+			attribute.Attr("device", ms.device),
+			attribute.Attr("name", ms.name))
+	}
+}
+
+func writeCollectionSample(writer sampleWriter, duration time.Duration, counters requestCounters, attributes ...attribute.Attribute) {
+	ms := writer.NewMetricSet(collectionEventType, attributes...)
+	values := []struct {
+		name  string
+		value int
+	}{
+		{"durationMs", int(duration / time.Millisecond)},
+		{"requests", counters.requests},
+		{"responses", counters.responses},
+		{"varbinds", counters.varbinds},
+		{"retries", counters.retries()},
+		{"timeouts", counters.timeouts},
+		{"errors", counters.errors},
+	}
+	for _, v := range values {
+		if err := ms.SetMetric(v.name, v.value, metric.GAUGE); err != nil {
+			log.Error(err.Error())
+		}
+	}
+}
+
+// instrumentedClient sends requests through a session and records them in
+// theStats, and their responses in theRecording
+type instrumentedClient struct {
+	snmp *gosnmp.GoSNMP
+}
+
+func (c instrumentedClient) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	result, err := c.snmp.Get(oids)
+	theStats.record(result, err)
+	if err == nil {
+		theRecording.record(oids, result)
+	}
+	return result, err
+}
+
+func (c instrumentedClient) GetBulk(oids []string, nonRepeaters uint8, maxRepetitions uint8) (*gosnmp.SnmpPacket, error) {
+	result, err := c.snmp.GetBulk(oids, nonRepeaters, maxRepetitions)
+	theStats.record(result, err)
+	if err == nil {
+		theRecording.record(oids, result)
+	}
+	return result, err
+}
+
+// countingConn counts the packets sent to the target, retries included
+type countingConn struct {
+	net.Conn
+}
+
+func (c countingConn) Write(b []byte) (int, error) {
+	theStats.counters.packets++
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectionStats(t *testing.T) {
+	s := newCollectionStats()
+	s.record(&gosnmp.SnmpPacket{Variables: []gosnmp.SnmpPDU{{}, {}}}, nil)
+
+	before := s.counters
+	s.counters.packets += 3
+	s.record(nil, errors.New("Request timeout (after 1 retries)"))
+	s.record(&gosnmp.SnmpPacket{Error: gosnmp.NoSuchName, Variables: []gosnmp.SnmpPDU{{}}}, nil)
+	s.record(nil, errors.New("oid count (70) is greater than MaxOids (60)"))
+	s.addMetricSet("IF-MIB", "ifTable", 1500*time.Millisecond, before)
+
+	assert.Equal(t, requestCounters{requests: 4, packets: 3, responses: 2, varbinds: 3, timeouts: 1, errors: 2}, s.counters)
+	assert.Equal(t, 0, s.counters.retries())
+	assert.Equal(t, []metricSetStats{{
+		device:   "IF-MIB",
+		name:     "ifTable",
+		duration: 1500 * time.Millisecond,
+		counters: requestCounters{requests: 3, packets: 3, responses: 1, varbinds: 1, timeouts: 1, errors: 2},
+	}}, s.metricSets)
+
+	recorder, err := newSampleRecorder("core-sw-01", "snmp-device", nil, nil)
+	assert.NoError(t, err)
+	s.report(recorder.Writer())
+	sets := recorder.reported()[0].sets
+	if len(sets) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(sets))
+	}
+	assert.Equal(t, collectionEventType, sets[1].eventType)
+	assert.Equal(t, map[string]string{"scope": "metricSet", "device": "IF-MIB", "name": "ifTable"}, sets[1].attributes)
+	assert.Equal(t, recordedMetric{name: "durationMs", sourceType: metric.GAUGE, value: 1500}, sets[1].metrics[0])
+}
+
+func TestRequestCounters_Retries(t *testing.T) {
+	assert.Equal(t, 2, requestCounters{requests: 3, packets: 5}.retries())
+}
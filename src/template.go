@@ -0,0 +1,92 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+)
+
+// expandTemplate replaces ${name} and $name references in template with the
+// matching entry of values. Unknown references expand to an empty string.
+func expandTemplate(template string, values map[string]string) string {
+	return os.Expand(template, func(name string) string {
+		return values[name]
+	})
+}
+
+// expandAttributes expands the value templates of a set of custom attributes
+// and returns the attributes sorted by name
+func expandAttributes(templates map[string]string, values map[string]string) []attribute.Attribute {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attributes := make([]attribute.Attribute, 0, len(names))
+	for _, name := range names {
+		attributes = append(attributes, attribute.Attr(name, expandTemplate(templates[name], values)))
+	}
+	return attributes
+}
+
+// reservedAttributes are set by the integration on the samples it reports and
+// can't be used as custom attribute names
+var reservedAttributes = map[string]bool{
+	"device":             true,
+	"name":               true,
+	"index":              true,
+	"targetAddress":      true,
+	"sysName":            true,
+	"alias":              true,
+	"errorCode":          true,
+	"errorMessage":       true,
+	"errorHint":          true,
+	"failedOids":         true,
+	"event_type":         true,
+	"entityName":         true,
+	"displayName":        true,
+	"reportingEntityKey": true,
+}
+
+// checkAttributeNames returns an error for the first custom attribute that uses a reserved name
+func checkAttributeNames(attributes map[string]string) error {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if reservedAttributes[name] {
+			return fmt.Errorf("attribute %s is reserved", name)
+		}
+	}
+	return nil
+}
+
+// mergeAttributes merges lists of attributes into one, sorted by name. The
+// attributes of the later lists, the most specific, override the earlier ones.
+func mergeAttributes(lists ...[]attribute.Attribute) []attribute.Attribute {
+	merged := make(map[string]string)
+	for _, list := range lists {
+		for _, a := range list {
+			merged[a.Key] = a.Value
+		}
+	}
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attributes := make([]attribute.Attribute, 0, len(names))
+	for _, name := range names {
+		attributes = append(attributes, attribute.Attr(name, merged[name]))
+	}
+	return attributes
+}
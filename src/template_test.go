@@ -0,0 +1,24 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandAttributes(t *testing.T) {
+	attributes := expandAttributes(map[string]string{
+		"site":     "ams1",
+		"location": "${sysLocation}",
+		"port":     "$sysName/${ifName}",
+	}, map[string]string{"sysLocation": "Amsterdam DC1", "sysName": "core-sw-01", "ifName": "Gi1/0/1"})
+	assert.Equal(t, []attribute.Attribute{
+		attribute.Attr("location", "Amsterdam DC1"),
+		attribute.Attr("port", "core-sw-01/Gi1/0/1"),
+		attribute.Attr("site", "ams1"),
+	}, attributes)
+}
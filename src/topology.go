@@ -0,0 +1,383 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/newrelic/infra-integrations-sdk/data/attribute"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/soniah/gosnmp"
+)
+
+const (
+	topologyEventType = "SNMPTopologyLinkSample"
+
+	// LLDP-MIB
+	lldpLocalSystemDataOid     = ".1.0.8802.1.1.2.1.3"
+	lldpLocChassisIDSubtypeOid = ".1.0.8802.1.1.2.1.3.1.0"
+	lldpLocChassisIDOid        = ".1.0.8802.1.1.2.1.3.2.0"
+	lldpLocSysNameOid          = ".1.0.8802.1.1.2.1.3.3.0"
+	lldpLocPortEntryOid        = ".1.0.8802.1.1.2.1.3.7.1"
+	lldpRemEntryOid            = ".1.0.8802.1.1.2.1.4.1.1"
+
+	// CISCO-CDP-MIB
+	cdpCacheEntryOid = ".1.3.6.1.4.1.9.9.23.1.2.1.1"
+
+	// IF-MIB ifName column, used to name the local port of CDP neighbours
+	ifNameOid = ".1.3.6.1.2.1.31.1.1.1.1"
+)
+
+// lldpRemEntry columns
+const (
+	lldpRemChassisIDSubtype = "4"
+	lldpRemChassisID        = "5"
+	lldpRemPortIDSubtype    = "6"
+	lldpRemPortID           = "7"
+	lldpRemPortDesc         = "8"
+	lldpRemSysName          = "9"
+)
+
+// lldpLocPortEntry columns
+const (
+	lldpLocPortIDSubtype = "2"
+	lldpLocPortID        = "3"
+	lldpLocPortDesc      = "4"
+)
+
+// cdpCacheEntry columns
+const (
+	cdpCacheAddress    = "4"
+	cdpCacheDeviceID   = "6"
+	cdpCacheDevicePort = "7"
+	cdpCachePlatform   = "8"
+)
+
+// chassisIDSubtypes maps LldpChassisIdSubtype values to their names
+var chassisIDSubtypes = map[int]string{
+	1: "chassisComponent",
+	2: "interfaceAlias",
+	3: "portComponent",
+	4: "macAddress",
+	5: "networkAddress",
+	6: "interfaceName",
+	7: "local",
+}
+
+// portIDSubtypes maps LldpPortIdSubtype values to their names
+var portIDSubtypes = map[int]string{
+	1: "interfaceAlias",
+	2: "portComponent",
+	3: "macAddress",
+	4: "networkAddress",
+	5: "interfaceName",
+	6: "agentCircuitId",
+	7: "local",
+}
+
+// neighbourLink is a single relation between a local port and a port on a remote system
+type neighbourLink struct {
+	protocol                string
+	localChassisID          string
+	localSystemName         string
+	localPort               string
+	localPortID             string
+	localPortIDSubtype      string
+	localPortDescr          string
+	remoteChassisID         string
+	remoteChassisIDSubtype  string
+	remotePortID            string
+	remotePortIDSubtype     string
+	remotePortDescr         string
+	remoteSystemName        string
+	remoteManagementAddress string
+	remotePlatform          string
+}
+
+// tableRows groups the PDUs of a walked table by row, keyed by index and then by column number
+type tableRows map[string]map[string]gosnmp.SnmpPDU
+
+// populateTopology reports the LLDP and CDP neighbours of the target. Each
+// protocol is collected on its own, the links of one are reported when the
+// other fails, and an error is returned only when both fail.
+func populateTopology(writer sampleWriter) error {
+	lldpLinks, lldpErr := collectLLDPLinks()
+	if lldpErr != nil {
+		log.Warn("unable to collect LLDP neighbours of target %s: %v", targetHost, lldpErr)
+	}
+	cdpLinks, cdpErr := collectCDPLinks()
+	if cdpErr != nil {
+		log.Warn("unable to collect CDP neighbours of target %s: %v", targetHost, cdpErr)
+	}
+	if lldpErr != nil && cdpErr != nil {
+		return fmt.Errorf("LLDP: %v, CDP: %v", lldpErr, cdpErr)
+	}
+
+	links := append(lldpLinks, cdpLinks...)
+	if len(links) == 0 {
+		log.Debug("no LLDP or CDP neighbours reported by target %s", targetHost)
+	}
+	for _, link := range links {
+		reportLink(link, writer)
+	}
+	return nil
+}
+
+func collectLLDPLinks() ([]neighbourLink, error) {
+	local, err := walkOids(lldpLocalSystemDataOid)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := walkOids(lldpRemEntryOid)
+	if err != nil {
+		return nil, err
+	}
+	return parseLLDPLinks(local, remote), nil
+}
+
+func collectCDPLinks() ([]neighbourLink, error) {
+	cache, err := walkOids(cdpCacheEntryOid)
+	if err != nil || len(cache) == 0 {
+		return nil, err
+	}
+	ifNames, err := walkOids(ifNameOid)
+	if err != nil {
+		log.Warn("unable to walk ifName for CDP local ports: %v", err)
+	}
+	return parseCDPLinks(cache, ifNames), nil
+}
+
+// splitRows groups PDUs under entryOid into rows. The first sub-identifier after
+// entryOid is the column and the remainder is the row index.
+func splitRows(entryOid string, pdus map[string]gosnmp.SnmpPDU) tableRows {
+	rows := make(tableRows)
+	prefix := entryOid + "."
+	for oid, pdu := range pdus {
+		if !strings.HasPrefix(oid, prefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(oid, prefix), ".", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		row, ok := rows[parts[1]]
+		if !ok {
+			row = make(map[string]gosnmp.SnmpPDU)
+			rows[parts[1]] = row
+		}
+		row[parts[0]] = pdu
+	}
+	return rows
+}
+
+// sortedKeys returns the row indexes in a stable order
+func (rows tableRows) sortedKeys() []string {
+	keys := make([]string, 0, len(rows))
+	for k := range rows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseLLDPLinks(local, remote map[string]gosnmp.SnmpPDU) []neighbourLink {
+	localChassisID := ""
+	if subtype, ok := pduInt(local[lldpLocChassisIDSubtypeOid]); ok {
+		localChassisID = decodeChassisID(subtype, pduBytes(local[lldpLocChassisIDOid]))
+	}
+	localSystemName := string(pduBytes(local[lldpLocSysNameOid]))
+	localPorts := splitRows(lldpLocPortEntryOid, local)
+
+	var links []neighbourLink
+	remoteRows := splitRows(lldpRemEntryOid, remote)
+	for _, key := range remoteRows.sortedKeys() {
+		row := remoteRows[key]
+		// lldpRemEntry is indexed by lldpRemTimeMark.lldpRemLocalPortNum.lldpRemIndex
+		index := strings.Split(key, ".")
+		if len(index) != 3 {
+			log.Warn("unexpected LLDP remote table index %s", key)
+			continue
+		}
+		link := neighbourLink{
+			protocol:         "lldp",
+			localChassisID:   localChassisID,
+			localSystemName:  localSystemName,
+			localPort:        index[1],
+			remoteSystemName: string(pduBytes(row[lldpRemSysName])),
+			remotePortDescr:  string(pduBytes(row[lldpRemPortDesc])),
+		}
+		if subtype, ok := pduInt(row[lldpRemChassisIDSubtype]); ok {
+			link.remoteChassisIDSubtype = chassisIDSubtypes[subtype]
+			link.remoteChassisID = decodeChassisID(subtype, pduBytes(row[lldpRemChassisID]))
+		}
+		if subtype, ok := pduInt(row[lldpRemPortIDSubtype]); ok {
+			link.remotePortIDSubtype = portIDSubtypes[subtype]
+			link.remotePortID = decodePortID(subtype, pduBytes(row[lldpRemPortID]))
+		}
+		if localPort, ok := localPorts[index[1]]; ok {
+			if subtype, ok := pduInt(localPort[lldpLocPortIDSubtype]); ok {
+				link.localPortIDSubtype = portIDSubtypes[subtype]
+				link.localPortID = decodePortID(subtype, pduBytes(localPort[lldpLocPortID]))
+			}
+			link.localPortDescr = string(pduBytes(localPort[lldpLocPortDesc]))
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+func parseCDPLinks(cache, ifNames map[string]gosnmp.SnmpPDU) []neighbourLink {
+	var links []neighbourLink
+	rows := splitRows(cdpCacheEntryOid, cache)
+	for _, key := range rows.sortedKeys() {
+		row := rows[key]
+		// cdpCacheEntry is indexed by cdpCacheIfIndex.cdpCacheDeviceIndex
+		index := strings.Split(key, ".")
+		if len(index) != 2 {
+			log.Warn("unexpected CDP cache table index %s", key)
+			continue
+		}
+		link := neighbourLink{
+			protocol:            "cdp",
+			localPort:           index[0],
+			localPortIDSubtype:  "local",
+			localPortID:         index[0],
+			remoteSystemName:    string(pduBytes(row[cdpCacheDeviceID])),
+			remotePortIDSubtype: "interfaceName",
+			remotePortID:        string(pduBytes(row[cdpCacheDevicePort])),
+			remotePlatform:      string(pduBytes(row[cdpCachePlatform])),
+		}
+		if ifName, ok := ifNames[ifNameOid+"."+index[0]]; ok {
+			link.localPortIDSubtype = "interfaceName"
+			link.localPortID = string(pduBytes(ifName))
+		}
+		if address := pduBytes(row[cdpCacheAddress]); len(address) == net.IPv4len || len(address) == net.IPv6len {
+			// CDP has no chassis ID, the management address identifies the neighbour
+			link.remoteManagementAddress = net.IP(address).String()
+			link.remoteChassisID = link.remoteManagementAddress
+			link.remoteChassisIDSubtype = chassisIDSubtypes[5]
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+func reportLink(link neighbourLink, writer sampleWriter) {
+	ms := writer.NewMetricSet(topologyEventType,
+		attribute.Attr("protocol", link.protocol),
+		attribute.Attr("localPort", link.localPort),
+		attribute.Attr("remoteChassisId", link.remoteChassisID),
+		attribute.Attr("remotePortId", link.remotePortID))
+
+	attributes := []struct {
+		name  string
+		value string
+	}{
+		{"localChassisId", link.localChassisID},
+		{"localSystemName", link.localSystemName},
+		{"localPortId", link.localPortID},
+		{"localPortIdSubtype", link.localPortIDSubtype},
+		{"localPortDescr", link.localPortDescr},
+		{"remoteChassisIdSubtype", link.remoteChassisIDSubtype},
+		{"remotePortIdSubtype", link.remotePortIDSubtype},
+		{"remotePortDescr", link.remotePortDescr},
+		{"remoteSystemName", link.remoteSystemName},
+		{"remoteManagementAddress", link.remoteManagementAddress},
+		{"remotePlatform", link.remotePlatform},
+	}
+	for _, attr := range attributes {
+		if attr.value == "" {
+			continue
+		}
+		if err := ms.SetMetric(attr.name, attr.value, metric.ATTRIBUTE); err != nil {
+			log.Error(err.Error())
+		}
+	}
+}
+
+// decodeChassisID renders an LLDP chassis ID according to its LldpChassisIdSubtype
+func decodeChassisID(subtype int, raw []byte) string {
+	switch subtype {
+	case 4:
+		return formatMAC(raw)
+	case 5:
+		return formatNetworkAddress(raw)
+	default:
+		return formatOctets(raw)
+	}
+}
+
+// decodePortID renders an LLDP port ID according to its LldpPortIdSubtype
+func decodePortID(subtype int, raw []byte) string {
+	switch subtype {
+	case 3:
+		return formatMAC(raw)
+	case 4:
+		return formatNetworkAddress(raw)
+	default:
+		return formatOctets(raw)
+	}
+}
+
+func formatMAC(raw []byte) string {
+	if len(raw) != 6 {
+		return formatOctets(raw)
+	}
+	return net.HardwareAddr(raw).String()
+}
+
+// formatNetworkAddress decodes an IANA address family number followed by the address
+func formatNetworkAddress(raw []byte) string {
+	if len(raw) == 1+net.IPv4len && raw[0] == 1 {
+		return net.IP(raw[1:]).String()
+	}
+	if len(raw) == 1+net.IPv6len && raw[0] == 2 {
+		return net.IP(raw[1:]).String()
+	}
+	return formatOctets(raw)
+}
+
+// formatOctets returns the value as text when it is printable and as colon separated hex otherwise
+func formatOctets(raw []byte) string {
+	trimmed := bytes.TrimRight(raw, "\x00")
+	if utf8.Valid(trimmed) {
+		printable := true
+		for _, r := range string(trimmed) {
+			if !unicode.IsPrint(r) {
+				printable = false
+				break
+			}
+		}
+		if printable {
+			return string(trimmed)
+		}
+	}
+	hexOctets := make([]string, len(raw))
+	for i, b := range raw {
+		hexOctets[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(hexOctets, ":")
+}
+
+func pduBytes(pdu gosnmp.SnmpPDU) []byte {
+	if v, ok := pdu.Value.([]byte); ok {
+		return v
+	}
+	return nil
+}
+
+func pduInt(pdu gosnmp.SnmpPDU) (int, bool) {
+	switch pdu.Type {
+	case gosnmp.Integer, gosnmp.Gauge32, gosnmp.Counter32, gosnmp.Uinteger32:
+		return int(gosnmp.ToBigInt(pdu.Value).Int64()), true
+	}
+	return 0, false
+}
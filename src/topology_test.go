@@ -0,0 +1,128 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func octets(oid string, v []byte) gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: oid, Type: gosnmp.OctetString, Value: v}
+}
+
+func integer(oid string, v int) gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: oid, Type: gosnmp.Integer, Value: v}
+}
+
+func pduMap(pdus ...gosnmp.SnmpPDU) map[string]gosnmp.SnmpPDU {
+	m := make(map[string]gosnmp.SnmpPDU)
+	for _, pdu := range pdus {
+		m[pdu.Name] = pdu
+	}
+	return m
+}
+
+func TestDecodeChassisID(t *testing.T) {
+	assert.Equal(t, "00:1c:73:aa:bb:cc", decodeChassisID(4, []byte{0x00, 0x1c, 0x73, 0xaa, 0xbb, 0xcc}))
+	assert.Equal(t, "192.0.2.1", decodeChassisID(5, []byte{1, 192, 0, 2, 1}))
+	assert.Equal(t, "core-sw-01", decodeChassisID(7, []byte("core-sw-01")))
+	assert.Equal(t, "01:02:ff", decodeChassisID(1, []byte{1, 2, 0xff}))
+}
+
+func TestDecodePortID(t *testing.T) {
+	assert.Equal(t, "Ethernet1", decodePortID(5, []byte("Ethernet1")))
+	assert.Equal(t, "52:54:00:a1:b2:c3", decodePortID(3, []byte{0x52, 0x54, 0x00, 0xa1, 0xb2, 0xc3}))
+	assert.Equal(t, "2001:db8::1", decodePortID(4, append([]byte{2}, []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}...)))
+}
+
+func TestParseLLDPLinks(t *testing.T) {
+	local := pduMap(
+		integer(lldpLocChassisIDSubtypeOid, 4),
+		octets(lldpLocChassisIDOid, []byte{0x52, 0x54, 0x00, 0x00, 0x00, 0x01}),
+		octets(lldpLocSysNameOid, []byte("edge-01")),
+		integer(lldpLocPortEntryOid+".2.12", 5),
+		octets(lldpLocPortEntryOid+".3.12", []byte("Gi0/12")),
+		octets(lldpLocPortEntryOid+".4.12", []byte("uplink")),
+	)
+	remote := pduMap(
+		integer(lldpRemEntryOid+".4.0.12.1", 4),
+		octets(lldpRemEntryOid+".5.0.12.1", []byte{0x00, 0x1c, 0x73, 0xaa, 0xbb, 0xcc}),
+		integer(lldpRemEntryOid+".6.0.12.1", 5),
+		octets(lldpRemEntryOid+".7.0.12.1", []byte("Ethernet48")),
+		octets(lldpRemEntryOid+".8.0.12.1", []byte("to edge-01")),
+		octets(lldpRemEntryOid+".9.0.12.1", []byte("core-01")),
+	)
+
+	links := parseLLDPLinks(local, remote)
+	assert.Equal(t, []neighbourLink{{
+		protocol:               "lldp",
+		localChassisID:         "52:54:00:00:00:01",
+		localSystemName:        "edge-01",
+		localPort:              "12",
+		localPortID:            "Gi0/12",
+		localPortIDSubtype:     "interfaceName",
+		localPortDescr:         "uplink",
+		remoteChassisID:        "00:1c:73:aa:bb:cc",
+		remoteChassisIDSubtype: "macAddress",
+		remotePortID:           "Ethernet48",
+		remotePortIDSubtype:    "interfaceName",
+		remotePortDescr:        "to edge-01",
+		remoteSystemName:       "core-01",
+	}}, links)
+}
+
+func TestParseCDPLinks(t *testing.T) {
+	cache := pduMap(
+		octets(cdpCacheEntryOid+".4.10101.3", []byte{192, 0, 2, 7}),
+		octets(cdpCacheEntryOid+".6.10101.3", []byte("core-02.example.com")),
+		octets(cdpCacheEntryOid+".7.10101.3", []byte("GigabitEthernet1/0/24")),
+		octets(cdpCacheEntryOid+".8.10101.3", []byte("cisco WS-C3750X-48")),
+	)
+	ifNames := pduMap(octets(ifNameOid+".10101", []byte("Gi1/0/1")))
+
+	links := parseCDPLinks(cache, ifNames)
+	if assert.Len(t, links, 1) {
+		assert.Equal(t, "Gi1/0/1", links[0].localPortID)
+		assert.Equal(t, "interfaceName", links[0].localPortIDSubtype)
+		assert.Equal(t, "core-02.example.com", links[0].remoteSystemName)
+		assert.Equal(t, "GigabitEthernet1/0/24", links[0].remotePortID)
+		assert.Equal(t, "192.0.2.7", links[0].remoteManagementAddress)
+		assert.Equal(t, "192.0.2.7", links[0].remoteChassisID)
+		assert.Equal(t, "networkAddress", links[0].remoteChassisIDSubtype)
+	}
+
+	// Without an address the neighbour has no chassis ID
+	links = parseCDPLinks(pduMap(octets(cdpCacheEntryOid+".6.10101.3", []byte("core-02.example.com"))), nil)
+	if assert.Len(t, links, 1) {
+		assert.Equal(t, "", links[0].remoteChassisID)
+		assert.Equal(t, "core-02.example.com", links[0].remoteSystemName)
+	}
+}
+
+func TestPopulateTopology_LLDPFails(t *testing.T) {
+	data := simulatedData(
+		octets(cdpCacheEntryOid+".4.10101.3", []byte{192, 0, 2, 7}),
+		octets(cdpCacheEntryOid+".6.10101.3", []byte("core-02.example.com")),
+		octets(cdpCacheEntryOid+".7.10101.3", []byte("GigabitEthernet1/0/24")),
+	)
+	defer simulate(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "public"}, simulatorConfig{
+		Errors: map[string]gosnmp.SNMPError{".1.0.8802.1.1.2": gosnmp.GenErr},
+	}, data)()
+
+	i, err := integration.New("test", "0.0.0", integration.InMemoryStore(), integration.Writer(ioutil.Discard))
+	assert.NoError(t, err)
+	entity := i.LocalEntity()
+	assert.NoError(t, populateTopology(&sdkWriter{integration: i, entity: entity}))
+
+	// The CDP neighbour is reported although the LLDP walk failed
+	if assert.Len(t, entity.Metrics, 1) {
+		assert.Equal(t, "cdp", entity.Metrics[0].Metrics["protocol"])
+		assert.Equal(t, "192.0.2.7", entity.Metrics[0].Metrics["remoteChassisId"])
+	}
+}
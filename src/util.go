@@ -13,17 +13,41 @@ import (
 )
 
 func connect(targetHost string, targetPort int) error {
+	if args.ReplayFile != "" {
+		return connectReplay(args.ReplayFile)
+	}
+	var err error
+	theSNMP, err = newSession(targetHost, targetPort)
+	if err != nil {
+		return err
+	}
+
+	err = theSNMP.Connect()
+	if err != nil {
+		log.Error(err.Error())
+		return fmt.Errorf("Error connecting to target %s: %s", targetHost, err)
+	}
+	theSNMP.Conn = countingConn{theSNMP.Conn}
+	theClient = instrumentedClient{theSNMP}
+	log.Info("Connecting to target: %v:%p", targetHost, targetPort)
+	return nil
+}
+
+// newSession returns the session to the target configured by the SNMP version
+// and credentials arguments, not connected yet
+func newSession(targetHost string, targetPort int) (*gosnmp.GoSNMP, error) {
+	var session *gosnmp.GoSNMP
 	if args.V3 {
 		// Ensure a collection file is specified
 		if args.SecurityLevel == "" {
-			return fmt.Errorf("Must specify valid security_level for SNMP v3 (valid values are noAuthnoPriv, authNoPriv and authPriv")
+			return nil, fmt.Errorf("Must specify valid security_level for SNMP v3 (valid values are noAuthnoPriv, authNoPriv and authPriv")
 		}
 
 		secLevel := strings.ToLower(strings.TrimSpace(args.SecurityLevel))
 		switch secLevel {
 		case "noauthnopriv":
 			msgFlags := gosnmp.NoAuthNoPriv
-			theSNMP = &gosnmp.GoSNMP{
+			session = &gosnmp.GoSNMP{
 				Target:             targetHost,
 				Port:               uint16(targetPort),
 				Version:            gosnmp.Version3,
@@ -46,9 +70,9 @@ func connect(targetHost string, targetPort int) error {
 				authProtocol = gosnmp.SHA
 				log.Info("Setting auth_protocol=SHA")
 			} else {
-				return fmt.Errorf("Must specify valid auth_protocol for SNMP v3 (valid values are SHA or MD5)")
+				return nil, fmt.Errorf("Must specify valid auth_protocol for SNMP v3 (valid values are SHA or MD5)")
 			}
-			theSNMP = &gosnmp.GoSNMP{
+			session = &gosnmp.GoSNMP{
 				Target:             targetHost,
 				Port:               uint16(targetPort),
 				Version:            gosnmp.Version3,
@@ -72,7 +96,7 @@ func connect(targetHost string, targetPort int) error {
 			} else if authProtocolArg == "SHA" {
 				authProtocol = gosnmp.SHA
 			} else {
-				return fmt.Errorf("Must specify valid auth_protocol for SNMP v3 (valid values are SHA or MD5)")
+				return nil, fmt.Errorf("Must specify valid auth_protocol for SNMP v3 (valid values are SHA or MD5)")
 			}
 
 			privProtocolArg := strings.ToUpper(strings.TrimSpace(args.PrivProtocol))
@@ -82,10 +106,10 @@ func connect(targetHost string, targetPort int) error {
 			} else if privProtocolArg == "DES" {
 				privProtocol = gosnmp.DES
 			} else {
-				return fmt.Errorf("Must specify valid priv_protocol for SNMP v3 (valid values are AES or DES)")
+				return nil, fmt.Errorf("Must specify valid priv_protocol for SNMP v3 (valid values are AES or DES)")
 			}
 
-			theSNMP = &gosnmp.GoSNMP{
+			session = &gosnmp.GoSNMP{
 				Target:             targetHost,
 				Port:               uint16(targetPort),
 				Version:            gosnmp.Version3,
@@ -102,12 +126,12 @@ func connect(targetHost string, targetPort int) error {
 				},
 			}
 		default:
-			return fmt.Errorf("Must specify valid security_level for SNMP v3 (valid values are noAuthnoPriv, authNoPriv and authPriv)")
+			return nil, fmt.Errorf("Must specify valid security_level for SNMP v3 (valid values are noAuthnoPriv, authNoPriv and authPriv)")
 		}
 
 	} else {
 		community := strings.TrimSpace(args.Community)
-		theSNMP = &gosnmp.GoSNMP{
+		session = &gosnmp.GoSNMP{
 			Target:             targetHost,
 			Port:               uint16(targetPort),
 			Version:            gosnmp.Version2c,
@@ -119,13 +143,10 @@ func connect(targetHost string, targetPort int) error {
 		}
 	}
 
-	err := theSNMP.Connect()
-	if err != nil {
-		log.Error(err.Error())
-		return fmt.Errorf("Error connecting to target %s: %s", targetHost, err)
+	if args.MaxOids > 0 {
+		session.MaxOids = args.MaxOids
 	}
-	log.Info("Connecting to target: %v:%p", targetHost, targetPort)
-	return nil
+	return session, nil
 }
 
 func disconnect() {
@@ -0,0 +1,459 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// collectionSchema is the JSON Schema of a collection file
+const collectionSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "definitions": {
+    "oid": {"type": "string", "pattern": "^\\s*\\.?[0-9]+(\\.[0-9]+)*\\s*$"},
+    "duration": {"type": "string", "pattern": "^\\s*([0-9]+(\\.[0-9]+)?(ns|us|µs|ms|s|m|h))+\\s*$"},
+    "attributes": {"type": "object", "additionalProperties": {"type": ["string", "number", "boolean"]}},
+    "index": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["oid"],
+        "properties": {
+          "oid": {"$ref": "#/definitions/oid"},
+          "metric_name": {"type": "string"}
+        }
+      }
+    },
+    "metricSet": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["name", "type", "event_type"],
+      "properties": {
+        "name": {"type": "string", "minLength": 1},
+        "type": {"enum": ["scalar", "table"]},
+        "event_type": {"type": "string", "minLength": 1},
+        "root_oid": {"$ref": "#/definitions/oid"},
+        "index": {"$ref": "#/definitions/index"},
+        "entity": {
+          "type": "object",
+          "additionalProperties": false,
+          "required": ["name", "type"],
+          "properties": {"name": {"type": "string"}, "type": {"type": "string"}}
+        },
+        "attributes": {"$ref": "#/definitions/attributes"},
+        "interval": {"$ref": "#/definitions/duration"},
+        "max_oids_per_request": {"type": "integer", "minimum": 0},
+        "timeout": {"$ref": "#/definitions/duration"},
+        "retries": {"type": "integer", "minimum": 0},
+        "max_walk_duration": {"$ref": "#/definitions/duration"},
+        "max_walk_rows": {"type": "integer", "minimum": 0},
+        "metrics": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "additionalProperties": false,
+            "required": ["oid"],
+            "properties": {
+              "oid": {"$ref": "#/definitions/oid"},
+              "metric_name": {"type": "string"},
+              "metric_type": {"enum": ["auto", "gauge", "delta", "pdelta", "rate", "prate", "attribute"]}
+            }
+          }
+        }
+      }
+    }
+  },
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["collect"],
+  "properties": {
+    "output": {"enum": ["event", "dimensional", "otlp", "jsonl"]},
+    "collect": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["device"],
+        "properties": {
+          "device": {"type": "string", "minLength": 1},
+          "attributes": {"$ref": "#/definitions/attributes"},
+          "inventory_interval": {"$ref": "#/definitions/duration"},
+          "metric_sets": {"type": "array", "items": {"$ref": "#/definitions/metricSet"}},
+          "inventory": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "additionalProperties": false,
+              "required": ["oid", "category", "name"],
+              "properties": {
+                "oid": {"$ref": "#/definitions/oid"},
+                "category": {"type": "string"},
+                "name": {"type": "string"}
+              }
+            }
+          },
+          "inventory_tables": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "additionalProperties": false,
+              "required": ["root_oid", "category", "index"],
+              "properties": {
+                "root_oid": {"$ref": "#/definitions/oid"},
+                "category": {"type": "string"},
+                "index": {"$ref": "#/definitions/index"},
+                "fields": {
+                  "type": "array",
+                  "items": {
+                    "type": "object",
+                    "additionalProperties": false,
+                    "required": ["oid", "name"],
+                    "properties": {"oid": {"$ref": "#/definitions/oid"}, "name": {"type": "string"}}
+                  }
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// validationProblem is a mistake found in a collection file. path is the
+// location of the offending node, such as collect.0.metric_sets.2.root_oid
+type validationProblem struct {
+	file    string
+	line    int
+	path    string
+	message string
+}
+
+func (p validationProblem) String() string {
+	location := p.file
+	if p.line > 0 {
+		location += ":" + strconv.Itoa(p.line)
+	}
+	if p.path == "" {
+		return location + ": " + p.message
+	}
+	return location + ": " + p.path + ": " + p.message
+}
+
+// runValidate checks the collection files and profiles of the arguments
+// offline, prints the problems found and returns the exit code of the command
+func runValidate(out io.Writer) int {
+	var problems []validationProblem
+	var checked int
+	if args.CollectionFiles != "" {
+		for _, file := range strings.Split(args.CollectionFiles, ",") {
+			file = strings.TrimSpace(file)
+			checked++
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				problems = append(problems, validationProblem{file: file, message: err.Error()})
+				continue
+			}
+			problems = append(problems, validateCollection(file, content)...)
+		}
+	}
+	if args.Profiles != "" {
+		for _, name := range strings.Split(args.Profiles, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			checked++
+			profile, ok := bundledProfiles[name]
+			if !ok {
+				problems = append(problems, validationProblem{file: "profile " + name, message: fmt.Sprintf("unknown profile, valid profiles are: %s", strings.Join(profileNames(), ", "))})
+				continue
+			}
+			problems = append(problems, validateCollection("profile "+name, []byte(profile))...)
+		}
+	}
+	if checked == 0 {
+		fmt.Fprintln(out, "no collection files or profiles to validate")
+		return 2
+	}
+	for _, p := range problems {
+		fmt.Fprintln(out, p)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(out, "%d problems found\n", len(problems))
+		return 1
+	}
+	fmt.Fprintf(out, "%d collection definitions are valid\n", checked)
+	return 0
+}
+
+// validateCollection checks a collection definition against collectionSchema
+// and the semantic rules of validateSemantics, and returns all the problems found
+func validateCollection(file string, content []byte) []validationProblem {
+	var document interface{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return []validationProblem{{file: file, line: yamlErrorLine(err), message: err.Error()}}
+	}
+
+	var problems []validationProblem
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(collectionSchema))
+	if err != nil {
+		return []validationProblem{{file: file, message: "invalid collection schema: " + err.Error()}}
+	}
+	result, err := schema.Validate(gojsonschema.NewGoLoader(jsonValue(document)))
+	if err != nil {
+		return []validationProblem{{file: file, message: err.Error()}}
+	}
+	for _, e := range result.Errors() {
+		path := e.Field()
+		message := strings.TrimPrefix(e.Description(), path+" ")
+		if path == "(root)" {
+			path = ""
+		}
+		if property, ok := e.Details()["property"]; ok && e.Type() == "additional_property_not_allowed" {
+			// Point at the unknown property rather than at its parent
+			path = strings.TrimPrefix(path+"."+fmt.Sprint(property), ".")
+			message = "unknown property"
+		}
+		problems = append(problems, validationProblem{file: file, path: path, message: message})
+	}
+
+	// The semantic rules need the document to decode into the parser types,
+	// which it doesn't when the schema found the wrong types in it
+	var c collectionParser
+	if err := yaml.Unmarshal(content, &c); err != nil {
+		if len(problems) == 0 {
+			problems = append(problems, validationProblem{file: file, line: yamlErrorLine(err), message: err.Error()})
+		}
+	} else {
+		problems = append(problems, validateSemantics(file, &c)...)
+		if len(problems) == 0 {
+			// Anything else parseCollection rejects at run time
+			if _, err := parseCollection(&c); err != nil {
+				problems = append(problems, validationProblem{file: file, message: err.Error()})
+			}
+		}
+	}
+
+	for i := range problems {
+		if problems[i].path != "" {
+			problems[i].line = yamlLine(content, strings.Split(problems[i].path, "."))
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].line < problems[j].line })
+	return problems
+}
+
+// validateSemantics checks the rules a schema can't express: table metric sets
+// need a root_oid and an index within it, names must be unique and custom
+// attributes can't use reserved names
+func validateSemantics(file string, c *collectionParser) []validationProblem {
+	var problems []validationProblem
+	add := func(message string, path ...interface{}) {
+		segments := make([]string, len(path))
+		for i, s := range path {
+			segments[i] = fmt.Sprint(s)
+		}
+		problems = append(problems, validationProblem{file: file, path: strings.Join(segments, "."), message: message})
+	}
+
+	for i, dataSet := range c.Collect {
+		if err := checkAttributeNames(dataSet.Attributes); err != nil {
+			add(err.Error(), "collect", i, "attributes")
+		}
+		names := make(map[string]bool)
+		for j, ms := range dataSet.MetricSets {
+			if err := checkAttributeNames(ms.Attributes); err != nil {
+				add(err.Error(), "collect", i, "metric_sets", j, "attributes")
+			}
+			name := strings.TrimSpace(ms.Name)
+			if name != "" && names[name] {
+				add(fmt.Sprintf("duplicate metric set name %s", name), "collect", i, "metric_sets", j, "name")
+			}
+			names[name] = true
+
+			metricNames := make(map[string]bool)
+			for k, m := range ms.Metrics {
+				metricName := strings.TrimSpace(m.MetricName)
+				if metricName != "" && metricNames[metricName] {
+					add(fmt.Sprintf("duplicate metric name %s", metricName), "collect", i, "metric_sets", j, "metrics", k, "metric_name")
+				}
+				metricNames[metricName] = true
+			}
+
+			switch strings.TrimSpace(ms.Type) {
+			case "table":
+				rootOid := strings.TrimSpace(ms.RootOid)
+				if rootOid == "" {
+					add("table metric set has no root_oid", "collect", i, "metric_sets", j)
+				}
+				if len(ms.Index) == 0 {
+					add("table metric set has no index", "collect", i, "metric_sets", j)
+				}
+				if rootOid == "" {
+					continue
+				}
+				rootOid = absoluteOid(rootOid)
+				for k, idx := range ms.Index {
+					if !strings.HasPrefix(absoluteOid(idx.Oid), rootOid+".") {
+						add(fmt.Sprintf("index OID %s is outside root_oid %s", strings.TrimSpace(idx.Oid), rootOid), "collect", i, "metric_sets", j, "index", k, "oid")
+					}
+				}
+				for k, m := range ms.Metrics {
+					if !strings.HasPrefix(absoluteOid(m.Oid), rootOid+".") {
+						add(fmt.Sprintf("metric OID %s is outside root_oid %s", strings.TrimSpace(m.Oid), rootOid), "collect", i, "metric_sets", j, "metrics", k, "oid")
+					}
+				}
+			case "scalar":
+				if ms.Entity != nil {
+					add("entity is only supported for table metric sets", "collect", i, "metric_sets", j, "entity")
+				}
+				if len(ms.Index) > 0 {
+					add("index is only used by table metric sets", "collect", i, "metric_sets", j, "index")
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// jsonValue converts a document decoded by yaml.v2 into the types of encoding/json
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = jsonValue(value)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// yamlErrorLine extracts the line from the errors of yaml.v2, 0 when it has none
+func yamlErrorLine(err error) int {
+	message := err.Error()
+	i := strings.Index(message, "line ")
+	if i < 0 {
+		return 0
+	}
+	digits := message[i+len("line "):]
+	end := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' })
+	if end >= 0 {
+		digits = digits[:end]
+	}
+	line, _ := strconv.Atoi(digits)
+	return line
+}
+
+// yamlNode is a line of a block style YAML document. keyCol is the column of
+// its content, past the dash of a sequence item.
+type yamlNode struct {
+	line   int
+	indent int
+	dash   bool
+	keyCol int
+	key    string
+}
+
+// yamlLine returns the line of the node at path, such as [collect 0 metric_sets],
+// in a block style YAML document. It returns the line of the deepest node found
+// when the document doesn't have the whole path, 0 when it has none of it.
+func yamlLine(content []byte, path []string) int {
+	var nodes []yamlNode
+	for i, text := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "---") {
+			continue
+		}
+		n := yamlNode{line: i + 1, indent: len(text) - len(trimmed)}
+		n.keyCol = n.indent
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			n.dash = true
+			rest := strings.TrimLeft(strings.TrimPrefix(trimmed, "-"), " ")
+			n.keyCol += len(trimmed) - len(rest)
+			trimmed = rest
+		}
+		if colon := strings.Index(trimmed, ":"); colon > 0 {
+			n.key = strings.Trim(strings.TrimSpace(trimmed[:colon]), `"'`)
+		}
+		nodes = append(nodes, n)
+	}
+
+	start, end, line := 0, len(nodes), 0
+	for _, segment := range path {
+		if start >= end {
+			break
+		}
+		found := -1
+		if index, err := strconv.Atoi(segment); err == nil {
+			// The items of a sequence all start with a dash at the column of the first one
+			col, count := -1, 0
+			for i := start; i < end; i++ {
+				if !nodes[i].dash || (col >= 0 && nodes[i].indent != col) {
+					continue
+				}
+				col = nodes[i].indent
+				if count == index {
+					found = i
+					break
+				}
+				count++
+			}
+			if found < 0 {
+				break
+			}
+			start, end = found, itemEnd(nodes, found, end)
+		} else {
+			col := nodes[start].keyCol
+			for i := start; i < end; i++ {
+				if nodes[i].keyCol == col && nodes[i].key == segment {
+					found = i
+					break
+				}
+			}
+			if found < 0 {
+				break
+			}
+			start, end = found+1, keyEnd(nodes, found, end)
+		}
+		line = nodes[found].line
+	}
+	return line
+}
+
+// itemEnd returns the end of the sequence item starting at nodes[i]
+func itemEnd(nodes []yamlNode, i, end int) int {
+	for j := i + 1; j < end; j++ {
+		if nodes[j].indent <= nodes[i].indent {
+			return j
+		}
+	}
+	return end
+}
+
+// keyEnd returns the end of the value of the key at nodes[i]. A sequence
+// value may be indented at the column of its key.
+func keyEnd(nodes []yamlNode, i, end int) int {
+	col := nodes[i].keyCol
+	for j := i + 1; j < end; j++ {
+		if nodes[j].indent < col || (nodes[j].indent == col && !nodes[j].dash) {
+			return j
+		}
+	}
+	return end
+}
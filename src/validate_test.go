@@ -0,0 +1,141 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const invalidCollection = `collect:
+- device: core
+  metric_sets:
+  - name: system
+    type: scalar
+    event_type: SNMPSample
+    metrics:
+    - metric_name: sysUpTime
+      oid: .1.3.6.1.2.1.1.3.0
+      metric_type: gague
+    - metric_name: sysUpTime
+      oid: .1.3.6.1.2.1.1.5.0
+  - name: interfaces
+    type: table
+    event_type: SNMPInterfaceSample
+    index:
+    - oid: .1.3.6.1.2.1.2.2.1.2
+      metric_name: ifDescr
+    metrics:
+    - oid: .1.3.6.1.2.1.2.2.1.10
+  - name: ifX
+    type: tabel
+    event_type: SNMPInterfaceSample
+  - name: storage
+    type: table
+    event_type: SNMPStorageSample
+    root_oid: .1.3.6.1.2.1.25.2.3
+    intervall: 15s
+    index:
+    - oid: .1.3.6.1.2.1.2.2.1.2
+`
+
+func TestValidateCollection(t *testing.T) {
+	var problems []string
+	for _, p := range validateCollection("core.yml", []byte(invalidCollection)) {
+		problems = append(problems, p.String())
+	}
+	assert.Equal(t, []string{
+		"core.yml:10: collect.0.metric_sets.0.metrics.0.metric_type: must be one of the following: \"auto\", \"gauge\", \"delta\", \"pdelta\", \"rate\", \"prate\", \"attribute\"",
+		"core.yml:11: collect.0.metric_sets.0.metrics.1.metric_name: duplicate metric name sysUpTime",
+		"core.yml:13: collect.0.metric_sets.1: table metric set has no root_oid",
+		"core.yml:22: collect.0.metric_sets.2.type: must be one of the following: \"scalar\", \"table\"",
+		"core.yml:28: collect.0.metric_sets.3.intervall: unknown property",
+		"core.yml:30: collect.0.metric_sets.3.index.0.oid: index OID .1.3.6.1.2.1.2.2.1.2 is outside root_oid .1.3.6.1.2.1.25.2.3",
+	}, problems)
+}
+
+func TestValidateCollection_ReservedAttributes(t *testing.T) {
+	var problems []string
+	for _, p := range validateCollection("core.yml", []byte(`collect:
+- device: core
+  attributes:
+    targetAddress: 192.0.2.10
+  metric_sets:
+  - name: system
+    type: scalar
+    event_type: SNMPSample
+    attributes:
+      index: "0"
+    metrics:
+    - metric_name: sysUpTime
+      oid: .1.3.6.1.2.1.1.3.0
+`)) {
+		problems = append(problems, p.String())
+	}
+	assert.Equal(t, []string{
+		"core.yml:3: collect.0.attributes: attribute targetAddress is reserved",
+		"core.yml:9: collect.0.metric_sets.0.attributes: attribute index is reserved",
+	}, problems)
+}
+
+func TestValidateCollection_Syntax(t *testing.T) {
+	problems := validateCollection("core.yml", []byte("collect:\n- device: core\n  metric_sets: [\n"))
+	if assert.Len(t, problems, 1) {
+		assert.Equal(t, 3, problems[0].line)
+	}
+}
+
+func TestValidateCollection_Profiles(t *testing.T) {
+	for _, name := range profileNames() {
+		assert.Empty(t, validateCollection(name, []byte(bundledProfiles[name])), name)
+	}
+}
+
+func TestYamlLine(t *testing.T) {
+	content := []byte(`# comment
+collect:
+- device: core
+  metric_sets:
+    - name: system
+      metrics:
+      - oid: .1.3.6.1.2.1.1.3.0
+      - oid: .1.3.6.1.2.1.1.5.0
+    - name: interfaces
+- device: edge
+`)
+	assert.Equal(t, 3, yamlLine(content, []string{"collect", "0"}))
+	assert.Equal(t, 8, yamlLine(content, []string{"collect", "0", "metric_sets", "0", "metrics", "1", "oid"}))
+	assert.Equal(t, 9, yamlLine(content, []string{"collect", "0", "metric_sets", "1", "name"}))
+	assert.Equal(t, 10, yamlLine(content, []string{"collect", "1", "device"}))
+	// The deepest node found when the path is not in the document
+	assert.Equal(t, 9, yamlLine(content, []string{"collect", "0", "metric_sets", "1", "index"}))
+}
+
+func TestRunValidate(t *testing.T) {
+	defer func(a argumentList) { args = a }(args)
+	dir, err := ioutil.TempDir("", "validate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "core.yml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(invalidCollection), 0644))
+	args.CollectionFiles, args.Profiles = file, "if-mib"
+	var out bytes.Buffer
+	assert.Equal(t, 1, runValidate(&out))
+	assert.Contains(t, out.String(), file+":13: collect.0.metric_sets.1: table metric set has no root_oid\n")
+	assert.Contains(t, out.String(), "6 problems found\n")
+
+	args.CollectionFiles, args.Profiles = "", "if-mib,cisco"
+	out.Reset()
+	assert.Equal(t, 0, runValidate(&out))
+	assert.Equal(t, "2 collection definitions are valid\n", out.String())
+
+	args.CollectionFiles, args.Profiles = "", ""
+	assert.Equal(t, 2, runValidate(&out))
+}
@@ -0,0 +1,306 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/soniah/gosnmp"
+)
+
+const (
+	// defaultMaxRepetitions is the GETBULK max-repetitions used when the argument is not valid
+	defaultMaxRepetitions = 50
+	// maxRepetitionsKey is the device state key of the learned max-repetitions
+	maxRepetitionsKey = "maxRepetitions"
+)
+
+// theRepetitions sizes the GETBULK requests of the walks
+var theRepetitions = &repetitionTuner{current: defaultMaxRepetitions, max: defaultMaxRepetitions}
+
+// theWalkBudget bounds the walks of the metric set being collected, nil for no limit
+var theWalkBudget *walkBudget
+
+// snmpClient sends the requests used to walk a subtree, implemented by gosnmp.GoSNMP
+type snmpClient interface {
+	Get(oids []string) (*gosnmp.SnmpPacket, error)
+	GetBulk(oids []string, nonRepeaters uint8, maxRepetitions uint8) (*gosnmp.SnmpPacket, error)
+}
+
+// repetitionTuner holds the max-repetitions of the GETBULK requests. In adaptive
+// mode it is halved when the device times out or answers tooBig, and grows back
+// towards max after every walk that didn't need to shrink it.
+type repetitionTuner struct {
+	current  int
+	max      int
+	adaptive bool
+}
+
+// newRepetitionTuner returns a tuner starting at the learned value, if any, capped at max
+func newRepetitionTuner(max int, adaptive bool, learned int) *repetitionTuner {
+	if max < 1 || max > 255 {
+		log.Warn("invalid max repetitions %d, using %d", max, defaultMaxRepetitions)
+		max = defaultMaxRepetitions
+	}
+	t := &repetitionTuner{current: max, max: max, adaptive: adaptive}
+	if adaptive && learned > 0 && learned < max {
+		t.current = learned
+	}
+	return t
+}
+
+// shrink halves the max-repetitions, it returns false when it can't be shrunk further
+func (t *repetitionTuner) shrink() bool {
+	if !t.adaptive || t.current <= 1 {
+		return false
+	}
+	t.current /= 2
+	log.Debug("reducing max repetitions of target %s to %d", targetHost, t.current)
+	return true
+}
+
+// grow increases the max-repetitions by a quarter, up to max
+func (t *repetitionTuner) grow() {
+	if !t.adaptive || t.current >= t.max {
+		return
+	}
+	step := t.current / 4
+	if step < 1 {
+		step = 1
+	}
+	t.current += step
+	if t.current > t.max {
+		t.current = t.max
+	}
+}
+
+// walkBudget bounds the duration and the rows of the walks of a metric set. Rows
+// are told apart by their index key in the columns of the metric set.
+type walkBudget struct {
+	deadline time.Time
+	maxRows  int
+	columns  []string
+	// rows holds the index keys of the rows kept, last is the greatest of them
+	rows map[string]bool
+	last string
+}
+
+// newWalkBudget returns the budget of a metric set with the given columns, nil
+// when it has no limits
+func newWalkBudget(maxDuration time.Duration, maxRows int, columns []string, now time.Time) *walkBudget {
+	if maxDuration <= 0 && maxRows <= 0 {
+		return nil
+	}
+	b := &walkBudget{maxRows: maxRows, rows: make(map[string]bool)}
+	for _, column := range columns {
+		b.columns = append(b.columns, absoluteOid(strings.TrimSpace(column)))
+	}
+	if maxDuration > 0 {
+		b.deadline = now.Add(maxDuration)
+	}
+	return b
+}
+
+// expired reports whether the walks ran past the deadline
+func (b *walkBudget) expired(now time.Time) bool {
+	return b != nil && !b.deadline.IsZero() && now.After(b.deadline)
+}
+
+// take reports whether a PDU belongs to one of the first maxRows rows read.
+// PDUs outside the columns of the metric set are always taken. When a PDU is
+// refused and its row comes after every row kept, next is the OID of the next
+// column, where the walk can carry on as the rest of the column is refused too.
+func (b *walkBudget) take(oid string) (ok bool, next string) {
+	if b == nil || b.maxRows <= 0 {
+		return true, ""
+	}
+	column, indexKey := b.row(oid)
+	if column == "" || b.rows[indexKey] {
+		return true, ""
+	}
+	if len(b.rows) < b.maxRows {
+		b.rows[indexKey] = true
+		if b.last == "" || oidLess(b.last, indexKey) {
+			b.last = indexKey
+		}
+		return true, ""
+	}
+	if oidLess(b.last, indexKey) {
+		return false, nextColumn(column)
+	}
+	return false, ""
+}
+
+// row returns the column of the metric set holding oid and the index key of its row
+func (b *walkBudget) row(oid string) (string, string) {
+	for _, column := range b.columns {
+		if strings.HasPrefix(oid, column+".") {
+			return column, strings.TrimPrefix(oid, column+".")
+		}
+	}
+	return "", ""
+}
+
+// nextColumn returns the OID following every instance of column
+func nextColumn(column string) string {
+	i := strings.LastIndex(column, ".")
+	n, _ := strconv.Atoi(column[i+1:])
+	return column[:i+1] + strconv.Itoa(n+1)
+}
+
+// walkTruncatedError is returned when a walk is aborted because it exceeded its budget
+type walkTruncatedError struct {
+	rootOid string
+	reason  string
+	// lastOid is the last OID read by a walk aborted midway, empty when the
+	// walk read all the PDUs of the rows it kept
+	lastOid string
+}
+
+func (e *walkTruncatedError) Error() string {
+	return fmt.Sprintf("walk of %s truncated: %s", e.rootOid, e.reason)
+}
+
+// read reports whether the walk read the PDU of oid, when it belongs to the walk
+func (e *walkTruncatedError) read(oid string) bool {
+	return e.lastOid == "" || !oidLess(e.lastOid, oid)
+}
+
+// walkOids walks the subtree under rootOid and returns its PDUs keyed by OID
+func walkOids(rootOid string) (map[string]gosnmp.SnmpPDU, error) {
+	pdus := make(map[string]gosnmp.SnmpPDU)
+	err := walkSubtree(theClient, theRepetitions, theWalkBudget, rootOid, func(pdu gosnmp.SnmpPDU) error {
+		pdus[strings.TrimSpace(pdu.Name)] = pdu
+		return nil
+	})
+	return pdus, err
+}
+
+// walkSubtree walks the subtree under rootOid with GETBULK requests sized by
+// the tuner and calls walkFn for each PDU. A rootOid that is a leaf is read
+// with a GET, as gosnmp does. The walk stops with a walkTruncatedError once it
+// exceeds the duration of the budget, the PDUs read so far having been passed
+// to walkFn. The rows past the row limit of the budget are skipped, and the
+// walk returns a walkTruncatedError once done.
+func walkSubtree(client snmpClient, tuner *repetitionTuner, budget *walkBudget, rootOid string, walkFn gosnmp.WalkFunc) error {
+	rootOid = absoluteOid(rootOid)
+	oid := rootOid
+	shrunk, received, refused := false, false, false
+	for {
+		if budget.expired(time.Now()) {
+			return &walkTruncatedError{rootOid: rootOid, reason: "max walk duration exceeded", lastOid: oid}
+		}
+		response, err := client.GetBulk([]string{oid}, 0, uint8(tuner.current))
+		tooBig := err == nil && response.Error == gosnmp.TooBig
+		if tooBig || (err != nil && isTimeout(err)) {
+			if tuner.shrink() {
+				shrunk = true
+				continue
+			}
+		}
+		if tooBig {
+			return fmt.Errorf("target %s answered tooBig to max repetitions %d", targetHost, tuner.current)
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkReport(response); err != nil {
+			return err
+		}
+		if len(response.Variables) == 0 || response.Error == gosnmp.NoSuchName {
+			break
+		}
+		if response.Error != gosnmp.NoError {
+			return fmt.Errorf("target %s failed walking %s: %s", targetHost, rootOid, getErrorMessage(response.Error))
+		}
+
+		done, next := false, ""
+		for i, pdu := range response.Variables {
+			if pdu.Type == gosnmp.EndOfMibView || pdu.Type == gosnmp.NoSuchObject || pdu.Type == gosnmp.NoSuchInstance {
+				done = true
+				break
+			}
+			if !strings.HasPrefix(pdu.Name, rootOid+".") {
+				// The first variable is already out of the subtree, rootOid may be a leaf
+				if !received && i == 0 {
+					if err := getLeaf(client, rootOid, walkFn); err != nil {
+						return err
+					}
+				}
+				done = true
+				break
+			}
+			if pdu.Name == oid {
+				return fmt.Errorf("OID not increasing: %s", pdu.Name)
+			}
+			ok, skipTo := budget.take(pdu.Name)
+			if !ok {
+				refused = true
+				if skipTo != "" {
+					next = skipTo
+					break
+				}
+				continue
+			}
+			if err := walkFn(pdu); err != nil {
+				return err
+			}
+		}
+		if done {
+			break
+		}
+		received = true
+		oid = response.Variables[len(response.Variables)-1].Name
+		if next != "" {
+			oid = next
+		}
+	}
+	if !shrunk {
+		tuner.grow()
+	}
+	if refused {
+		return &walkTruncatedError{rootOid: rootOid, reason: fmt.Sprintf("max walk rows %d exceeded", budget.maxRows)}
+	}
+	return nil
+}
+
+// getLeaf reads a single OID and calls walkFn when the device has it
+func getLeaf(client snmpClient, oid string, walkFn gosnmp.WalkFunc) error {
+	response, err := client.Get([]string{oid})
+	if err != nil {
+		return err
+	}
+	if err := checkReport(response); err != nil {
+		return err
+	}
+	for _, pdu := range response.Variables {
+		if pdu.Name == oid && pdu.Type != gosnmp.NoSuchObject && pdu.Type != gosnmp.NoSuchInstance {
+			return walkFn(pdu)
+		}
+	}
+	return nil
+}
+
+// oidLess compares OIDs numerically
+func oidLess(a, b string) bool {
+	x := strings.Split(strings.TrimPrefix(a, "."), ".")
+	y := strings.Split(strings.TrimPrefix(b, "."), ".")
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if x[i] != y[i] {
+			m, _ := strconv.Atoi(x[i])
+			n, _ := strconv.Atoi(y[i])
+			return m < n
+		}
+	}
+	return len(x) < len(y)
+}
+
+// isTimeout reports whether err is a request timeout
+func isTimeout(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "timeout")
+}
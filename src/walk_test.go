@@ -0,0 +1,168 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAgent answers GETBULK requests from a sorted list of PDUs. Requests for
+// more than limit repetitions time out, the others fail with status when set.
+type fakeAgent struct {
+	pdus        []gosnmp.SnmpPDU
+	limit       int
+	status      gosnmp.SNMPError
+	repetitions []int
+}
+
+func newFakeAgent(limit int, pdus ...gosnmp.SnmpPDU) *fakeAgent {
+	sort.Slice(pdus, func(i, j int) bool { return oidLess(pdus[i].Name, pdus[j].Name) })
+	return &fakeAgent{pdus: pdus, limit: limit}
+}
+
+func (a *fakeAgent) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	for _, pdu := range a.pdus {
+		if pdu.Name == oids[0] {
+			return &gosnmp.SnmpPacket{Variables: []gosnmp.SnmpPDU{pdu}}, nil
+		}
+	}
+	return &gosnmp.SnmpPacket{Variables: []gosnmp.SnmpPDU{{Name: oids[0], Type: gosnmp.NoSuchObject}}}, nil
+}
+
+func (a *fakeAgent) GetBulk(oids []string, nonRepeaters uint8, maxRepetitions uint8) (*gosnmp.SnmpPacket, error) {
+	a.repetitions = append(a.repetitions, int(maxRepetitions))
+	if int(maxRepetitions) > a.limit {
+		return nil, errors.New("Request timeout (after 0 retries)")
+	}
+	if a.status != gosnmp.NoError {
+		return &gosnmp.SnmpPacket{Error: a.status, Variables: []gosnmp.SnmpPDU{{Name: oids[0], Type: gosnmp.Null}}}, nil
+	}
+	var variables []gosnmp.SnmpPDU
+	for _, pdu := range a.pdus {
+		if oidLess(oids[0], pdu.Name) && len(variables) < int(maxRepetitions) {
+			variables = append(variables, pdu)
+		}
+	}
+	if len(variables) == 0 {
+		variables = append(variables, gosnmp.SnmpPDU{Name: oids[0], Type: gosnmp.EndOfMibView})
+	}
+	return &gosnmp.SnmpPacket{Variables: variables}, nil
+}
+
+func TestWalkSubtree_Adaptive(t *testing.T) {
+	var pdus []gosnmp.SnmpPDU
+	for i := 1; i <= 20; i++ {
+		pdus = append(pdus, integer(fmt.Sprintf(".1.3.6.1.2.1.2.2.1.10.%d", i), i))
+	}
+	pdus = append(pdus, integer(".1.3.6.1.2.1.2.2.1.11.1", 1))
+	agent := newFakeAgent(10, pdus...)
+	tuner := newRepetitionTuner(40, true, 0)
+
+	var walked []string
+	err := walkSubtree(agent, tuner, nil, "1.3.6.1.2.1.2.2.1.10", func(pdu gosnmp.SnmpPDU) error {
+		walked = append(walked, pdu.Name)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, walked, 20)
+	// 40 and 20 time out, 10 succeeds and the walk ends past the subtree
+	assert.Equal(t, []int{40, 20, 10, 10, 10}, agent.repetitions)
+	assert.Equal(t, 10, tuner.current)
+
+	// A walk that didn't shrink grows the repetitions
+	assert.NoError(t, walkSubtree(agent, tuner, nil, ".1.3.6.1.2.1.2.2.1.11", func(gosnmp.SnmpPDU) error { return nil }))
+	assert.Equal(t, 12, tuner.current)
+}
+
+func TestWalkSubtree_Fixed(t *testing.T) {
+	agent := newFakeAgent(10, integer(".1.3.6.1.2.1.1.3.0", 100), octets(".1.3.6.1.2.1.1.4.0", []byte("noc")))
+	tuner := newRepetitionTuner(20, false, 5)
+	assert.Equal(t, 20, tuner.current)
+
+	// Without adaptive mode the timeout is returned
+	err := walkSubtree(agent, tuner, nil, ".1.3.6.1.2.1.1", func(gosnmp.SnmpPDU) error { return nil })
+	assert.Error(t, err)
+	assert.Equal(t, []int{20}, agent.repetitions)
+
+	// A leaf OID is read with a GET
+	agent.limit = 20
+	var walked []gosnmp.SnmpPDU
+	err = walkSubtree(agent, tuner, nil, ".1.3.6.1.2.1.1.3.0", func(pdu gosnmp.SnmpPDU) error {
+		walked = append(walked, pdu)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []gosnmp.SnmpPDU{integer(".1.3.6.1.2.1.1.3.0", 100)}, walked)
+}
+
+func TestWalkSubtree_Budget(t *testing.T) {
+	var pdus []gosnmp.SnmpPDU
+	for i := 1; i <= 20; i++ {
+		pdus = append(pdus,
+			integer(fmt.Sprintf(".1.3.6.1.2.1.2.2.1.2.%d", i), i),
+			integer(fmt.Sprintf(".1.3.6.1.2.1.2.2.1.10.%d", i), i),
+			integer(fmt.Sprintf(".1.3.6.1.2.1.2.2.1.16.%d", i), i))
+	}
+	agent := newFakeAgent(10, pdus...)
+	columns := []string{".1.3.6.1.2.1.2.2.1.2", ".1.3.6.1.2.1.2.2.1.10", ".1.3.6.1.2.1.2.2.1.16"}
+
+	var walked []string
+	walkFn := func(pdu gosnmp.SnmpPDU) error {
+		walked = append(walked, pdu.Name)
+		return nil
+	}
+	// Every column of the first 5 rows is read, the walk skipping to the next
+	// column once past them
+	err := walkSubtree(agent, newRepetitionTuner(10, false, 0), newWalkBudget(0, 5, columns, time.Now()), ".1.3.6.1.2.1.2.2.1", walkFn)
+	if assert.IsType(t, &walkTruncatedError{}, err) {
+		assert.Empty(t, err.(*walkTruncatedError).lastOid)
+	}
+	assert.Len(t, walked, 15)
+	assert.Contains(t, walked, ".1.3.6.1.2.1.2.2.1.16.5")
+	assert.NotContains(t, walked, ".1.3.6.1.2.1.2.2.1.2.6")
+	assert.Len(t, agent.repetitions, 4)
+
+	walked = nil
+	err = walkSubtree(agent, newRepetitionTuner(10, false, 0), newWalkBudget(time.Second, 0, columns, time.Now().Add(-time.Minute)), ".1.3.6.1.2.1.2.2.1", walkFn)
+	if assert.IsType(t, &walkTruncatedError{}, err) {
+		assert.Equal(t, ".1.3.6.1.2.1.2.2.1", err.(*walkTruncatedError).lastOid)
+	}
+	assert.Empty(t, walked)
+
+	assert.Nil(t, newWalkBudget(0, 0, columns, time.Now()))
+}
+
+func TestWalkSubtree_ErrorStatus(t *testing.T) {
+	agent := newFakeAgent(10, integer(".1.3.6.1.2.1.2.2.1.10.1", 1))
+	walkFn := func(pdu gosnmp.SnmpPDU) error {
+		t.Errorf("unexpected PDU %s", pdu.Name)
+		return nil
+	}
+	for _, status := range []gosnmp.SNMPError{gosnmp.GenErr, gosnmp.NoAccess} {
+		agent.status = status
+		err := walkSubtree(agent, newRepetitionTuner(10, false, 0), nil, ".1.3.6.1.2.1.2.2.1.10", walkFn)
+		if assert.Error(t, err, status.String()) {
+			assert.Contains(t, err.Error(), getErrorMessage(status))
+		}
+	}
+
+	// noSuchName is how SNMPv1 agents end a walk
+	agent.status = gosnmp.NoSuchName
+	assert.NoError(t, walkSubtree(agent, newRepetitionTuner(10, false, 0), nil, ".1.3.6.1.2.1.2.2.1.10", walkFn))
+}
+
+func TestNewRepetitionTuner(t *testing.T) {
+	assert.Equal(t, 30, newRepetitionTuner(50, true, 30).current)
+	// The learned value never exceeds the configured maximum
+	assert.Equal(t, 20, newRepetitionTuner(20, true, 30).current)
+	assert.Equal(t, defaultMaxRepetitions, newRepetitionTuner(0, true, 0).current)
+	assert.Equal(t, defaultMaxRepetitions, newRepetitionTuner(300, false, 0).current)
+}